@@ -1,12 +1,34 @@
 package main
 
 import (
+	"net/http"
+	"os"
+	"time"
+
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/cainjector"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/consistency"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/dryrun"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/hooks/gateways"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/hooks/ingresses"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/hooks/routes"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/importer"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/istio"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/orphans"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/release"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/status"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/csrs"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/trust"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/webhook"
 	"github.com/nirvati/vcluster-sdk/plugin"
 	"k8s.io/klog"
 )
@@ -14,29 +36,161 @@ import (
 func main() {
 	_ = certmanagerv1.AddToScheme(scheme.Scheme)
 	
+	// the import subcommand marks host objects for import and exits
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		err := importer.Command(os.Args[2:])
+		if err != nil {
+			klog.Fatalf("Error marking objects for import: %v", err)
+		}
+		return
+	}
+
+	// the status subcommand prints the host objects of virtual objects and exits
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		err := status.Command(os.Args[2:])
+		if err != nil {
+			klog.Fatalf("Error inspecting objects: %v", err)
+		}
+		return
+	}
+
 	// init plugin
 	registerCtx := plugin.MustInit()
 
+	// load plugin config
+	cfg, err := config.Load()
+	if err != nil {
+		klog.Fatalf("Error loading plugin config: %v", err)
+	}
+
+	// init naming strategy
+	err = naming.Init(registerCtx, cfg.Naming.Strategy)
+	if err != nil {
+		klog.Fatalf("Error initializing naming strategy: %v", err)
+	}
+
+	// in dry-run mode writes are recorded instead of applied
+	var dryRun *dryrun.Recorder
+	if cfg.DryRun {
+		dryRun = dryrun.Enable(registerCtx)
+	}
+
+	// serve debug endpoints
+	if cfg.Debug.Enabled {
+		go serveDebug(cfg.Debug.Address, registerCtx)
+	}
+
+	// in release mode the host objects are handed over and nothing is synced
+	if cfg.Release.Enabled {
+		plugin.MustRegister(release.New(registerCtx, cfg.Release))
+		plugin.MustStart()
+		return
+	}
+
+	// the owners registry maps host objects to the virtual objects that own them
+	registry := owners.NewRegistry()
+
+	// the conflict resolver decides which virtual object owns a host object claimed by several
+	resolver, err := conflicts.NewResolver(registerCtx, cfg.ConflictPolicy, registry)
+	if err != nil {
+		klog.Fatalf("Error creating conflict resolver: %v", err)
+	}
+
 	// register ingress hook
-	plugin.MustRegister(ingresses.NewIngressHook())
+	plugin.MustRegister(ingresses.NewIngressHook(dryRun))
+
+	// register route hook for the route integration
+	if cfg.Routes.Enabled {
+		plugin.MustRegister(routes.NewRouteHook(dryRun))
+	}
+
+	// register gateway hook and the copies of gateway secrets for Istio
+	if cfg.IstioGateways.Enabled {
+		plugin.MustRegister(gateways.NewGatewayHook(registerCtx, cfg.IstioGateways, dryRun))
+		if cfg.IstioGateways.Namespace != "" {
+			plugin.MustRegister(istio.NewCopier(registerCtx, cfg.IstioGateways, registry))
+		}
+	}
 
 	// register certificate syncer
-	syncer, err := certificates.New(registerCtx)
+	syncer, err := certificates.New(registerCtx, cfg, registry, resolver)
 	if err != nil {
 		klog.Fatalf("Error creating certificate syncer: %v", err)
 	}
 	plugin.MustRegister(syncer)
 
 	// register issuer syncer
-	issuers_syncer, err := issuers.New(registerCtx)
+	issuers_syncer, err := issuers.New(registerCtx, resolver)
+	if err != nil {
+		klog.Fatalf("Error creating issuer syncer: %v", err)
+	}
 	plugin.MustRegister(issuers_syncer)
 
 	// register secrets syncer
-	secrets_syncer, err := secrets.New(registerCtx)
+	secrets_syncer, err := secrets.New(registerCtx, cfg, registry, resolver)
 	if err != nil {
 		klog.Fatalf("Error creating secrets syncer: %v", err)
 	}
 	plugin.MustRegister(secrets_syncer)
 
+	// register syncer of certificate signing requests for cert-manager signers
+	if cfg.CertificateSigningRequests.Enabled {
+		csrSyncer, err := csrs.New(registerCtx, cfg.CertificateSigningRequests)
+		if err != nil {
+			klog.Fatalf("Error creating certificate signing request syncer: %v", err)
+		}
+		plugin.MustRegister(csrSyncer)
+	}
+
+	// register importer of host objects marked for import
+	if cfg.Importer.Enabled {
+		plugin.MustRegister(importer.New(registerCtx))
+	}
+
+	// register CA injector for the webhooks, CRDs and APIServices of the virtual cluster
+	if cfg.CAInjector.Enabled {
+		injector, err := cainjector.New(registerCtx)
+		if err != nil {
+			klog.Fatalf("Error creating CA injector: %v", err)
+		}
+		plugin.MustRegister(injector)
+	}
+
+	// register distribution of trust-manager Bundles into the virtual namespaces
+	if cfg.TrustBundles.Enabled {
+		distributor, err := trust.New(registerCtx, cfg.TrustBundles)
+		if err != nil {
+			klog.Fatalf("Error creating trust bundle distributor: %v", err)
+		}
+		plugin.MustRegister(distributor)
+	}
+
+	// register validating webhook for the cert-manager objects of the virtual cluster
+	if cfg.Webhook.Enabled {
+		plugin.MustRegister(webhook.New(registerCtx, cfg.Webhook, resolver))
+	}
+
+	// register scan of virtual and host objects on startup
+	if cfg.ConsistencyScan.Enabled {
+		plugin.MustRegister(consistency.New(cfg))
+	}
+
+	// register collector of host objects whose virtual objects are gone
+	if cfg.OrphanCollection.Enabled {
+		plugin.MustRegister(orphans.New(registerCtx, cfg.OrphanCollection))
+	}
+
 	plugin.MustStart()
 }
+
+func serveDebug(address string, ctx *synccontext.RegisterContext) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/names", naming.NewDebugHandler(ctx.VirtualManager.GetClient()))
+
+	klog.Infof("Serving debug endpoints on %s", address)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	err := server.ListenAndServe()
+	if err != nil {
+		klog.Errorf("Error serving debug endpoints: %v", err)
+	}
+}
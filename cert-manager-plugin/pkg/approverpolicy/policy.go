@@ -0,0 +1,116 @@
+// Package approverpolicy helps to enforce per-tenant CertificateRequestPolicies of cert-manager
+// approver-policy. All CertificateRequests of a vcluster are created on the host on behalf of
+// the plugin, so the plugin labels the host Certificates with the vcluster and the virtual
+// namespace they belong to and cert-manager copies the labels onto the CertificateRequests.
+//
+// approver-policy only selects policies by issuer and namespace, so the labels are matched by
+// an approver-policy plugin. Evaluate and Validate implement the "vcluster" plugin without
+// depending on approver-policy, so they can be wrapped in a custom approver-policy build.
+package approverpolicy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+)
+
+const (
+	// PluginName is the name of the plugin in the spec.plugins of a CertificateRequestPolicy
+	PluginName = "vcluster"
+
+	// ValueVClusters holds the comma separated names of the vclusters the policy allows
+	ValueVClusters = "vclusters"
+
+	// ValueNamespaces holds the comma separated virtual namespaces the policy allows. Namespaces
+	// may contain shell patterns, e.g. team-*.
+	ValueNamespaces = "namespaces"
+)
+
+// Labels returns the labels that identify the vcluster and the virtual namespace of a host
+// Certificate
+func Labels(vNamespace string) map[string]string {
+	return map[string]string{
+		constants.VClusterLabel:         translate.VClusterName,
+		constants.VirtualNamespaceLabel: vNamespace,
+	}
+}
+
+// AddLabels adds the labels that identify the vcluster and the virtual namespace to the labels
+// of a host object. The labels of Ingresses and Routes are copied onto the Certificates that
+// cert-manager creates for them.
+func AddLabels(labels map[string]string, vNamespace string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range Labels(vNamespace) {
+		labels[k] = v
+	}
+
+	return labels
+}
+
+// Evaluate checks the labels of a CertificateRequest against the plugin values of a policy and
+// returns the reasons the request is denied. Values that aren't set allow every request, while
+// requests without the labels are denied as soon as a value is set.
+func Evaluate(requestLabels map[string]string, values map[string]string) []string {
+	denied := []string{}
+	check := func(value, label, what string) {
+		patterns := split(values[value])
+		if len(patterns) == 0 {
+			return
+		}
+
+		actual := requestLabels[label]
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, actual); matched && actual != "" {
+				return
+			}
+		}
+		if actual == "" {
+			denied = append(denied, fmt.Sprintf("request has no %s label %s", what, label))
+			return
+		}
+		denied = append(denied, fmt.Sprintf("%s %q is not allowed, allowed are %s", what, actual, strings.Join(patterns, ", ")))
+	}
+
+	check(ValueVClusters, constants.VClusterLabel, "vcluster")
+	check(ValueNamespaces, constants.VirtualNamespaceLabel, "virtual namespace")
+	return denied
+}
+
+// Validate checks the plugin values of a policy
+func Validate(values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key != ValueVClusters && key != ValueNamespaces {
+			return fmt.Errorf("unknown value %s of plugin %s, expected %s or %s", key, PluginName, ValueVClusters, ValueNamespaces)
+		}
+		for _, pattern := range split(values[key]) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q in value %s of plugin %s: %w", pattern, key, PluginName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func split(value string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
@@ -0,0 +1,87 @@
+package approverpolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+)
+
+func TestEvaluate(t *testing.T) {
+	requestLabels := map[string]string{
+		constants.VClusterLabel:         "tenant-a",
+		constants.VirtualNamespaceLabel: "team-shop",
+	}
+
+	tests := []struct {
+		name           string
+		labels         map[string]string
+		values         map[string]string
+		expectedDenial string
+	}{
+		{
+			name:   "no values",
+			labels: requestLabels,
+			values: map[string]string{},
+		},
+		{
+			name:   "allowed vcluster and namespace pattern",
+			labels: requestLabels,
+			values: map[string]string{ValueVClusters: "tenant-a, tenant-b", ValueNamespaces: "team-*"},
+		},
+		{
+			name:           "other vcluster",
+			labels:         requestLabels,
+			values:         map[string]string{ValueVClusters: "tenant-b"},
+			expectedDenial: `vcluster "tenant-a" is not allowed, allowed are tenant-b`,
+		},
+		{
+			name:           "other namespace",
+			labels:         requestLabels,
+			values:         map[string]string{ValueNamespaces: "kube-*"},
+			expectedDenial: `virtual namespace "team-shop" is not allowed, allowed are kube-*`,
+		},
+		{
+			name:           "request without labels",
+			labels:         map[string]string{},
+			values:         map[string]string{ValueNamespaces: "*"},
+			expectedDenial: "request has no virtual namespace label",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			denied := strings.Join(Evaluate(test.labels, test.values), "; ")
+			if test.expectedDenial == "" && denied != "" {
+				t.Errorf("expected request to be allowed, got %s", denied)
+			} else if !strings.Contains(denied, test.expectedDenial) {
+				t.Errorf("expected denial %q, got %q", test.expectedDenial, denied)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(map[string]string{ValueVClusters: "tenant-a", ValueNamespaces: "team-*"}); err != nil {
+		t.Errorf("expected values to be valid, got %v", err)
+	}
+	if err := Validate(map[string]string{"tenant": "a"}); err == nil {
+		t.Errorf("expected unknown value to be rejected")
+	}
+	if err := Validate(map[string]string{ValueNamespaces: "team-["}); err == nil {
+		t.Errorf("expected invalid pattern to be rejected")
+	}
+}
+
+func TestAddLabels(t *testing.T) {
+	// virtual labels must not be able to claim another tenant
+	labels := AddLabels(map[string]string{"app": "web", constants.VirtualNamespaceLabel: "other"}, "shop")
+	if labels["app"] != "web" || labels[constants.VirtualNamespaceLabel] != "shop" || labels[constants.VClusterLabel] != translate.VClusterName {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	if labels := AddLabels(nil, "shop"); labels[constants.VirtualNamespaceLabel] != "shop" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+}
@@ -0,0 +1,312 @@
+// Package cainjector injects CA bundles into the webhooks, CRDs and APIServices of the virtual
+// cluster. The cainjector of cert-manager runs against the host API server and can't see these
+// objects, so the plugin takes over its job inside the virtual cluster. The CA data is read from
+// the virtual Certificates and the TLS secrets that are synced backwards into the virtual cluster.
+package cainjector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// injectionAnnotations are the annotations that request a CA bundle
+var injectionAnnotations = []string{
+	constants.InjectCAFromAnnotation,
+	constants.InjectCAFromSecretAnnotation,
+	constants.InjectAPIServerCAAnnotation,
+}
+
+// requested selects the objects that request a CA bundle
+var requested = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	for _, annotation := range injectionAnnotations {
+		if obj.GetAnnotations()[annotation] != "" {
+			return true
+		}
+	}
+
+	return false
+})
+
+// targetKind is a kind of object CA bundles are injected into
+type targetKind struct {
+	name string
+	obj  func() client.Object
+	list func() client.ObjectList
+
+	// inject sets the CA bundle and returns whether the object changed
+	inject func(obj client.Object, caBundle []byte) bool
+}
+
+var (
+	validatingWebhookConfigurations = targetKind{
+		name: "validatingwebhookconfiguration",
+		obj:  func() client.Object { return &admissionregistrationv1.ValidatingWebhookConfiguration{} },
+		list: func() client.ObjectList { return &admissionregistrationv1.ValidatingWebhookConfigurationList{} },
+		inject: func(obj client.Object, caBundle []byte) bool {
+			webhookConfiguration := obj.(*admissionregistrationv1.ValidatingWebhookConfiguration)
+			changed := false
+			for i := range webhookConfiguration.Webhooks {
+				changed = setCABundle(&webhookConfiguration.Webhooks[i].ClientConfig.CABundle, caBundle) || changed
+			}
+			return changed
+		},
+	}
+
+	mutatingWebhookConfigurations = targetKind{
+		name: "mutatingwebhookconfiguration",
+		obj:  func() client.Object { return &admissionregistrationv1.MutatingWebhookConfiguration{} },
+		list: func() client.ObjectList { return &admissionregistrationv1.MutatingWebhookConfigurationList{} },
+		inject: func(obj client.Object, caBundle []byte) bool {
+			webhookConfiguration := obj.(*admissionregistrationv1.MutatingWebhookConfiguration)
+			changed := false
+			for i := range webhookConfiguration.Webhooks {
+				changed = setCABundle(&webhookConfiguration.Webhooks[i].ClientConfig.CABundle, caBundle) || changed
+			}
+			return changed
+		},
+	}
+
+	// customResourceDefinitions only get the CA bundle of their conversion webhook
+	customResourceDefinitions = targetKind{
+		name: "customresourcedefinition",
+		obj:  func() client.Object { return &apiextensionsv1.CustomResourceDefinition{} },
+		list: func() client.ObjectList { return &apiextensionsv1.CustomResourceDefinitionList{} },
+		inject: func(obj client.Object, caBundle []byte) bool {
+			conversion := obj.(*apiextensionsv1.CustomResourceDefinition).Spec.Conversion
+			if conversion == nil || conversion.Strategy != apiextensionsv1.WebhookConverter || conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+				return false
+			}
+			return setCABundle(&conversion.Webhook.ClientConfig.CABundle, caBundle)
+		},
+	}
+
+	apiServices = targetKind{
+		name: "apiservice",
+		obj:  func() client.Object { return &apiregistrationv1.APIService{} },
+		list: func() client.ObjectList { return &apiregistrationv1.APIServiceList{} },
+		inject: func(obj client.Object, caBundle []byte) bool {
+			return setCABundle(&obj.(*apiregistrationv1.APIService).Spec.CABundle, caBundle)
+		},
+	}
+
+	// targets are all kinds of objects CA bundles are injected into
+	targets = []targetKind{validatingWebhookConfigurations, mutatingWebhookConfigurations, customResourceDefinitions, apiServices}
+)
+
+func setCABundle(field *[]byte, caBundle []byte) bool {
+	if bytes.Equal(*field, caBundle) {
+		return false
+	}
+
+	*field = caBundle
+	return true
+}
+
+// Injector injects CA bundles into the objects of the virtual cluster that request them
+type Injector struct {
+	registerCtx *synccontext.RegisterContext
+
+	// apiServerCA is the CA of the virtual API server
+	apiServerCA []byte
+}
+
+// New creates a new CA injector
+func New(ctx *synccontext.RegisterContext) (*Injector, error) {
+	restConfig := ctx.VirtualManager.GetConfig()
+	apiServerCA := restConfig.CAData
+	if len(apiServerCA) == 0 && restConfig.CAFile != "" {
+		var err error
+		apiServerCA, err = os.ReadFile(restConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA of virtual API server: %w", err)
+		}
+	}
+
+	return &Injector{
+		registerCtx: ctx,
+		apiServerCA: apiServerCA,
+	}, nil
+}
+
+func (i *Injector) Name() string {
+	return "cainjector"
+}
+
+var _ syncertypes.ControllerStarter = &Injector{}
+
+// Register starts a controller per target on the virtual cluster. Changes of Certificates and
+// secrets are mapped to the objects that inject their CA.
+func (i *Injector) Register(ctx *synccontext.RegisterContext) error {
+	for _, target := range targets {
+		err := ctrl.NewControllerManagedBy(ctx.VirtualManager).
+			Named("cainjector-"+target.name).
+			For(target.obj(), builder.WithPredicates(requested)).
+			Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(i.mapSources(target))).
+			Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(i.mapSources(target))).
+			Complete(reconcile.Func(func(c context.Context, req reconcile.Request) (reconcile.Result, error) {
+				return i.reconcile(c, req, target)
+			}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapSources maps a changed Certificate or secret to the objects of the target that inject its CA
+func (i *Injector) mapSources(target targetKind) handler.MapFunc {
+	return func(c context.Context, obj client.Object) []reconcile.Request {
+		list := target.list()
+		err := i.registerCtx.VirtualManager.GetClient().List(c, list)
+		if err != nil {
+			return nil
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		name := obj.GetNamespace() + "/" + obj.GetName()
+		for _, injectable := range objs {
+			injectable := injectable.(client.Object)
+			annotations := injectable.GetAnnotations()
+			switch obj.(type) {
+			case *certmanagerv1.Certificate:
+				if annotations[constants.InjectCAFromAnnotation] != name {
+					continue
+				}
+			case *corev1.Secret:
+				// a certificate secret only matters for certificates in the same namespace
+				from := annotations[constants.InjectCAFromAnnotation]
+				if annotations[constants.InjectCAFromSecretAnnotation] != name && !strings.HasPrefix(from, obj.GetNamespace()+"/") {
+					continue
+				}
+			}
+
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: injectable.GetName()}})
+		}
+
+		return requests
+	}
+}
+
+func (i *Injector) reconcile(c context.Context, req reconcile.Request, target targetKind) (reconcile.Result, error) {
+	ctx := i.registerCtx.ToSyncContext("cainjector")
+	ctx.Context = c
+
+	obj := target.obj()
+	err := ctx.VirtualClient.Get(c, req.NamespacedName, obj)
+	if kerrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, i.inject(ctx, target, obj)
+}
+
+// inject injects the requested CA bundle into the object. Nothing is injected while the source
+// has no CA data yet.
+func (i *Injector) inject(ctx *synccontext.SyncContext, target targetKind, obj client.Object) error {
+	source, caBundle, err := i.caBundle(ctx, obj.GetAnnotations())
+	if err != nil {
+		ctx.Log.Infof("can't inject CA into %s %s: %v", target.name, obj.GetName(), err)
+		return nil
+	} else if len(caBundle) == 0 || !target.inject(obj, caBundle) {
+		return nil
+	}
+
+	ctx.Log.Infof("inject CA from %s into %s %s", source, target.name, obj.GetName())
+	return ctx.VirtualClient.Update(ctx, obj)
+}
+
+// caBundle returns the source and the CA bundle the annotations request. Errors are returned
+// for invalid requests only, missing sources return an empty CA bundle.
+func (i *Injector) caBundle(ctx *synccontext.SyncContext, annotations map[string]string) (string, []byte, error) {
+	if from := annotations[constants.InjectCAFromAnnotation]; from != "" {
+		name, err := parseName(from)
+		if err != nil {
+			return "", nil, err
+		}
+
+		certificate := &certmanagerv1.Certificate{}
+		err = ctx.VirtualClient.Get(ctx, name, certificate)
+		if kerrors.IsNotFound(err) {
+			return from, nil, nil
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		secret, err := i.secret(ctx, types.NamespacedName{Namespace: name.Namespace, Name: certificate.Spec.SecretName})
+		if err != nil || secret == nil {
+			return from, nil, err
+		}
+		return "certificate " + from, secret.Data[cmmeta.TLSCAKey], nil
+	}
+
+	if from := annotations[constants.InjectCAFromSecretAnnotation]; from != "" {
+		name, err := parseName(from)
+		if err != nil {
+			return "", nil, err
+		}
+
+		secret, err := i.secret(ctx, name)
+		if err != nil || secret == nil {
+			return from, nil, err
+		} else if secret.Annotations[constants.AllowDirectInjectionAnnotation] != "true" {
+			return "", nil, fmt.Errorf("secret %s doesn't allow direct injection with the %s annotation", from, constants.AllowDirectInjectionAnnotation)
+		}
+		return "secret " + from, secret.Data[cmmeta.TLSCAKey], nil
+	}
+
+	if annotations[constants.InjectAPIServerCAAnnotation] == "true" {
+		return "virtual API server", i.apiServerCA, nil
+	}
+
+	return "", nil, nil
+}
+
+func (i *Injector) secret(ctx *synccontext.SyncContext, name types.NamespacedName) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := ctx.VirtualClient.Get(ctx, name, secret)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func parseName(value string) (types.NamespacedName, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q isn't of the form namespace/name", value)
+	}
+
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
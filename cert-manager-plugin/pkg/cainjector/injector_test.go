@@ -0,0 +1,192 @@
+package cainjector
+
+import (
+	"context"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newInjector(vObjs ...runtime.Object) *Injector {
+	return &Injector{
+		registerCtx: fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme, vObjs...), testingutil.NewFakeClient(scheme.Scheme)),
+		apiServerCA: []byte("apiserver-ca"),
+	}
+}
+
+// newSources returns a virtual certificate and its backward synced secret, and a CA secret that
+// allows direct injection
+func newSources() []runtime.Object {
+	return []runtime.Object{
+		&certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "shop"},
+			Spec:       certmanagerv1.CertificateSpec{SecretName: "webhook-tls"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-tls", Namespace: "shop", Annotations: map[string]string{constants.BackwardSyncAnnotation: "true"}},
+			Data:       map[string][]byte{cmmeta.TLSCAKey: []byte("certificate-ca")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "shop", Annotations: map[string]string{constants.AllowDirectInjectionAnnotation: "true"}},
+			Data:       map[string][]byte{cmmeta.TLSCAKey: []byte("secret-ca")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "shop"},
+			Data:       map[string][]byte{cmmeta.TLSCAKey: []byte("private-ca")},
+		},
+	}
+}
+
+func TestInject(t *testing.T) {
+	webhookConfiguration := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Annotations: map[string]string{constants.InjectCAFromAnnotation: "shop/webhook"}},
+		Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "a.shop.example.com"}, {Name: "b.shop.example.com"}},
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders.shop.example.com", Annotations: map[string]string{constants.InjectCAFromSecretAnnotation: "shop/ca"}},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextensionsv1.CustomResourceConversion{
+				Strategy: apiextensionsv1.WebhookConverter,
+				Webhook:  &apiextensionsv1.WebhookConversion{ClientConfig: &apiextensionsv1.WebhookClientConfig{}},
+			},
+		},
+	}
+	private := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "private", Annotations: map[string]string{constants.InjectCAFromSecretAnnotation: "shop/private"}},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "private.shop.example.com"}},
+	}
+	apiService := &apiregistrationv1.APIService{
+		ObjectMeta: metav1.ObjectMeta{Name: "v1.shop.example.com", Annotations: map[string]string{constants.InjectAPIServerCAAnnotation: "true"}},
+	}
+	injector := newInjector(append(newSources(), webhookConfiguration, crd, private, apiService)...)
+	vClient := injector.registerCtx.VirtualManager.GetClient()
+
+	tests := []struct {
+		target   targetKind
+		obj      client.Object
+		caBundle func(obj client.Object) [][]byte
+		expected string
+	}{
+		{
+			target: validatingWebhookConfigurations,
+			obj:    &admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+			caBundle: func(obj client.Object) [][]byte {
+				webhooks := obj.(*admissionregistrationv1.ValidatingWebhookConfiguration).Webhooks
+				return [][]byte{webhooks[0].ClientConfig.CABundle, webhooks[1].ClientConfig.CABundle}
+			},
+			expected: "certificate-ca",
+		},
+		{
+			target: customResourceDefinitions,
+			obj:    &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "orders.shop.example.com"}},
+			caBundle: func(obj client.Object) [][]byte {
+				return [][]byte{obj.(*apiextensionsv1.CustomResourceDefinition).Spec.Conversion.Webhook.ClientConfig.CABundle}
+			},
+			expected: "secret-ca",
+		},
+		{
+			// secrets that don't allow direct injection aren't injected
+			target: mutatingWebhookConfigurations,
+			obj:    &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "private"}},
+			caBundle: func(obj client.Object) [][]byte {
+				return [][]byte{obj.(*admissionregistrationv1.MutatingWebhookConfiguration).Webhooks[0].ClientConfig.CABundle}
+			},
+			expected: "",
+		},
+		{
+			target: apiServices,
+			obj:    &apiregistrationv1.APIService{ObjectMeta: metav1.ObjectMeta{Name: "v1.shop.example.com"}},
+			caBundle: func(obj client.Object) [][]byte {
+				return [][]byte{obj.(*apiregistrationv1.APIService).Spec.CABundle}
+			},
+			expected: "apiserver-ca",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target.name, func(t *testing.T) {
+			_, err := injector.reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(test.obj)}, test.target)
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			err = vClient.Get(context.Background(), client.ObjectKeyFromObject(test.obj), test.obj)
+			if err != nil {
+				t.Fatalf("get %s: %v", test.obj.GetName(), err)
+			}
+			for _, caBundle := range test.caBundle(test.obj) {
+				if string(caBundle) != test.expected {
+					t.Errorf("expected CA bundle %q, got %q", test.expected, string(caBundle))
+				}
+			}
+		})
+	}
+}
+
+func TestMapSources(t *testing.T) {
+	injector := newInjector(
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "shop", Annotations: map[string]string{constants.InjectCAFromAnnotation: "shop/webhook"}}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "direct", Annotations: map[string]string{constants.InjectCAFromSecretAnnotation: "shop/ca"}}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "other", Annotations: map[string]string{constants.InjectCAFromAnnotation: "billing/webhook"}}},
+	)
+	mapSources := injector.mapSources(validatingWebhookConfigurations)
+
+	tests := []struct {
+		name     string
+		obj      client.Object
+		expected []string
+	}{
+		{
+			name:     "certificate",
+			obj:      &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "shop"}},
+			expected: []string{"shop"},
+		},
+		{
+			name:     "certificate secret",
+			obj:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "webhook-tls", Namespace: "shop"}},
+			expected: []string{"shop"},
+		},
+		{
+			name:     "ca secret",
+			obj:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "shop"}},
+			expected: []string{"direct", "shop"},
+		},
+		{
+			name:     "unrelated secret",
+			obj:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "default"}},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := mapSources(context.Background(), test.obj)
+			if len(requests) != len(test.expected) {
+				t.Fatalf("expected requests for %v, got %v", test.expected, requests)
+			}
+			for _, name := range test.expected {
+				found := false
+				for _, request := range requests {
+					found = found || request.NamespacedName == types.NamespacedName{Name: name}
+				}
+				if !found {
+					t.Errorf("expected a request for %s, got %v", name, requests)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nirvati/vcluster-sdk/plugin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Config is the plugin configuration that is passed in by vcluster through the
+// plugin config of the vcluster values.
+type Config struct {
+	// KeySealing configures the sealing of private keys that are synced from the host
+	// into the virtual cluster
+	KeySealing KeySealing `json:"keySealing,omitempty"`
+
+	// Naming configures how the names of virtual objects are translated to host names
+	Naming Naming `json:"naming,omitempty"`
+
+	// ConflictPolicy decides what happens if several virtual Certificates or Issuers reference
+	// the same secret, either refuse, first-writer-wins or shared
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// DriftPolicy decides what happens if the spec of a host Certificate was changed outside of
+	// the virtual cluster, either overwrite, alert or adopt
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+
+	// DryRun records the writes of the syncers and the ingress hook in the logs and as
+	// events instead of applying them
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// OrphanCollection configures the periodic collection of host objects whose virtual
+	// objects are gone
+	OrphanCollection OrphanCollection `json:"orphanCollection,omitempty"`
+
+	// ConsistencyScan configures the scan that compares virtual and host objects on startup
+	ConsistencyScan ConsistencyScan `json:"consistencyScan,omitempty"`
+
+	// CAInjector configures the injection of CA bundles into the webhooks, CRDs and APIServices
+	// of the virtual cluster
+	CAInjector CAInjector `json:"caInjector,omitempty"`
+
+	// CertificateSigningRequests configures the forwarding of virtual CertificateSigningRequests
+	// for cert-manager signers to the host
+	CertificateSigningRequests CertificateSigningRequests `json:"certificateSigningRequests,omitempty"`
+
+	// TrustBundles configures the distribution of trust-manager Bundles into the virtual
+	// namespaces
+	TrustBundles TrustBundles `json:"trustBundles,omitempty"`
+
+	// Webhook configures the validating webhook for the cert-manager objects of the virtual
+	// cluster
+	Webhook Webhook `json:"webhook,omitempty"`
+
+	// Routes configures the handling of OpenShift Routes annotated for cert-manager's route
+	// integration
+	Routes Routes `json:"routes,omitempty"`
+
+	// IstioGateways configures the handling of the TLS secrets of Istio Gateways
+	IstioGateways IstioGateways `json:"istioGateways,omitempty"`
+
+	// Importer configures the import of host Certificates and Issuers that are marked for
+	// import
+	Importer Importer `json:"importer,omitempty"`
+
+	// Release configures the release mode that hands the host objects of the plugin over
+	// instead of syncing them
+	Release Release `json:"release,omitempty"`
+
+	// Debug configures the debug endpoints of the plugin
+	Debug Debug `json:"debug,omitempty"`
+}
+
+// KeySealing configures the sealing of private keys that are synced backwards
+type KeySealing struct {
+	// Enabled signals if private keys of backward synced secrets should be sealed
+	Enabled bool `json:"enabled,omitempty"`
+
+	// SecretName is the name of the host secret in the vcluster namespace that holds
+	// the public key used to seal private keys
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretKey is the key within the host secret that holds the public key
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// Naming configures the naming strategy
+type Naming struct {
+	// Strategy is the naming strategy for Certificates and Issuers, either default or predictable
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// OrphanCollection configures the orphan collector
+type OrphanCollection struct {
+	// Enabled enables the periodic collection of orphans
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is the time between two collections
+	Interval metav1.Duration `json:"interval,omitempty"`
+
+	// GracePeriod is the time a host object has to be orphaned before it's collected
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+
+	// Action decides what happens to orphans, either report or delete
+	Action string `json:"action,omitempty"`
+}
+
+// ConsistencyScan configures the consistency scan
+type ConsistencyScan struct {
+	// Enabled runs the scan on startup
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Repair updates drifted objects to match the virtual objects
+	Repair bool `json:"repair,omitempty"`
+
+	// ConfigMap is the name of the virtual config map the report is written to
+	ConfigMap string `json:"configMap,omitempty"`
+
+	// Namespace is the virtual namespace of the report config map
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CAInjector configures the CA injector
+type CAInjector struct {
+	// Enabled turns on the CA injection. Leave it off if cert-manager's cainjector runs inside
+	// the virtual cluster.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// CertificateSigningRequests configures the CertificateSigningRequest syncer
+type CertificateSigningRequests struct {
+	// Enabled forwards the approved virtual CertificateSigningRequests for cert-manager signers
+	// to the host
+	Enabled bool `json:"enabled,omitempty"`
+
+	// ClusterIssuers are the names of the ClusterIssuers requests are forwarded for. Requests for
+	// other ClusterIssuers are refused, as every user that may approve requests in the virtual
+	// cluster could get certificates from them otherwise.
+	ClusterIssuers []string `json:"clusterIssuers,omitempty"`
+
+	// Approve approves the forwarded host requests itself. By default they wait for an approver
+	// on the host, e.g. approver-policy.
+	Approve bool `json:"approve,omitempty"`
+}
+
+// TrustBundles configures the distribution of trust-manager Bundles
+type TrustBundles struct {
+	// Enabled enables the distribution of Bundles
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Selector selects the host Bundles that are distributed by their labels. If empty, all
+	// Bundles are distributed.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Webhook configures the validating webhook
+type Webhook struct {
+	// Enabled registers the webhook in the virtual cluster
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Host is the host the virtual API server reaches the plugin at, an IP or a DNS name
+	Host string `json:"host,omitempty"`
+
+	// Port is the port the webhook is served on
+	Port int `json:"port,omitempty"`
+
+	// FailurePolicy decides what happens if the webhook can't be reached, either Ignore or Fail
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+// Routes configures the handling of OpenShift Routes
+type Routes struct {
+	// Enabled translates the issuers of annotated virtual Routes and syncs the Certificates the
+	// route integration creates for them back. The Route CRD must exist in the virtual cluster.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// IstioGateways configures the handling of Istio Gateways
+type IstioGateways struct {
+	// Enabled rewrites the credentialNames of synced Gateways that reference the secrets of virtual
+	// Certificates to the host secrets. The Gateway CRD must exist in the virtual cluster.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Namespace is the host namespace of the Istio ingress gateway the secrets are copied into.
+	// If empty, the secrets aren't copied and the ingress gateway has to run in the host
+	// namespace of the vcluster.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Importer configures the importer
+type Importer struct {
+	// Enabled imports the host Certificates and Issuers of the vcluster namespace that carry
+	// the import annotation
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// Release configures the release mode
+type Release struct {
+	// Enabled releases all host objects of the plugin on startup and stops syncing
+	Enabled bool `json:"enabled,omitempty"`
+
+	// ArchiveNamespace is the host namespace the TLS secrets are moved to on release. Their
+	// Certificates are deleted, so they aren't renewed anymore. If empty, both are released in
+	// place.
+	ArchiveNamespace string `json:"archiveNamespace,omitempty"`
+}
+
+// Debug configures the debug endpoints
+type Debug struct {
+	// Enabled serves the debug endpoints. They aren't authenticated.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Address is the address the debug endpoints are served on. Defaults to localhost:8090,
+	// so they are only reachable from within the plugin pod.
+	Address string `json:"address,omitempty"`
+}
+
+const (
+	DefaultKeySealingSecretKey = "public-key"
+
+	DefaultNamingStrategy = "default"
+
+	DefaultDebugAddress = "localhost:8090"
+
+	DefaultConflictPolicy = "first-writer-wins"
+
+	DefaultDriftPolicy = DriftPolicyOverwrite
+
+	DefaultOrphanCollectionInterval    = 10 * time.Minute
+	DefaultOrphanCollectionGracePeriod = time.Hour
+	DefaultOrphanCollectionAction      = OrphanActionReport
+
+	DefaultConsistencyScanConfigMap = "cert-manager-plugin-consistency"
+	DefaultConsistencyScanNamespace = "kube-system"
+
+	DefaultWebhookHost          = "127.0.0.1"
+	DefaultWebhookPort          = 9445
+	DefaultWebhookFailurePolicy = "Ignore"
+)
+
+const (
+	// DriftPolicyOverwrite restores the translated virtual spec on the host
+	DriftPolicyOverwrite = "overwrite"
+
+	// DriftPolicyAlert reports the drift and keeps the host change
+	DriftPolicyAlert = "alert"
+
+	// DriftPolicyAdopt copies the host change back into the virtual spec
+	DriftPolicyAdopt = "adopt"
+)
+
+const (
+	OrphanActionReport = "report"
+	OrphanActionDelete = "delete"
+)
+
+// Load parses the plugin config and applies the defaults
+func Load() (*Config, error) {
+	cfg := &Config{}
+	err := plugin.UnmarshalConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Default()
+	return cfg, cfg.Validate()
+}
+
+// Default sets the default values for all unset options
+func (c *Config) Default() {
+	if c.KeySealing.SecretKey == "" {
+		c.KeySealing.SecretKey = DefaultKeySealingSecretKey
+	}
+	if c.Naming.Strategy == "" {
+		c.Naming.Strategy = DefaultNamingStrategy
+	}
+	if c.Debug.Address == "" {
+		c.Debug.Address = DefaultDebugAddress
+	}
+	if c.ConflictPolicy == "" {
+		c.ConflictPolicy = DefaultConflictPolicy
+	}
+	if c.DriftPolicy == "" {
+		c.DriftPolicy = DefaultDriftPolicy
+	}
+	if c.OrphanCollection.Interval.Duration == 0 {
+		c.OrphanCollection.Interval.Duration = DefaultOrphanCollectionInterval
+	}
+	if c.OrphanCollection.GracePeriod.Duration == 0 {
+		c.OrphanCollection.GracePeriod.Duration = DefaultOrphanCollectionGracePeriod
+	}
+	if c.OrphanCollection.Action == "" {
+		c.OrphanCollection.Action = DefaultOrphanCollectionAction
+	}
+	if c.ConsistencyScan.ConfigMap == "" {
+		c.ConsistencyScan.ConfigMap = DefaultConsistencyScanConfigMap
+	}
+	if c.ConsistencyScan.Namespace == "" {
+		c.ConsistencyScan.Namespace = DefaultConsistencyScanNamespace
+	}
+	if c.Webhook.Host == "" {
+		c.Webhook.Host = DefaultWebhookHost
+	}
+	if c.Webhook.Port == 0 {
+		c.Webhook.Port = DefaultWebhookPort
+	}
+	if c.Webhook.FailurePolicy == "" {
+		c.Webhook.FailurePolicy = DefaultWebhookFailurePolicy
+	}
+}
+
+// Validate checks if the config is valid
+func (c *Config) Validate() error {
+	if c.KeySealing.Enabled && c.KeySealing.SecretName == "" {
+		return fmt.Errorf("keySealing.secretName is required if key sealing is enabled")
+	}
+	if c.DriftPolicy != DriftPolicyOverwrite && c.DriftPolicy != DriftPolicyAlert && c.DriftPolicy != DriftPolicyAdopt {
+		return fmt.Errorf("unknown driftPolicy %q, expected overwrite, alert or adopt", c.DriftPolicy)
+	}
+	if c.OrphanCollection.Action != OrphanActionReport && c.OrphanCollection.Action != OrphanActionDelete {
+		return fmt.Errorf("unknown orphanCollection.action %q, expected report or delete", c.OrphanCollection.Action)
+	}
+	if c.OrphanCollection.Interval.Duration < 0 || c.OrphanCollection.GracePeriod.Duration < 0 {
+		return fmt.Errorf("orphanCollection.interval and orphanCollection.gracePeriod must not be negative")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(c.TrustBundles.Selector); err != nil {
+		return fmt.Errorf("invalid trustBundles.selector: %w", err)
+	}
+	if c.Webhook.FailurePolicy != "Ignore" && c.Webhook.FailurePolicy != "Fail" {
+		return fmt.Errorf("unknown webhook.failurePolicy %q, expected Ignore or Fail", c.Webhook.FailurePolicy)
+	}
+	if c.Webhook.Port < 1 || c.Webhook.Port > 65535 {
+		return fmt.Errorf("webhook.port %d is out of range", c.Webhook.Port)
+	}
+	if c.IstioGateways.Namespace != "" && !c.IstioGateways.Enabled {
+		return fmt.Errorf("istioGateways.namespace requires istioGateways.enabled")
+	}
+	if c.ConsistencyScan.Repair && !c.ConsistencyScan.Enabled {
+		return fmt.Errorf("consistencyScan.repair requires consistencyScan.enabled")
+	}
+	if (len(c.CertificateSigningRequests.ClusterIssuers) > 0 || c.CertificateSigningRequests.Approve) && !c.CertificateSigningRequests.Enabled {
+		return fmt.Errorf("certificateSigningRequests.clusterIssuers and certificateSigningRequests.approve require certificateSigningRequests.enabled")
+	}
+	if c.Importer.Enabled && c.Release.Enabled {
+		return fmt.Errorf("importer.enabled can't be combined with release.enabled, as nothing is synced in release mode")
+	}
+	if c.Release.ArchiveNamespace != "" && !c.Release.Enabled {
+		return fmt.Errorf("release.archiveNamespace requires release.enabled")
+	}
+
+	return nil
+}
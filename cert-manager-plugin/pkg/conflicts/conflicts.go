@@ -0,0 +1,232 @@
+// Package conflicts detects host objects that are owned by several virtual objects at
+// once, e.g. two Certificates that share a secretName, and resolves them by a policy.
+package conflicts
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PolicyRefuse stops syncing the host object and all of its owners while the conflict exists
+	PolicyRefuse = "refuse"
+
+	// PolicyFirstWriterWins lets the oldest owner keep the host object and stops syncing the others
+	PolicyFirstWriterWins = "first-writer-wins"
+
+	// PolicyShared lets all owners share the host object
+	PolicyShared = "shared"
+)
+
+// ReasonOwnershipConflict is the reason of the events that report a conflict
+const ReasonOwnershipConflict = "OwnershipConflict"
+
+// Resolver resolves conflicts between virtual objects that own the same host object
+type Resolver struct {
+	policy   string
+	registry *owners.Registry
+	recorder record.EventRecorder
+
+	m sync.Mutex
+
+	// reported holds the last reported owners of every conflicting host object, so that a
+	// conflict is only reported again if the owners change
+	reported map[string]string
+}
+
+// NewResolver creates a new resolver for the given policy
+func NewResolver(ctx *synccontext.RegisterContext, policy string, registry *owners.Registry) (*Resolver, error) {
+	switch policy {
+	case PolicyRefuse, PolicyFirstWriterWins, PolicyShared:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q", policy)
+	}
+
+	return &Resolver{
+		policy:   policy,
+		registry: registry,
+		recorder: ctx.VirtualManager.GetEventRecorderFor(constants.PluginName),
+		reported: map[string]string{},
+	}, nil
+}
+
+// Owner returns the owner the host object maps back to. If several virtual objects own the
+// host object, the conflict is reported and no owner is returned with the refuse policy.
+func (r *Resolver) Owner(hostKind string, pName types.NamespacedName) (owners.Owner, bool) {
+	all := r.registry.Owners(hostKind, pName)
+	if len(all) == 0 {
+		return owners.Owner{}, false
+	}
+
+	r.report(hostKind, pName, all)
+	if len(all) > 1 && r.policy == PolicyRefuse {
+		return owners.Owner{}, false
+	}
+
+	return all[0], true
+}
+
+// Refused checks if syncing the host object is refused because of a conflict
+func (r *Resolver) Refused(hostKind string, pName types.NamespacedName) bool {
+	if r.policy != PolicyRefuse {
+		return false
+	}
+
+	all := r.registry.Owners(hostKind, pName)
+	r.report(hostKind, pName, all)
+	return len(all) > 1
+}
+
+// Allowed checks if the virtual object may write the referenced host object. The virtual
+// object is treated as an owner even if the registry didn't observe it yet.
+func (r *Resolver) Allowed(ownerKind string, vObj client.Object, hostKind string, reference owners.Reference) bool {
+	self, all := r.owners(ownerKind, vObj, hostKind, reference)
+	r.report(hostKind, reference.Host, all)
+	return r.allowed(self, all)
+}
+
+// Denied returns why the virtual object may not write the referenced host object or an empty
+// string if it may. Unlike Allowed, the conflict isn't reported, so objects can be checked before
+// they're created. Objects that weren't created yet are treated as the newest owner.
+func (r *Resolver) Denied(ownerKind string, vObj client.Object, hostKind string, reference owners.Reference) string {
+	self, all := r.owners(ownerKind, vObj, hostKind, reference)
+	if r.allowed(self, all) {
+		return ""
+	}
+
+	others := []string{}
+	for _, owner := range all {
+		if owner.Kind != self.Kind || owner.Object != self.Object {
+			others = append(others, owner.Kind+" "+owner.Object.String())
+		}
+	}
+	return fmt.Sprintf("%s %s is referenced by %s already (policy %s)", strings.ToLower(hostKind), reference.Target, strings.Join(others, ", "), r.policy)
+}
+
+// owners returns the virtual object as owner and all owners of the referenced host object
+// including the virtual object
+func (r *Resolver) owners(ownerKind string, vObj client.Object, hostKind string, reference owners.Reference) (owners.Owner, []owners.Owner) {
+	self := owners.Owner{
+		Kind:              ownerKind,
+		Object:            types.NamespacedName{Namespace: vObj.GetNamespace(), Name: vObj.GetName()},
+		UID:               vObj.GetUID(),
+		Target:            reference.Target,
+		CreationTimestamp: vObj.GetCreationTimestamp(),
+	}
+	if self.CreationTimestamp.IsZero() {
+		self.CreationTimestamp = metav1.Now()
+	}
+
+	all := r.registry.Owners(hostKind, reference.Host)
+	for _, owner := range all {
+		if owner.Kind == self.Kind && owner.Object == self.Object {
+			return self, all
+		}
+	}
+
+	return self, owners.Sort(append(all, self))
+}
+
+func (r *Resolver) allowed(self owners.Owner, all []owners.Owner) bool {
+	if len(all) <= 1 {
+		return true
+	}
+
+	switch r.policy {
+	case PolicyShared:
+		return true
+	case PolicyFirstWriterWins:
+		return all[0].Kind == self.Kind && all[0].Object == self.Object
+	default:
+		return false
+	}
+}
+
+// report emits an event on every owner if the host object has more than one owner
+func (r *Resolver) report(hostKind string, pName types.NamespacedName, all []owners.Owner) {
+	key := hostKind + "/" + pName.String()
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if len(all) <= 1 {
+		delete(r.reported, key)
+		return
+	}
+
+	names := make([]string, 0, len(all))
+	for _, owner := range all {
+		names = append(names, owner.Kind+" "+owner.Object.String())
+	}
+	signature := strings.Join(names, ", ")
+	if r.reported[key] == signature {
+		return
+	}
+	r.reported[key] = signature
+
+	message := fmt.Sprintf("%s %s is referenced by %s: ", strings.ToLower(hostKind), all[0].Target, signature)
+	switch r.policy {
+	case PolicyRefuse:
+		message += "refusing to sync while the conflict exists (policy refuse)"
+	case PolicyFirstWriterWins:
+		message += fmt.Sprintf("%s is the owner as it was created first (policy first-writer-wins)", names[0])
+	case PolicyShared:
+		message += "all of them share it (policy shared)"
+	}
+
+	for _, owner := range all {
+		obj := objectFor(owner)
+		if obj == nil {
+			continue
+		}
+
+		r.recorder.Event(obj, corev1.EventTypeWarning, ReasonOwnershipConflict, message)
+	}
+}
+
+// routeGroupVersionKind is the kind of OpenShift Routes
+var routeGroupVersionKind = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// objectFor returns an object the event of an owner can be attached to
+func objectFor(owner owners.Owner) client.Object {
+	objectMeta := metav1.ObjectMeta{
+		Name:      owner.Object.Name,
+		Namespace: owner.Object.Namespace,
+		UID:       owner.UID,
+	}
+
+	switch owner.Kind {
+	case owners.KindCertificate:
+		return &certmanagerv1.Certificate{ObjectMeta: objectMeta}
+	case owners.KindIssuer:
+		return &certmanagerv1.Issuer{ObjectMeta: objectMeta}
+	case owners.KindIngress:
+		return &networkingv1.Ingress{ObjectMeta: objectMeta}
+	case owners.KindRoute:
+		// Routes are unstructured like certificates.NewRoute, which can't be used here as the
+		// certificates package imports this one
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(routeGroupVersionKind)
+		route.SetName(objectMeta.Name)
+		route.SetNamespace(objectMeta.Namespace)
+		route.SetUID(objectMeta.UID)
+		return route
+	case owners.KindSecret:
+		return &corev1.Secret{ObjectMeta: objectMeta}
+	}
+
+	return nil
+}
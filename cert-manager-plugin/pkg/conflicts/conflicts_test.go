@@ -0,0 +1,190 @@
+package conflicts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var hostSecret = types.NamespacedName{Namespace: "vcluster", Name: "web-tls-x-shop-x-vcluster"}
+
+var secretIndex = owners.Index{
+	OwnerKind: owners.KindCertificate,
+	HostKind:  owners.KindSecret,
+	References: func(obj client.Object) []owners.Reference {
+		return []owners.Reference{{
+			Host:   hostSecret,
+			Target: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.(*certmanagerv1.Certificate).Spec.SecretName},
+		}}
+	},
+}
+
+func newCertificate(name string, created time.Time) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "shop",
+			UID:               types.UID(name),
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: certmanagerv1.CertificateSpec{SecretName: "web-tls"},
+	}
+}
+
+func newResolver(t *testing.T, policy string, certificates ...*certmanagerv1.Certificate) (*Resolver, *record.FakeRecorder) {
+	t.Helper()
+
+	registry := owners.NewRegistry()
+	for _, certificate := range certificates {
+		registry.Update(secretIndex, certificate)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	return &Resolver{
+		policy:   policy,
+		registry: registry,
+		recorder: recorder,
+		reported: map[string]string{},
+	}, recorder
+}
+
+func reference(certificate *certmanagerv1.Certificate) owners.Reference {
+	return secretIndex.References(certificate)[0]
+}
+
+func TestPolicies(t *testing.T) {
+	now := time.Now()
+	first, second := newCertificate("first", now), newCertificate("second", now.Add(time.Minute))
+
+	tests := []struct {
+		policy string
+
+		owner         string
+		refused       bool
+		firstAllowed  bool
+		secondAllowed bool
+		message       string
+	}{
+		{
+			policy:        PolicyRefuse,
+			refused:       true,
+			firstAllowed:  false,
+			secondAllowed: false,
+			message:       "refusing to sync while the conflict exists",
+		},
+		{
+			policy:        PolicyFirstWriterWins,
+			owner:         "first",
+			firstAllowed:  true,
+			secondAllowed: false,
+			message:       "Certificate shop/first is the owner as it was created first",
+		},
+		{
+			policy:        PolicyShared,
+			owner:         "first",
+			firstAllowed:  true,
+			secondAllowed: true,
+			message:       "all of them share it",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			resolver, recorder := newResolver(t, test.policy, second, first)
+
+			owner, ok := resolver.Owner(owners.KindSecret, hostSecret)
+			if ok != (test.owner != "") || owner.Object.Name != test.owner {
+				t.Errorf("expected owner %q, got %q", test.owner, owner.Object.Name)
+			}
+			if refused := resolver.Refused(owners.KindSecret, hostSecret); refused != test.refused {
+				t.Errorf("expected refused %v, got %v", test.refused, refused)
+			}
+			if allowed := resolver.Allowed(owners.KindCertificate, first, owners.KindSecret, reference(first)); allowed != test.firstAllowed {
+				t.Errorf("expected first allowed %v, got %v", test.firstAllowed, allowed)
+			}
+			if allowed := resolver.Allowed(owners.KindCertificate, second, owners.KindSecret, reference(second)); allowed != test.secondAllowed {
+				t.Errorf("expected second allowed %v, got %v", test.secondAllowed, allowed)
+			}
+
+			denied := resolver.Denied(owners.KindCertificate, second, owners.KindSecret, reference(second))
+			if test.secondAllowed != (denied == "") {
+				t.Errorf("unexpected denial %q", denied)
+			} else if denied != "" && !strings.Contains(denied, "Certificate shop/first") {
+				t.Errorf("expected the denial to name the other owner, got %q", denied)
+			}
+
+			// the conflict is reported once on every owner
+			if len(recorder.Events) != 2 {
+				t.Fatalf("expected 2 events, got %d", len(recorder.Events))
+			}
+			for i := 0; i < 2; i++ {
+				event := <-recorder.Events
+				if !strings.Contains(event, ReasonOwnershipConflict) || !strings.Contains(event, test.message) {
+					t.Errorf("unexpected event %q", event)
+				}
+			}
+		})
+	}
+}
+
+func TestNoConflict(t *testing.T) {
+	for _, policy := range []string{PolicyRefuse, PolicyFirstWriterWins, PolicyShared} {
+		t.Run(policy, func(t *testing.T) {
+			certificate := newCertificate("web", time.Now())
+			resolver, recorder := newResolver(t, policy, certificate)
+
+			owner, ok := resolver.Owner(owners.KindSecret, hostSecret)
+			if !ok || owner.Object.Name != "web" {
+				t.Errorf("expected web to own the secret, got %v", owner)
+			}
+			if resolver.Refused(owners.KindSecret, hostSecret) {
+				t.Errorf("expected the secret not to be refused")
+			}
+			if !resolver.Allowed(owners.KindCertificate, certificate, owners.KindSecret, reference(certificate)) {
+				t.Errorf("expected the certificate to be allowed")
+			}
+			if len(recorder.Events) != 0 {
+				t.Errorf("expected no events, got %d", len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestDeniedBeforeCreation(t *testing.T) {
+	existing := newCertificate("web", time.Now())
+	resolver, recorder := newResolver(t, PolicyFirstWriterWins, existing)
+
+	// objects that weren't created yet are the newest owner
+	created := newCertificate("new", time.Time{})
+	denied := resolver.Denied(owners.KindCertificate, created, owners.KindSecret, reference(created))
+	if !strings.Contains(denied, "Certificate shop/web") || !strings.Contains(denied, "policy first-writer-wins") {
+		t.Errorf("unexpected denial %q", denied)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected denials not to be reported, got %d events", len(recorder.Events))
+	}
+}
+
+func TestObjectFor(t *testing.T) {
+	for _, kind := range []string{owners.KindCertificate, owners.KindIssuer, owners.KindIngress, owners.KindRoute, owners.KindSecret} {
+		obj := objectFor(owners.Owner{Kind: kind, Object: types.NamespacedName{Namespace: "shop", Name: "web"}, UID: "uid"})
+		if obj == nil {
+			t.Errorf("expected an object for owner kind %s", kind)
+			continue
+		}
+		if obj.GetName() != "web" || obj.GetNamespace() != "shop" || obj.GetUID() != "uid" {
+			t.Errorf("unexpected metadata of %s: %s/%s %s", kind, obj.GetNamespace(), obj.GetName(), obj.GetUID())
+		}
+	}
+
+	if route := objectFor(owners.Owner{Kind: owners.KindRoute}); route.GetObjectKind().GroupVersionKind() != routeGroupVersionKind {
+		t.Errorf("unexpected kind of route %v", route.GetObjectKind().GroupVersionKind())
+	}
+}
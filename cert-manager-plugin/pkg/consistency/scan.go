@@ -0,0 +1,447 @@
+// Package consistency implements the consistency scan on startup. The scan cross-checks every
+// virtual Certificate, Issuer and plugin controlled Secret against its host counterpart and
+// classifies each pair as in-sync, drifted, orphaned or conflicting. The report is written to a
+// config map in the virtual cluster, and drifted objects are repaired if configured.
+package consistency
+
+import (
+	"fmt"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/orphans"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// StateInSync means the host object matches the virtual object
+	StateInSync = "in-sync"
+
+	// StateDrifted means the host object differs from the virtual object
+	StateDrifted = "drifted"
+
+	// StateOrphaned means the virtual or the host object is missing its counterpart
+	StateOrphaned = "orphaned"
+
+	// StateConflicting means the host object belongs to another object
+	StateConflicting = "conflicting"
+)
+
+const (
+	// SummaryKey is the key of the report config map that holds the counts per state
+	SummaryKey = "summary"
+
+	// ReportKey is the key of the report config map that holds the entries
+	ReportKey = "report.yaml"
+)
+
+// Entry is the result for a virtual object and its host counterpart
+type Entry struct {
+	Kind     string `json:"kind"`
+	Virtual  string `json:"virtual,omitempty"`
+	Host     string `json:"host"`
+	State    string `json:"state"`
+	Reason   string `json:"reason,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// Report is the result of a scan
+type Report struct {
+	ScannedAt metav1.Time `json:"scannedAt"`
+	Entries   []Entry     `json:"entries"`
+}
+
+// Count returns the number of entries in the state
+func (r *Report) Count(state string) int {
+	count := 0
+	for _, entry := range r.Entries {
+		if entry.State == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Summary returns the counts per state
+func (r *Report) Summary() string {
+	repaired := 0
+	for _, entry := range r.Entries {
+		if entry.Repaired {
+			repaired++
+		}
+	}
+
+	return fmt.Sprintf("%d in-sync, %d drifted, %d orphaned, %d conflicting, %d repaired", r.Count(StateInSync), r.Count(StateDrifted), r.Count(StateOrphaned), r.Count(StateConflicting), repaired)
+}
+
+// Scanner runs the consistency scan
+type Scanner struct {
+	cfg        config.ConsistencyScan
+	keySealing bool
+	now        func() time.Time
+}
+
+// New creates a new scanner
+func New(cfg *config.Config) *Scanner {
+	return &Scanner{
+		cfg:        cfg.ConsistencyScan,
+		keySealing: cfg.KeySealing.Enabled,
+		now:        time.Now,
+	}
+}
+
+func (s *Scanner) Name() string {
+	return "consistency-scan"
+}
+
+var _ syncertypes.ControllerStarter = &Scanner{}
+
+// Register runs the scan once the caches are synced. A failed scan doesn't stop the plugin, as
+// the syncers converge anyways.
+func (s *Scanner) Register(ctx *synccontext.RegisterContext) error {
+	syncCtx := ctx.ToSyncContext("consistency-scan")
+	report, err := s.Scan(syncCtx)
+	if err != nil {
+		syncCtx.Log.Errorf("consistency scan: %v", err)
+		return nil
+	}
+
+	syncCtx.Log.Infof("consistency scan: %s", report.Summary())
+	return nil
+}
+
+// Scan classifies all virtual objects and their host counterparts and writes the report
+func (s *Scanner) Scan(ctx *synccontext.SyncContext) (*Report, error) {
+	report := &Report{ScannedAt: metav1.NewTime(s.now()), Entries: []Entry{}}
+	err := s.scanCertificates(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanIssuers(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanSecrets(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanHost(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, s.write(ctx, report)
+}
+
+func (s *Scanner) scanCertificates(ctx *synccontext.SyncContext, report *Report) error {
+	certificateList := &certmanagerv1.CertificateList{}
+	err := ctx.VirtualClient.List(ctx, certificateList)
+	if err != nil {
+		return fmt.Errorf("list virtual certificates: %w", err)
+	}
+
+	for i := range certificateList.Items {
+		vCertificate := &certificateList.Items[i]
+		pCertificate := &certmanagerv1.Certificate{}
+
+		// the ingress shim names host certificates after their secret
+		if vCertificate.Annotations[constants.BackwardSyncAnnotation] == "true" {
+			pName := naming.HostName(ctx, naming.Secret, vCertificate.Name, vCertificate.Namespace)
+			err = s.check(ctx, report, pair{kind: "certificate", vObj: vCertificate, pName: pName, pObj: pCertificate, backward: true})
+		} else {
+			pName := naming.HostName(ctx, naming.Certificate, vCertificate.Name, vCertificate.Namespace)
+			err = s.check(ctx, report, pair{
+				kind:  "certificate",
+				vObj:  vCertificate,
+				pName: pName,
+				pObj:  pCertificate,
+				inSync: func() bool {
+					return equality.Semantic.DeepEqual(pCertificate.Spec, *certificates.HostSpec(ctx, &vCertificate.Spec, vCertificate.Namespace))
+				},
+				repair: func() error {
+					pCertificate.Spec = *certificates.HostSpec(ctx, &vCertificate.Spec, vCertificate.Namespace)
+					return ctx.PhysicalClient.Update(ctx, pCertificate)
+				},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scanner) scanIssuers(ctx *synccontext.SyncContext, report *Report) error {
+	issuerList := &certmanagerv1.IssuerList{}
+	err := ctx.VirtualClient.List(ctx, issuerList)
+	if err != nil {
+		return fmt.Errorf("list virtual issuers: %w", err)
+	}
+
+	for i := range issuerList.Items {
+		vIssuer := &issuerList.Items[i]
+		pIssuer := &certmanagerv1.Issuer{}
+		err = s.check(ctx, report, pair{
+			kind:  "issuer",
+			vObj:  vIssuer,
+			pName: naming.HostName(ctx, naming.Issuer, vIssuer.Name, vIssuer.Namespace),
+			pObj:  pIssuer,
+			inSync: func() bool {
+				return equality.Semantic.DeepEqual(pIssuer.Spec, *issuers.HostSpec(ctx, &vIssuer.Spec, vIssuer.Namespace))
+			},
+			repair: func() error {
+				pIssuer.Spec = *issuers.HostSpec(ctx, &vIssuer.Spec, vIssuer.Namespace)
+				return ctx.PhysicalClient.Update(ctx, pIssuer)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanSecrets checks the virtual secrets the plugin controls. Secrets that are synced to the host
+// are repaired by updating the host data, backward synced secrets by deleting the virtual copy,
+// which the secret syncer then recreates from the host secret.
+func (s *Scanner) scanSecrets(ctx *synccontext.SyncContext, report *Report) error {
+	secretList := &corev1.SecretList{}
+	err := ctx.VirtualClient.List(ctx, secretList, client.MatchingLabels{translate.ControllerLabel: constants.PluginName})
+	if err != nil {
+		return fmt.Errorf("list virtual secrets: %w", err)
+	}
+
+	for i := range secretList.Items {
+		vSecret := &secretList.Items[i]
+		pSecret := &corev1.Secret{}
+		pName := naming.HostName(ctx, naming.Secret, vSecret.Name, vSecret.Namespace)
+		if vSecret.Annotations[constants.BackwardSyncAnnotation] == "true" {
+			err = s.check(ctx, report, pair{
+				kind:     "secret",
+				vObj:     vSecret,
+				pName:    pName,
+				pObj:     pSecret,
+				backward: true,
+				inSync: func() bool {
+					return secrets.BackwardDataInSync(pSecret, vSecret, s.keySealing)
+				},
+				repair: func() error {
+					return ctx.VirtualClient.Delete(ctx, vSecret)
+				},
+			})
+		} else {
+			err = s.check(ctx, report, pair{
+				kind:  "secret",
+				vObj:  vSecret,
+				pName: pName,
+				pObj:  pSecret,
+				inSync: func() bool {
+					return equality.Semantic.DeepEqual(pSecret.Data, vSecret.Data)
+				},
+				repair: func() error {
+					pSecret.Data = vSecret.Data
+					return ctx.PhysicalClient.Update(ctx, pSecret)
+				},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hostKinds are the kinds of host objects that are checked for missing virtual objects
+var hostKinds = []struct {
+	kind string
+	list func() client.ObjectList
+	obj  func() client.Object
+}{
+	{kind: "certificate", list: func() client.ObjectList { return &certmanagerv1.CertificateList{} }, obj: func() client.Object { return &certmanagerv1.Certificate{} }},
+	{kind: "issuer", list: func() client.ObjectList { return &certmanagerv1.IssuerList{} }, obj: func() client.Object { return &certmanagerv1.Issuer{} }},
+	{kind: "secret", list: func() client.ObjectList { return &corev1.SecretList{} }, obj: func() client.Object { return &corev1.Secret{} }},
+}
+
+// scanHost reports the host objects the plugin manages whose virtual objects are gone
+func (s *Scanner) scanHost(ctx *synccontext.SyncContext, report *Report) error {
+	checked := map[string]bool{}
+	for _, entry := range report.Entries {
+		checked[entry.Kind+" "+entry.Host] = true
+	}
+
+	for _, kind := range hostKinds {
+		list := kind.list()
+		err := ctx.PhysicalClient.List(ctx, list)
+		if err != nil {
+			return fmt.Errorf("list host %ss: %w", kind.kind, err)
+		}
+
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			pObj := obj.(client.Object)
+			if checked[kind.kind+" "+key(pObj)] || !orphans.Managed(ctx, pObj) {
+				continue
+			}
+
+			orphaned, err := orphans.Orphaned(ctx, pObj, kind.obj())
+			if err != nil {
+				return err
+			} else if !orphaned {
+				continue
+			}
+
+			annotations := pObj.GetAnnotations()
+			report.Entries = append(report.Entries, Entry{
+				Kind:    kind.kind,
+				Virtual: annotations[translate.NamespaceAnnotation] + "/" + annotations[translate.NameAnnotation],
+				Host:    key(pObj),
+				State:   StateOrphaned,
+				Reason:  "virtual object is missing",
+			})
+		}
+	}
+
+	return nil
+}
+
+// pair is a virtual object and the host object it's checked against
+type pair struct {
+	kind  string
+	vObj  client.Object
+	pName types.NamespacedName
+
+	// pObj is an empty object of the host kind that the host object is read into
+	pObj client.Object
+
+	// backward signals that the host object is the source of the virtual object, which isn't
+	// marked as managed by vcluster
+	backward bool
+
+	// inSync compares the objects and repair updates the drifted object. Both are nil if the
+	// objects only need to exist.
+	inSync func() bool
+	repair func() error
+}
+
+// check classifies the pair and adds it to the report
+func (s *Scanner) check(ctx *synccontext.SyncContext, report *Report, p pair) error {
+	entry := Entry{
+		Kind:    p.kind,
+		Virtual: key(p.vObj),
+		Host:    p.pName.String(),
+		State:   StateInSync,
+	}
+	defer func() {
+		report.Entries = append(report.Entries, entry)
+	}()
+
+	err := ctx.PhysicalClient.Get(ctx, p.pName, p.pObj)
+	if kerrors.IsNotFound(err) {
+		entry.State, entry.Reason = StateOrphaned, "host object is missing"
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get host %s %s: %w", p.kind, p.pName, err)
+	}
+
+	if !p.backward {
+		reason := Conflict(p.vObj, p.pObj)
+		if reason != "" {
+			entry.State, entry.Reason = StateConflicting, reason
+			return nil
+		}
+	}
+	if p.inSync == nil || p.inSync() {
+		return nil
+	}
+
+	entry.State, entry.Reason = StateDrifted, "host object differs from virtual object"
+	if !s.cfg.Repair {
+		return nil
+	}
+
+	// the syncers run concurrently and might have repaired the object in the meantime, so a
+	// failed repair is only reported
+	ctx.Log.Infof("repair drifted %s %s", p.kind, entry.Virtual)
+	err = p.repair()
+	if err != nil {
+		ctx.Log.Errorf("repair %s %s: %v", p.kind, entry.Virtual, err)
+		entry.Reason += fmt.Sprintf(", repair failed: %v", err)
+		return nil
+	}
+
+	entry.Repaired = true
+	return nil
+}
+
+// Conflict returns why the host object doesn't belong to the virtual object or an empty string
+// if it does
+func Conflict(vObj, pObj client.Object) string {
+	annotations := pObj.GetAnnotations()
+	vNamespace, vName := annotations[translate.NamespaceAnnotation], annotations[translate.NameAnnotation]
+	if vName == "" {
+		return "host object isn't managed by vcluster"
+	} else if vName != vObj.GetName() || vNamespace != vObj.GetNamespace() {
+		return "host object belongs to virtual object " + vNamespace + "/" + vName
+	}
+
+	uid := annotations[translate.UIDAnnotation]
+	if uid != "" && uid != string(vObj.GetUID()) {
+		return "host object belongs to a former virtual object with the same name"
+	}
+
+	return ""
+}
+
+// write creates or updates the report config map
+func (s *Scanner) write(ctx *synccontext.SyncContext, report *Report) error {
+	out, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{
+		SummaryKey: report.Summary(),
+		ReportKey:  string(out),
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: s.cfg.Namespace, Name: s.cfg.ConfigMap}, configMap)
+	if kerrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.cfg.Namespace, Name: s.cfg.ConfigMap},
+			Data:       data,
+		}
+		return ctx.VirtualClient.Create(ctx, configMap)
+	} else if err != nil {
+		return fmt.Errorf("get report config map %s/%s: %w", s.cfg.Namespace, s.cfg.ConfigMap, err)
+	}
+
+	configMap.Data = data
+	return ctx.VirtualClient.Update(ctx, configMap)
+}
+
+func key(obj client.Object) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
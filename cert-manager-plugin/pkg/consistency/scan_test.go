@@ -0,0 +1,192 @@
+package consistency
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const virtualNamespace = "shop"
+
+func newScanner(repair bool) *Scanner {
+	cfg := &config.Config{ConsistencyScan: config.ConsistencyScan{Enabled: true, Repair: repair}}
+	cfg.Default()
+
+	scanner := New(cfg)
+	scanner.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return scanner
+}
+
+// newCertificate returns a virtual certificate and the host certificate the plugin created for it
+func newCertificate(name string) (*certmanagerv1.Certificate, *certmanagerv1.Certificate) {
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: virtualNamespace, UID: types.UID("uid-" + name)},
+		Spec: certmanagerv1.CertificateSpec{
+			CommonName: name + ".example.com",
+			SecretName: name + "-tls",
+			IssuerRef:  cmmeta.ObjectReference{Kind: "ClusterIssuer", Name: "letsencrypt"},
+		},
+	}
+	pCertificate := translate.HostMetadata(vCertificate, naming.HostName(nil, naming.Certificate, name, virtualNamespace))
+	pCertificate.Spec.SecretName = naming.HostName(nil, naming.Secret, vCertificate.Spec.SecretName, virtualNamespace).Name
+	return vCertificate, pCertificate
+}
+
+// newObjects returns virtual and host objects that cover every state
+func newObjects() ([]runtime.Object, []runtime.Object) {
+	inSync, pInSync := newCertificate("web")
+
+	drifted, pDrifted := newCertificate("api")
+	pDrifted.Spec.CommonName = "changed.example.com"
+
+	// the host certificate was created for a former virtual certificate with the same name
+	conflicting, pConflicting := newCertificate("admin")
+	conflicting.UID = "recreated"
+
+	// the host issuer is missing
+	vIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: virtualNamespace},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			SelfSigned: &certmanagerv1.SelfSignedIssuer{},
+		}},
+	}
+
+	// the virtual issuer is missing
+	gone := &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: virtualNamespace}}
+	pGone := translate.HostMetadata(gone, naming.HostName(nil, naming.Issuer, gone.Name, virtualNamespace))
+
+	// the backward synced secret holds outdated data
+	vSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web-tls",
+			Namespace:   virtualNamespace,
+			Labels:      map[string]string{translate.ControllerLabel: constants.PluginName},
+			Annotations: map[string]string{constants.BackwardSyncAnnotation: "true"},
+		},
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("expired")},
+	}
+	pSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: pInSync.Spec.SecretName, Namespace: pInSync.Namespace},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("renewed")},
+	}
+
+	// vcluster synced the secret of a pod whose virtual secret is gone, so it's not the plugin's
+	podSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db-password", Namespace: virtualNamespace}}
+	pPodSecret := translate.HostMetadata(podSecret, naming.HostName(nil, naming.Secret, podSecret.Name, virtualNamespace))
+
+	return []runtime.Object{inSync, drifted, conflicting, vIssuer, vSecret}, []runtime.Object{pInSync, pDrifted, pConflicting, pGone, pSecret, pPodSecret}
+}
+
+func entryOf(t *testing.T, report *Report, kind, virtual string) Entry {
+	t.Helper()
+
+	for _, entry := range report.Entries {
+		if entry.Kind == kind && entry.Virtual == virtual {
+			return entry
+		}
+	}
+
+	t.Fatalf("no entry for %s %s in %v", kind, virtual, report.Entries)
+	return Entry{}
+}
+
+func TestScan(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vObjs, pObjs := newObjects()
+	ctx := fixtures.NewSyncContext(vObjs, pObjs)
+
+	report, err := newScanner(false).Scan(ctx)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	expected := map[string]string{
+		"certificate shop/web":   StateInSync,
+		"certificate shop/api":   StateDrifted,
+		"certificate shop/admin": StateConflicting,
+		"issuer shop/vault":      StateOrphaned,
+		"issuer shop/gone":       StateOrphaned,
+		"secret shop/web-tls":    StateDrifted,
+	}
+	for name, state := range expected {
+		kind, virtual, _ := strings.Cut(name, " ")
+		entry := entryOf(t, report, kind, virtual)
+		if entry.State != state || entry.Repaired {
+			t.Errorf("expected %s to be %s and not repaired, got %+v", name, state, entry)
+		}
+	}
+	if len(report.Entries) != len(expected) {
+		t.Errorf("expected %d entries, got %v", len(expected), report.Entries)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: config.DefaultConsistencyScanNamespace, Name: config.DefaultConsistencyScanConfigMap}, configMap)
+	if err != nil {
+		t.Fatalf("get report config map: %v", err)
+	}
+	if summary := configMap.Data[SummaryKey]; summary != "1 in-sync, 2 drifted, 2 orphaned, 1 conflicting, 0 repaired" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	if !strings.Contains(configMap.Data[ReportKey], "host object differs from virtual object") {
+		t.Errorf("expected the report to list the entries, got %q", configMap.Data[ReportKey])
+	}
+
+	// a second scan updates the report
+	_, err = newScanner(false).Scan(ctx)
+	if err != nil {
+		t.Fatalf("scan again: %v", err)
+	}
+}
+
+func TestScanRepairsDrift(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vObjs, pObjs := newObjects()
+	ctx := fixtures.NewSyncContext(vObjs, pObjs)
+
+	report, err := newScanner(true).Scan(ctx)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	for _, name := range []string{"certificate shop/api", "secret shop/web-tls"} {
+		kind, virtual, _ := strings.Cut(name, " ")
+		if entry := entryOf(t, report, kind, virtual); !entry.Repaired {
+			t.Errorf("expected %s to be repaired, got %+v", name, entry)
+		}
+	}
+
+	pCertificate := &certmanagerv1.Certificate{}
+	err = ctx.PhysicalClient.Get(ctx, client.ObjectKeyFromObject(pObjs[1].(client.Object)), pCertificate)
+	if err != nil {
+		t.Fatalf("get host certificate: %v", err)
+	}
+	if pCertificate.Spec.CommonName != "api.example.com" {
+		t.Errorf("expected the host certificate spec to be repaired, got %+v", pCertificate.Spec)
+	}
+
+	// the secret syncer recreates the virtual copy from the host secret
+	err = ctx.VirtualClient.Get(ctx, client.ObjectKeyFromObject(vObjs[4].(client.Object)), &corev1.Secret{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected the outdated virtual secret to be deleted, got %v", err)
+	}
+
+	// conflicting objects are left alone
+	pConflicting := &certmanagerv1.Certificate{}
+	err = ctx.PhysicalClient.Get(ctx, client.ObjectKeyFromObject(pObjs[2].(client.Object)), pConflicting)
+	if err != nil {
+		t.Errorf("expected the conflicting host certificate to be kept, got %v", err)
+	}
+}
@@ -5,6 +5,66 @@ const (
 
 	BackwardSyncAnnotation = "cert-manager.vcluster.loft.sh/sync-backward"
 
+	// HostDataHashAnnotation holds the hash of the host secret data on virtual secrets that
+	// don't contain a verbatim copy of the host data
+	HostDataHashAnnotation = "cert-manager.vcluster.loft.sh/host-data-hash"
+
+	// SpecHashAnnotation holds the hash of the spec the plugin last wrote on host Certificates,
+	// so that changes made directly on the host can be told apart from virtual changes
+	SpecHashAnnotation = "cert-manager.vcluster.loft.sh/spec-hash"
+
+	// DriftAlertedHashAnnotation holds the hash of the drifted host spec the plugin last reported
+	// on host Certificates whose drift is kept, so that a drift is only reported once
+	DriftAlertedHashAnnotation = "cert-manager.vcluster.loft.sh/drift-alerted-hash"
+
+	// RenewRequestedAtAnnotation requests the renewal of a virtual Certificate, e.g. with the
+	// current time as value. Every new value triggers a renewal of the host Certificate.
+	RenewRequestedAtAnnotation = "cert-manager.vcluster.loft.sh/renew-requested-at"
+
+	// RenewalForwardedAnnotation holds the transition time of the last manual renewal on host
+	// Certificates, so that renewal requests are forwarded only once
+	RenewalForwardedAnnotation = "cert-manager.vcluster.loft.sh/renewal-forwarded"
+
+	// ImportAnnotation marks a host Certificate or Issuer that was created outside of the
+	// virtual cluster for import. The value is the virtual namespace to import it into.
+	ImportAnnotation = "cert-manager.vcluster.loft.sh/import"
+
+	// ImportedFromAnnotation holds the original host namespace and name of imported objects
+	ImportedFromAnnotation = "cert-manager.vcluster.loft.sh/imported-from"
+
+	// ReleasedFromAnnotation holds the virtual namespace and name of the object a released host
+	// object belonged to
+	ReleasedFromAnnotation = "cert-manager.vcluster.loft.sh/released-from"
+
+	// VClusterLabel and VirtualNamespaceLabel identify the vcluster and the virtual namespace of
+	// host Certificates. cert-manager copies them onto the CertificateRequests, so that policies
+	// can tell the tenants apart.
+	VClusterLabel         = "cert-manager.vcluster.loft.sh/vcluster"
+	VirtualNamespaceLabel = "cert-manager.vcluster.loft.sh/virtual-namespace"
+
+	// GatewaySecretOfAnnotation holds the virtual namespace and name of the secret a copy in the
+	// namespace of the Istio ingress gateway was made of
+	GatewaySecretOfAnnotation = "cert-manager.vcluster.loft.sh/gateway-secret-of"
+
+	// BundleLabel marks the virtual copies of trust-manager Bundle targets. The value is the
+	// name of the Bundle.
+	BundleLabel = "cert-manager.vcluster.loft.sh/bundle"
+
 	IssuerAnnotation        = "cert-manager.io/issuer"
 	ClusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+
+	// IssuerNameAnnotation, IssuerKindAnnotation and IssuerGroupAnnotation select the issuer of
+	// OpenShift Routes for cert-manager's route integration
+	IssuerNameAnnotation  = "cert-manager.io/issuer-name"
+	IssuerKindAnnotation  = "cert-manager.io/issuer-kind"
+	IssuerGroupAnnotation = "cert-manager.io/issuer-group"
+
+	// InjectCAFromAnnotation, InjectCAFromSecretAnnotation and InjectAPIServerCAAnnotation
+	// request the injection of a CA bundle into webhooks, CRDs and APIServices
+	InjectCAFromAnnotation       = "cert-manager.io/inject-ca-from"
+	InjectCAFromSecretAnnotation = "cert-manager.io/inject-ca-from-secret"
+	InjectAPIServerCAAnnotation  = "cert-manager.io/inject-apiserver-ca"
+
+	// AllowDirectInjectionAnnotation allows a secret to be used with InjectCAFromSecretAnnotation
+	AllowDirectInjectionAnnotation = "cert-manager.io/allow-direct-injection"
 )
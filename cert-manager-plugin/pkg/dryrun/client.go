@@ -0,0 +1,108 @@
+package dryrun
+
+import (
+	"context"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewClient wraps the client, so that writes are recorded instead of applied
+func NewClient(c client.Client, cluster Cluster, recorder *Recorder) client.Client {
+	return &dryRunClient{
+		Client:   c,
+		cluster:  cluster,
+		recorder: recorder,
+	}
+}
+
+type dryRunClient struct {
+	client.Client
+
+	cluster  Cluster
+	recorder *Recorder
+}
+
+func (c *dryRunClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	c.recorder.Record(c.cluster, "create", nil, obj)
+	return nil
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	c.recorder.Record(c.cluster, "update", c.current(ctx, obj), obj)
+	return nil
+}
+
+func (c *dryRunClient) Patch(_ context.Context, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	c.recorder.RecordPatch(c.cluster, "patch", obj, data)
+	return nil
+}
+
+func (c *dryRunClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	c.recorder.RecordPatch(c.cluster, "delete", obj, []byte("null"))
+	return nil
+}
+
+func (c *dryRunClient) DeleteAllOf(_ context.Context, obj client.Object, _ ...client.DeleteAllOfOption) error {
+	c.recorder.RecordPatch(c.cluster, "delete all", obj, []byte("null"))
+	return nil
+}
+
+func (c *dryRunClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *dryRunClient) SubResource(subResource string) client.SubResourceClient {
+	return &dryRunSubResourceClient{
+		SubResourceClient: c.Client.SubResource(subResource),
+		client:            c,
+		subResource:       subResource,
+	}
+}
+
+// current returns the current state of the object or nil if it doesn't exist
+func (c *dryRunClient) current(ctx context.Context, obj client.Object) client.Object {
+	current := obj.DeepCopyObject().(client.Object)
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		c.recorder.log.Errorf("get current state of %s: %v", c.recorder.describe(obj), err)
+		return nil
+	}
+
+	return current
+}
+
+// dryRunSubResourceClient records writes of sub resources, e.g. the status
+type dryRunSubResourceClient struct {
+	client.SubResourceClient
+
+	client      *dryRunClient
+	subResource string
+}
+
+func (c *dryRunSubResourceClient) Create(_ context.Context, _ client.Object, subResource client.Object, _ ...client.SubResourceCreateOption) error {
+	c.client.recorder.Record(c.client.cluster, "create "+c.subResource, nil, subResource)
+	return nil
+}
+
+func (c *dryRunSubResourceClient) Update(ctx context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	c.client.recorder.Record(c.client.cluster, "update "+c.subResource, c.client.current(ctx, obj), obj)
+	return nil
+}
+
+func (c *dryRunSubResourceClient) Patch(_ context.Context, obj client.Object, patch client.Patch, _ ...client.SubResourcePatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	c.client.recorder.RecordPatch(c.client.cluster, "patch "+c.subResource, obj, data)
+	return nil
+}
@@ -0,0 +1,168 @@
+package dryrun
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	// registers the cert-manager types in the scheme
+	_ "github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newClient(objs ...runtime.Object) (client.Client, client.Client, *record.FakeRecorder) {
+	events := record.NewFakeRecorder(10)
+	underlying := testingutil.NewFakeClient(scheme.Scheme, objs...)
+	return NewClient(underlying, Host, NewRecorder(nil, events, scheme.Scheme)), underlying, events
+}
+
+// expectEvent returns the next recorded event or fails if there is none
+func expectEvent(t *testing.T, events *record.FakeRecorder) string {
+	t.Helper()
+
+	select {
+	case event := <-events.Events:
+		return event
+	default:
+		t.Fatal("expected a dry-run event")
+		return ""
+	}
+}
+
+func expectNoEvent(t *testing.T, events *record.FakeRecorder) {
+	t.Helper()
+
+	select {
+	case event := <-events.Events:
+		t.Fatalf("expected no dry-run event, got %q", event)
+	default:
+	}
+}
+
+func TestCreateIsRecorded(t *testing.T) {
+	ctx := context.Background()
+	dryRunClient, underlying, events := newClient()
+
+	certificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "vcluster"},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: "web-tls"},
+	}
+	err := dryRunClient.Create(ctx, certificate)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	err = underlying.Get(ctx, client.ObjectKeyFromObject(certificate), &certmanagerv1.Certificate{})
+	if err == nil {
+		t.Errorf("expected the certificate not to be created")
+	}
+	if event := expectEvent(t, events); !strings.Contains(event, ReasonDryRun) || !strings.Contains(event, "create of Certificate vcluster/web") || !strings.Contains(event, `"secretName":"web-tls"`) {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestUpdateIsRecordedAsDiff(t *testing.T) {
+	ctx := context.Background()
+	certificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "vcluster"},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: "web-tls",
+			IssuerRef:  cmmeta.ObjectReference{Name: "selfsigned", Kind: "Issuer"},
+		},
+	}
+	dryRunClient, underlying, events := newClient(certificate.DeepCopy())
+
+	// reads are passed through
+	updated := &certmanagerv1.Certificate{}
+	err := dryRunClient.Get(ctx, client.ObjectKeyFromObject(certificate), updated)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	// an update without changes isn't recorded
+	err = dryRunClient.Update(ctx, updated.DeepCopy())
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	expectNoEvent(t, events)
+
+	updated.Spec.IssuerRef.Name = "letsencrypt"
+	err = dryRunClient.Update(ctx, updated)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	current := &certmanagerv1.Certificate{}
+	err = underlying.Get(ctx, client.ObjectKeyFromObject(certificate), current)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	} else if current.Spec.IssuerRef.Name != "selfsigned" {
+		t.Errorf("expected the certificate not to be updated, got issuer %s", current.Spec.IssuerRef.Name)
+	}
+
+	event := expectEvent(t, events)
+	if !strings.Contains(event, `{"spec":{"issuerRef":{"name":"letsencrypt"}}}`) {
+		t.Errorf("expected event to hold the merge patch, got %q", event)
+	}
+}
+
+func TestStatusUpdateAndDeleteAreRecorded(t *testing.T) {
+	ctx := context.Background()
+	certificate := &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "vcluster"}}
+	dryRunClient, underlying, events := newClient(certificate.DeepCopy())
+
+	updated := certificate.DeepCopy()
+	updated.Status.Conditions = []certmanagerv1.CertificateCondition{{Type: certmanagerv1.CertificateConditionReady, Status: cmmeta.ConditionTrue}}
+	err := dryRunClient.Status().Update(ctx, updated)
+	if err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	if event := expectEvent(t, events); !strings.Contains(event, "update status of Certificate vcluster/web") {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	err = dryRunClient.Delete(ctx, certificate)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if event := expectEvent(t, events); !strings.Contains(event, "delete of Certificate vcluster/web") {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	current := &certmanagerv1.Certificate{}
+	err = underlying.Get(ctx, client.ObjectKeyFromObject(certificate), current)
+	if err != nil {
+		t.Fatalf("expected the certificate not to be deleted: %v", err)
+	} else if len(current.Status.Conditions) != 0 {
+		t.Errorf("expected the certificate status not to be updated")
+	}
+}
+
+func TestSecretDataIsRedacted(t *testing.T) {
+	ctx := context.Background()
+	dryRunClient, _, events := newClient()
+
+	err := dryRunClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-tls", Namespace: "vcluster"},
+		Data:       map[string][]byte{corev1.TLSPrivateKeyKey: []byte("private-key")},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	event := expectEvent(t, events)
+	if !strings.Contains(event, `"tls.key":"<redacted>"`) {
+		t.Errorf("expected the secret data to be redacted, got %q", event)
+	}
+	if strings.Contains(event, "cHJpdmF0ZS1rZXk=") {
+		t.Errorf("event leaks the secret data: %q", event)
+	}
+}
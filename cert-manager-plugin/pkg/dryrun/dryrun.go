@@ -0,0 +1,152 @@
+// Package dryrun implements the dry-run mode of the plugin. In dry-run mode the clients the
+// syncers and the ingress hook write with don't apply any writes. Instead every write is
+// recorded as a JSON merge patch in the logs and as an event on the written object. Reads and
+// index lookups are passed through, so the syncers behave as usual otherwise.
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/loghelper"
+	"github.com/loft-sh/vcluster/pkg/util/patch"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ReasonDryRun is the reason of the events that record skipped writes
+const ReasonDryRun = "DryRun"
+
+// maxEventDiff is the length diffs are cut to within event messages. The logs always hold the
+// full diff.
+const maxEventDiff = 768
+
+// Cluster is the cluster a write goes to
+type Cluster string
+
+const (
+	Host    Cluster = "host"
+	Virtual Cluster = "virtual"
+)
+
+// Recorder records the writes that are skipped in dry-run mode
+type Recorder struct {
+	log    loghelper.Logger
+	scheme *runtime.Scheme
+
+	events map[Cluster]record.EventRecorder
+}
+
+// NewRecorder creates a recorder that emits events with the recorders of the clusters
+func NewRecorder(virtualEvents, hostEvents record.EventRecorder, scheme *runtime.Scheme) *Recorder {
+	return &Recorder{
+		log:    loghelper.New("dry-run"),
+		scheme: scheme,
+		events: map[Cluster]record.EventRecorder{
+			Virtual: virtualEvents,
+			Host:    hostEvents,
+		},
+	}
+}
+
+// Enable switches the register context into dry-run mode. The managers of the context are
+// replaced by managers whose clients record writes instead of applying them, so it has to be
+// called before the syncers are created.
+func Enable(ctx *synccontext.RegisterContext) *Recorder {
+	recorder := NewRecorder(
+		ctx.VirtualManager.GetEventRecorderFor(constants.PluginName),
+		ctx.PhysicalManager.GetEventRecorderFor(constants.PluginName),
+		ctx.VirtualManager.GetScheme(),
+	)
+
+	ctx.VirtualManager = WrapManager(ctx.VirtualManager, Virtual, recorder)
+	ctx.PhysicalManager = WrapManager(ctx.PhysicalManager, Host, recorder)
+	if ctx.CurrentNamespaceClient != nil {
+		ctx.CurrentNamespaceClient = NewClient(ctx.CurrentNamespaceClient, Host, recorder)
+	}
+
+	recorder.log.Infof("dry-run mode is enabled, writes to the host and the virtual cluster are recorded but not applied")
+	return recorder
+}
+
+// Record records the write of after. before is the current state of the object or nil if the
+// write creates it. Writes that don't change anything are not recorded.
+func (r *Recorder) Record(cluster Cluster, verb string, before, after client.Object) {
+	var (
+		diff patch.Patch
+		err  error
+	)
+	if before == nil {
+		diff, err = patch.ConvertObjectToPatch(after)
+	} else {
+		diff, err = patch.CalculateMergePatch(before, after)
+	}
+	if err != nil {
+		r.log.Errorf("calculate dry-run diff of %s %s: %v", verb, r.describe(after), err)
+		return
+	} else if before != nil && diff.IsEmpty() {
+		return
+	}
+
+	if _, ok := after.(*corev1.Secret); ok {
+		redact(diff)
+	}
+
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(diff)
+	if err != nil {
+		r.log.Errorf("marshal dry-run diff of %s %s: %v", verb, r.describe(after), err)
+		return
+	}
+
+	r.RecordPatch(cluster, verb, after, bytes.TrimSpace(out.Bytes()))
+}
+
+// RecordPatch records a write of obj that is described by the patch
+func (r *Recorder) RecordPatch(cluster Cluster, verb string, obj client.Object, diff []byte) {
+	r.log.Base().Info("skipped write in dry-run mode", "cluster", string(cluster), "verb", verb, "object", r.describe(obj), "diff", string(diff))
+
+	message := string(diff)
+	if len(message) > maxEventDiff {
+		message = message[:maxEventDiff] + "..."
+	}
+	if events := r.events[cluster]; events != nil {
+		events.Eventf(obj, corev1.EventTypeNormal, ReasonDryRun, "Skipped %s of %s in %s cluster: %s", verb, r.describe(obj), cluster, message)
+	}
+}
+
+func (r *Recorder) describe(obj client.Object) string {
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, r.scheme); err == nil {
+		kind = gvk.Kind
+	}
+	if obj.GetNamespace() == "" {
+		return kind + " " + obj.GetName()
+	}
+
+	return kind + " " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// redact hides the values of secret data, only the keys are kept
+func redact(diff patch.Patch) {
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := diff[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for key, value := range data {
+			if value != nil {
+				data[key] = "<redacted>"
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package dryrun
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WrapManager wraps the manager, so that its client records writes instead of applying them.
+// The cache, the field indexer and the api reader of the manager are left untouched.
+func WrapManager(manager ctrl.Manager, cluster Cluster, recorder *Recorder) ctrl.Manager {
+	return &dryRunManager{
+		Manager: manager,
+		client:  NewClient(manager.GetClient(), cluster, recorder),
+	}
+}
+
+type dryRunManager struct {
+	ctrl.Manager
+
+	client client.Client
+}
+
+func (m *dryRunManager) GetClient() client.Client {
+	return m.client
+}
@@ -0,0 +1,110 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/approverpolicy"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/dryrun"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/istio"
+	"github.com/nirvati/vcluster-sdk/plugin"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewGatewayHook creates the hook that rewrites the credentialNames of Istio Gateways that
+// reference the secrets of virtual Certificates. If the dry-run recorder is set, the rewrites are
+// recorded instead of applied.
+func NewGatewayHook(ctx *synccontext.RegisterContext, cfg config.IstioGateways, dryRun *dryrun.Recorder) plugin.ClientHook {
+	return &gatewayHook{
+		virtualClient: ctx.VirtualManager.GetClient(),
+		namespace:     cfg.Namespace,
+		dryRun:        dryRun,
+	}
+}
+
+type gatewayHook struct {
+	virtualClient client.Client
+	namespace     string
+	dryRun        *dryrun.Recorder
+}
+
+func (p *gatewayHook) Name() string {
+	return "gateway-hook-cert-manager"
+}
+
+func (p *gatewayHook) Resource() client.Object {
+	return istio.NewGateway()
+}
+
+var _ plugin.MutateCreatePhysical = &gatewayHook{}
+
+func (p *gatewayHook) MutateCreatePhysical(ctx context.Context, obj client.Object) (client.Object, error) {
+	gateway, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not a gateway", obj)
+	}
+
+	return p.mutate(ctx, gateway, "mutate create")
+}
+
+var _ plugin.MutateUpdatePhysical = &gatewayHook{}
+
+func (p *gatewayHook) MutateUpdatePhysical(ctx context.Context, obj client.Object) (client.Object, error) {
+	gateway, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not a gateway", obj)
+	}
+
+	return p.mutate(ctx, gateway, "mutate update")
+}
+
+func (p *gatewayHook) mutate(ctx context.Context, gateway *unstructured.Unstructured, verb string) (*unstructured.Unstructured, error) {
+	if p.dryRun == nil {
+		return gateway, p.mutateGateway(ctx, gateway)
+	}
+
+	mutated := gateway.DeepCopy()
+	err := p.mutateGateway(ctx, mutated)
+	if err != nil {
+		return nil, err
+	}
+	p.dryRun.Record(dryrun.Host, verb, gateway, mutated)
+	return gateway, nil
+}
+
+// mutateGateway labels the gateway with its tenant and rewrites the credentialNames that
+// reference the secret of a virtual Certificate to the host secret or its copy in the namespace
+// of the ingress gateway. Other credentialNames are kept.
+func (p *gatewayHook) mutateGateway(ctx context.Context, gateway *unstructured.Unstructured) error {
+	vNamespace := gateway.GetAnnotations()[translate.NamespaceAnnotation]
+	if vNamespace == "" {
+		return nil
+	}
+	gateway.SetLabels(approverpolicy.AddLabels(gateway.GetLabels(), vNamespace))
+
+	credentialNames := map[string]string{}
+	for _, name := range istio.CredentialNames(gateway) {
+		vName := types.NamespacedName{Namespace: vNamespace, Name: name}
+		certificateSecret, err := istio.CertificateSecret(ctx, p.virtualClient, vName)
+		if err != nil {
+			return err
+		} else if certificateSecret {
+			credentialNames[name] = istio.CredentialName(nil, vName, p.namespace)
+		}
+	}
+	if len(credentialNames) == 0 {
+		return nil
+	}
+
+	return istio.SetCredentialNames(gateway, func(name string) string {
+		if credentialName, ok := credentialNames[name]; ok {
+			return credentialName
+		}
+		return name
+	})
+}
@@ -5,17 +5,26 @@ import (
 	"fmt"
 
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/approverpolicy"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/dryrun"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
 	"github.com/nirvati/vcluster-sdk/plugin"
 	networkingv1 "k8s.io/api/networking/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func NewIngressHook() plugin.ClientHook {
-	return &ingressHook{}
+// NewIngressHook creates the hook that rewrites the issuer annotations of ingresses. If the
+// dry-run recorder is set, the rewrites are recorded instead of applied.
+func NewIngressHook(dryRun *dryrun.Recorder) plugin.ClientHook {
+	return &ingressHook{
+		dryRun: dryRun,
+	}
 }
 
-type ingressHook struct{}
+type ingressHook struct {
+	dryRun *dryrun.Recorder
+}
 
 func (p *ingressHook) Name() string {
 	return "ingress-hook-cert-manager"
@@ -33,8 +42,7 @@ func (p *ingressHook) MutateCreatePhysical(ctx context.Context, obj client.Objec
 		return nil, fmt.Errorf("object %v is not an ingress", obj)
 	}
 
-	mutateIngress(ingress)
-	return ingress, nil
+	return p.mutate(ingress, "mutate create"), nil
 }
 
 var _ plugin.MutateUpdatePhysical = &ingressHook{}
@@ -45,12 +53,29 @@ func (p *ingressHook) MutateUpdatePhysical(ctx context.Context, obj client.Objec
 		return nil, fmt.Errorf("object %v is not an ingress", obj)
 	}
 
-	mutateIngress(ingress)
-	return ingress, nil
+	return p.mutate(ingress, "mutate update"), nil
 }
 
+func (p *ingressHook) mutate(ingress *networkingv1.Ingress, verb string) *networkingv1.Ingress {
+	if p.dryRun == nil {
+		mutateIngress(ingress)
+		return ingress
+	}
+
+	mutated := ingress.DeepCopy()
+	mutateIngress(mutated)
+	p.dryRun.Record(dryrun.Host, verb, ingress, mutated)
+	return ingress
+}
+
+// mutateIngress rewrites the issuer and labels the ingress with its tenant, since the ingress
+// shim copies the labels of the ingress onto the certificate it creates
 func mutateIngress(ingress *networkingv1.Ingress) {
+	vNamespace := ingress.Annotations[translate.NamespaceAnnotation]
+	if vNamespace != "" {
+		ingress.Labels = approverpolicy.AddLabels(ingress.Labels, vNamespace)
+	}
 	if ingress.Annotations != nil && ingress.Annotations[constants.IssuerAnnotation] != "" {
-		ingress.Annotations[constants.IssuerAnnotation] = translate.Default.HostName(nil, ingress.Annotations[constants.IssuerAnnotation], ingress.Annotations[translate.NamespaceAnnotation]).Name
+		ingress.Annotations[constants.IssuerAnnotation] = naming.HostName(nil, naming.Issuer, ingress.Annotations[constants.IssuerAnnotation], vNamespace).Name
 	}
 }
@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/approverpolicy"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/dryrun"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-sdk/plugin"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewRouteHook creates the hook that rewrites the issuer annotations of OpenShift Routes. If the
+// dry-run recorder is set, the rewrites are recorded instead of applied.
+func NewRouteHook(dryRun *dryrun.Recorder) plugin.ClientHook {
+	return &routeHook{
+		dryRun: dryRun,
+	}
+}
+
+type routeHook struct {
+	dryRun *dryrun.Recorder
+}
+
+func (p *routeHook) Name() string {
+	return "route-hook-cert-manager"
+}
+
+func (p *routeHook) Resource() client.Object {
+	return certificates.NewRoute()
+}
+
+var _ plugin.MutateCreatePhysical = &routeHook{}
+
+func (p *routeHook) MutateCreatePhysical(ctx context.Context, obj client.Object) (client.Object, error) {
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not a route", obj)
+	}
+
+	return p.mutate(route, "mutate create"), nil
+}
+
+var _ plugin.MutateUpdatePhysical = &routeHook{}
+
+func (p *routeHook) MutateUpdatePhysical(ctx context.Context, obj client.Object) (client.Object, error) {
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not a route", obj)
+	}
+
+	return p.mutate(route, "mutate update"), nil
+}
+
+func (p *routeHook) mutate(route *unstructured.Unstructured, verb string) *unstructured.Unstructured {
+	if p.dryRun == nil {
+		mutateRoute(route)
+		return route
+	}
+
+	mutated := route.DeepCopy()
+	mutateRoute(mutated)
+	p.dryRun.Record(dryrun.Host, verb, route, mutated)
+	return route
+}
+
+// mutateRoute labels the route with its tenant and rewrites the issuer of the route integration.
+// Issuers are selected by the issuer name and kind annotations or by the issuer annotation of
+// ingresses. ClusterIssuers and external issuers keep their names.
+func mutateRoute(route *unstructured.Unstructured) {
+	annotations := route.GetAnnotations()
+	if annotations == nil {
+		return
+	}
+
+	vNamespace := annotations[translate.NamespaceAnnotation]
+	if vNamespace != "" {
+		route.SetLabels(approverpolicy.AddLabels(route.GetLabels(), vNamespace))
+	}
+
+	kind, group := annotations[constants.IssuerKindAnnotation], annotations[constants.IssuerGroupAnnotation]
+	if (kind != "" && kind != certmanagerv1.IssuerKind) || (group != "" && group != certmanagerv1.SchemeGroupVersion.Group) {
+		return
+	}
+
+	for _, key := range []string{constants.IssuerNameAnnotation, constants.IssuerAnnotation} {
+		if annotations[key] != "" {
+			annotations[key] = naming.HostName(nil, naming.Issuer, annotations[key], vNamespace).Name
+		}
+	}
+	route.SetAnnotations(annotations)
+}
@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const commandUsage = `Usage: cert-manager-plugin import [flags] [certificate/NAME | issuer/NAME ...]
+
+Marks host Certificates and Issuers for import into the virtual cluster. The running plugin
+imports the marked objects. Without arguments, all Certificates and Issuers of the host
+namespace that aren't synced by a virtual cluster yet are marked.
+
+Flags:
+`
+
+// Command runs the import subcommand. It marks host objects with the import annotation, so it
+// only needs access to the host cluster.
+func Command(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig of the host cluster, defaults to the in-cluster config")
+	namespace := flags.String("namespace", "", "host namespace of the Certificates and Issuers")
+	targetNamespace := flags.String("target-namespace", "", "virtual namespace to import the Certificates and Issuers into")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), commandUsage)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	} else if *namespace == "" || *targetNamespace == "" {
+		flags.Usage()
+		return fmt.Errorf("--namespace and --target-namespace are required")
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("load kubeconfig: %w", err)
+	}
+	hostClient, err := client.New(config, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return fmt.Errorf("create host client: %w", err)
+	}
+
+	ctx := context.Background()
+	objs, err := selectObjects(ctx, hostClient, *namespace, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		kind := kindOf(obj)
+		if obj.GetLabels()[translate.MarkerLabel] != "" || obj.GetAnnotations()[translate.NameAnnotation] != "" {
+			fmt.Fprintf(os.Stdout, "skipping %s/%s, it's synced by a virtual cluster already\n", kind, obj.GetName())
+			continue
+		}
+
+		err = mark(ctx, hostClient, obj, *targetNamespace)
+		if err != nil {
+			return fmt.Errorf("mark %s/%s: %w", kind, obj.GetName(), err)
+		}
+		fmt.Fprintf(os.Stdout, "marked %s/%s for import into %s\n", kind, obj.GetName(), *targetNamespace)
+	}
+
+	return nil
+}
+
+// selectObjects returns the objects named by the args, or all Certificates and Issuers of the
+// namespace without args. Issuers come first, so that they're imported before the Certificates
+// that reference them.
+func selectObjects(ctx context.Context, hostClient client.Client, namespace string, args []string) ([]client.Object, error) {
+	if len(args) == 0 {
+		issuerList := &certmanagerv1.IssuerList{}
+		err := hostClient.List(ctx, issuerList, client.InNamespace(namespace))
+		if err != nil {
+			return nil, fmt.Errorf("list issuers: %w", err)
+		}
+		certificateList := &certmanagerv1.CertificateList{}
+		err = hostClient.List(ctx, certificateList, client.InNamespace(namespace))
+		if err != nil {
+			return nil, fmt.Errorf("list certificates: %w", err)
+		}
+
+		objs := []client.Object{}
+		for i := range issuerList.Items {
+			objs = append(objs, &issuerList.Items[i])
+		}
+		for i := range certificateList.Items {
+			objs = append(objs, &certificateList.Items[i])
+		}
+		return objs, nil
+	}
+
+	objs := []client.Object{}
+	for _, arg := range args {
+		kind, name, ok := strings.Cut(arg, "/")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected certificate/NAME or issuer/NAME, got %q", arg)
+		}
+
+		var obj client.Object
+		switch strings.ToLower(kind) {
+		case "certificate", "certificates", "cert":
+			obj = &certmanagerv1.Certificate{}
+		case "issuer", "issuers":
+			obj = &certmanagerv1.Issuer{}
+		default:
+			return nil, fmt.Errorf("can't import %s, only certificates and issuers can be imported", kind)
+		}
+
+		err := hostClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj)
+		if err != nil {
+			return nil, fmt.Errorf("get %s: %w", arg, err)
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+func kindOf(obj client.Object) string {
+	if _, ok := obj.(*certmanagerv1.Issuer); ok {
+		return "issuer"
+	}
+
+	return "certificate"
+}
+
+func mark(ctx context.Context, hostClient client.Client, obj client.Object, targetNamespace string) error {
+	original := obj.DeepCopyObject().(client.Object)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[constants.ImportAnnotation] = targetNamespace
+	obj.SetAnnotations(annotations)
+
+	return hostClient.Patch(ctx, obj, client.MergeFrom(original))
+}
@@ -0,0 +1,440 @@
+// Package importer imports Certificates and Issuers that were created on the host before their
+// workload moved into the virtual cluster. Host objects are marked for import with the import
+// annotation, either by hand or with the import subcommand of the plugin binary. The importer
+// creates the virtual objects, moves the host objects to the names the plugin gives them and
+// keeps the issued secrets, so that cert-manager doesn't reissue the certificates.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ReasonImported is the reason of the events on imported virtual objects
+	ReasonImported = "Imported"
+
+	// ReasonImportFailed is the reason of the events on host objects that couldn't be imported
+	ReasonImportFailed = "ImportFailed"
+)
+
+// issuerWait is the delay before a certificate is imported again whose issuer is still waiting
+// for its import
+const issuerWait = 5 * time.Second
+
+// marked selects the host objects that carry the import annotation
+var marked = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return obj.GetAnnotations()[constants.ImportAnnotation] != ""
+})
+
+// Importer imports the host Certificates and Issuers that are marked for import
+type Importer struct {
+	registerCtx *synccontext.RegisterContext
+
+	virtualEvents record.EventRecorder
+	hostEvents    record.EventRecorder
+}
+
+// New creates a new importer
+func New(ctx *synccontext.RegisterContext) *Importer {
+	return &Importer{
+		registerCtx: ctx,
+
+		virtualEvents: ctx.VirtualManager.GetEventRecorderFor(constants.PluginName),
+		hostEvents:    ctx.PhysicalManager.GetEventRecorderFor(constants.PluginName),
+	}
+}
+
+func (i *Importer) Name() string {
+	return "importer"
+}
+
+var _ syncertypes.ControllerStarter = &Importer{}
+
+// Register starts the controllers that watch the host for marked Certificates and Issuers
+func (i *Importer) Register(ctx *synccontext.RegisterContext) error {
+	err := ctrl.NewControllerManagedBy(ctx.PhysicalManager).
+		Named("import-certificates").
+		For(&certmanagerv1.Certificate{}, builder.WithPredicates(marked)).
+		Complete(reconcile.Func(func(c context.Context, req reconcile.Request) (reconcile.Result, error) {
+			return i.reconcile(c, req, &certmanagerv1.Certificate{})
+		}))
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(ctx.PhysicalManager).
+		Named("import-issuers").
+		For(&certmanagerv1.Issuer{}, builder.WithPredicates(marked)).
+		Complete(reconcile.Func(func(c context.Context, req reconcile.Request) (reconcile.Result, error) {
+			return i.reconcile(c, req, &certmanagerv1.Issuer{})
+		}))
+}
+
+func (i *Importer) reconcile(c context.Context, req reconcile.Request, pObj client.Object) (reconcile.Result, error) {
+	ctx := i.registerCtx.ToSyncContext("importer")
+	ctx.Context = c
+
+	err := ctx.PhysicalClient.Get(c, req.NamespacedName, pObj)
+	if kerrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, err
+	} else if pObj.GetAnnotations()[constants.ImportAnnotation] == "" {
+		return reconcile.Result{}, nil
+	}
+
+	var (
+		vObj    client.Object
+		pending bool
+	)
+	switch pObj := pObj.(type) {
+	case *certmanagerv1.Certificate:
+		vObj, pending, err = ImportCertificate(ctx, pObj)
+	case *certmanagerv1.Issuer:
+		vObj, err = ImportIssuer(ctx, pObj)
+	}
+	if err != nil {
+		i.hostEvents.Eventf(pObj, corev1.EventTypeWarning, ReasonImportFailed, "Error importing: %v", err)
+		return reconcile.Result{}, err
+	} else if pending {
+		return reconcile.Result{RequeueAfter: issuerWait}, nil
+	}
+
+	i.virtualEvents.Eventf(vObj, corev1.EventTypeNormal, ReasonImported, "Imported from host %s/%s", req.Namespace, req.Name)
+	return reconcile.Result{}, nil
+}
+
+// ImportCertificate imports the marked host certificate. The issued secret is moved before the
+// virtual certificate is created, so that cert-manager finds it in place as soon as the host
+// certificate exists under its new name. If the certificate references an issuer that still
+// waits for its import, nothing is done and pending is returned.
+func ImportCertificate(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate) (_ *certmanagerv1.Certificate, pending bool, _ error) {
+	vNamespace := pCertificate.Annotations[constants.ImportAnnotation]
+	if pCertificate.Spec.IssuerRef.Kind == "Issuer" {
+		pending, err := importPending(ctx, types.NamespacedName{Namespace: pCertificate.Namespace, Name: pCertificate.Spec.IssuerRef.Name})
+		if err != nil || pending {
+			return nil, pending, err
+		}
+	}
+
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: virtualMetadata(pCertificate, vNamespace),
+		Spec:       *pCertificate.Spec.DeepCopy(),
+	}
+	pName := naming.HostName(ctx, naming.Certificate, vCertificate.Name, vNamespace)
+	pSpec := certificates.HostSpec(ctx, &vCertificate.Spec, vNamespace)
+
+	err := ensureNamespace(ctx, vNamespace)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// keystore passwords are managed within the virtual cluster from now on
+	inputs := []string{}
+	if keystores := pCertificate.Spec.Keystores; keystores != nil && keystores.JKS != nil {
+		inputs = append(inputs, keystores.JKS.PasswordSecretRef.Name)
+	}
+	if keystores := pCertificate.Spec.Keystores; keystores != nil && keystores.PKCS12 != nil {
+		inputs = append(inputs, keystores.PKCS12.PasswordSecretRef.Name)
+	}
+	err = copySecrets(ctx, pCertificate.Namespace, vNamespace, inputs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// cert-manager reissues if the secret annotations don't match the certificate
+	secretName := types.NamespacedName{Namespace: pCertificate.Namespace, Name: pCertificate.Spec.SecretName}
+	pSecretName := naming.HostName(ctx, naming.Secret, pCertificate.Spec.SecretName, vNamespace)
+	err = moveSecret(ctx, secretName, pSecretName, types.NamespacedName{Namespace: vNamespace, Name: pCertificate.Spec.SecretName}, func(annotations map[string]string) {
+		annotations[certmanagerv1.CertificateNameKey] = pName.Name
+		if _, ok := annotations[certmanagerv1.IssuerNameAnnotationKey]; ok {
+			annotations[certmanagerv1.IssuerNameAnnotationKey] = pSpec.IssuerRef.Name
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = createVirtual(ctx, vCertificate)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// relabel the host certificate if it already has the right name, otherwise the syncer
+	// creates it under the new name
+	if pName == client.ObjectKeyFromObject(pCertificate) {
+		updated := translate.HostMetadata(vCertificate, pName)
+		updated.ResourceVersion = pCertificate.ResourceVersion
+		updated.Spec = *pSpec
+		ctx.Log.Infof("relabel host certificate %s/%s imported into %s", pCertificate.Namespace, pCertificate.Name, vNamespace)
+		return vCertificate, false, ctx.PhysicalClient.Update(ctx.Context, updated)
+	}
+
+	ctx.Log.Infof("delete host certificate %s/%s imported into %s as %s", pCertificate.Namespace, pCertificate.Name, vNamespace, pName.Name)
+	err = deleteHost(ctx, pCertificate)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return vCertificate, false, deleteMovedSecret(ctx, secretName, pSecretName)
+}
+
+// ImportIssuer imports the marked host issuer. The ACME account key is moved with the issuer,
+// so the issuer keeps its ACME account.
+func ImportIssuer(ctx *synccontext.SyncContext, pIssuer *certmanagerv1.Issuer) (*certmanagerv1.Issuer, error) {
+	vNamespace := pIssuer.Annotations[constants.ImportAnnotation]
+	vIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: virtualMetadata(pIssuer, vNamespace),
+		Spec:       *pIssuer.Spec.DeepCopy(),
+	}
+	pName := naming.HostName(ctx, naming.Issuer, vIssuer.Name, vNamespace)
+	err := ensureNamespace(ctx, vNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// cert-manager writes the ACME account key, all other secrets are managed within the
+	// virtual cluster from now on
+	accountKey := ""
+	if pIssuer.Spec.ACME != nil {
+		accountKey = pIssuer.Spec.ACME.PrivateKey.Name
+	}
+	inputs := []string{}
+	for _, name := range issuers.SecretNames(&pIssuer.Spec) {
+		if name != accountKey {
+			inputs = append(inputs, name)
+		}
+	}
+	err = copySecrets(ctx, pIssuer.Namespace, vNamespace, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	secretName := types.NamespacedName{Namespace: pIssuer.Namespace, Name: accountKey}
+	pSecretName := naming.HostName(ctx, naming.Secret, accountKey, vNamespace)
+	if accountKey != "" {
+		err = moveSecret(ctx, secretName, pSecretName, types.NamespacedName{Namespace: vNamespace, Name: accountKey}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = createVirtual(ctx, vIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if pName == client.ObjectKeyFromObject(pIssuer) {
+		updated := translate.HostMetadata(vIssuer, pName)
+		updated.ResourceVersion = pIssuer.ResourceVersion
+		updated.Spec = *issuers.HostSpec(ctx, &vIssuer.Spec, vNamespace)
+		ctx.Log.Infof("relabel host issuer %s/%s imported into %s", pIssuer.Namespace, pIssuer.Name, vNamespace)
+		return vIssuer, ctx.PhysicalClient.Update(ctx.Context, updated)
+	}
+
+	ctx.Log.Infof("delete host issuer %s/%s imported into %s as %s", pIssuer.Namespace, pIssuer.Name, vNamespace, pName.Name)
+	err = deleteHost(ctx, pIssuer)
+	if err != nil {
+		return nil, err
+	} else if accountKey == "" {
+		return vIssuer, nil
+	}
+
+	return vIssuer, deleteMovedSecret(ctx, secretName, pSecretName)
+}
+
+// importPending checks if the host issuer still waits for its import
+func importPending(ctx *synccontext.SyncContext, pName types.NamespacedName) (bool, error) {
+	pIssuer := &certmanagerv1.Issuer{}
+	err := ctx.PhysicalClient.Get(ctx.Context, pName, pIssuer)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return pIssuer.Annotations[constants.ImportAnnotation] != "", nil
+}
+
+// virtualMetadata returns the metadata of the virtual object that is imported from the host object
+func virtualMetadata(pObj client.Object, vNamespace string) metav1.ObjectMeta {
+	labels := map[string]string{}
+	for k, v := range pObj.GetLabels() {
+		labels[k] = v
+	}
+	annotations := map[string]string{}
+	for k, v := range pObj.GetAnnotations() {
+		annotations[k] = v
+	}
+	delete(annotations, constants.ImportAnnotation)
+	annotations[constants.ImportedFromAnnotation] = pObj.GetNamespace() + "/" + pObj.GetName()
+
+	return metav1.ObjectMeta{
+		Name:        pObj.GetName(),
+		Namespace:   vNamespace,
+		Labels:      labels,
+		Annotations: annotations,
+	}
+}
+
+// createVirtual creates the virtual object. If it exists already, it has to be imported from
+// the same host object by an earlier attempt.
+func createVirtual(ctx *synccontext.SyncContext, vObj client.Object) error {
+	err := ctx.VirtualClient.Create(ctx.Context, vObj)
+	if !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	importedFrom := vObj.GetAnnotations()[constants.ImportedFromAnnotation]
+	err = ctx.VirtualClient.Get(ctx.Context, client.ObjectKeyFromObject(vObj), vObj)
+	if err != nil {
+		return err
+	} else if vObj.GetAnnotations()[constants.ImportedFromAnnotation] != importedFrom {
+		return fmt.Errorf("virtual object %s/%s exists already and wasn't imported from host %s", vObj.GetNamespace(), vObj.GetName(), importedFrom)
+	}
+
+	return nil
+}
+
+func ensureNamespace(ctx *synccontext.SyncContext, name string) error {
+	err := ctx.VirtualClient.Get(ctx.Context, types.NamespacedName{Name: name}, &corev1.Namespace{})
+	if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	ctx.Log.Infof("create virtual namespace %s to import into", name)
+	err = ctx.VirtualClient.Create(ctx.Context, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	if kerrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// copySecrets copies the host secrets the imported object reads into the virtual namespace.
+// The secret syncer then syncs them to the host under the names of the plugin. The host
+// secrets are kept, as other objects might still reference them.
+func copySecrets(ctx *synccontext.SyncContext, pNamespace, vNamespace string, names []string) error {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		pSecret := &corev1.Secret{}
+		err := ctx.PhysicalClient.Get(ctx.Context, types.NamespacedName{Namespace: pNamespace, Name: name}, pSecret)
+		if kerrors.IsNotFound(err) {
+			ctx.Log.Infof("host secret %s/%s of imported object doesn't exist, skipping it", pNamespace, name)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		vSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   vNamespace,
+				Labels:      pSecret.Labels,
+				Annotations: pSecret.Annotations,
+			},
+			Type: pSecret.Type,
+			Data: pSecret.Data,
+		}
+		ctx.Log.Infof("create virtual secret %s/%s imported from host", vNamespace, name)
+		err = ctx.VirtualClient.Create(ctx.Context, vSecret)
+		if err != nil && !kerrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveSecret copies the host secret cert-manager wrote for the imported object to its new host
+// name. The copy is marked like the other host objects of the vcluster as the host secret of
+// the virtual secret vName. annotate updates the annotations of the copy. The original secret is
+// deleted after the host object, so that cert-manager doesn't recreate it.
+func moveSecret(ctx *synccontext.SyncContext, from, to, vName types.NamespacedName, annotate func(annotations map[string]string)) error {
+	pSecret := &corev1.Secret{}
+	err := ctx.PhysicalClient.Get(ctx.Context, from, pSecret)
+	if kerrors.IsNotFound(err) {
+		// the secret was moved by an earlier attempt or was never written
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	moved := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        to.Name,
+			Namespace:   to.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Type: pSecret.Type,
+		Data: pSecret.Data,
+	}
+	for k, v := range pSecret.Labels {
+		moved.Labels[k] = v
+	}
+	for k, v := range pSecret.Annotations {
+		moved.Annotations[k] = v
+	}
+	if annotate != nil {
+		annotate(moved.Annotations)
+	}
+
+	// the virtual secret doesn't exist yet, so only the vcluster markers are added
+	vSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: vName.Name, Namespace: vName.Namespace}}
+	for k, v := range translate.HostLabels(vSecret, nil) {
+		moved.Labels[k] = v
+	}
+	moved.Annotations = translate.HostAnnotations(vSecret, moved)
+
+	if from == to {
+		moved.ResourceVersion = pSecret.ResourceVersion
+		return ctx.PhysicalClient.Update(ctx.Context, moved)
+	}
+
+	ctx.Log.Infof("copy host secret %s to %s for import", from, to)
+	err = ctx.PhysicalClient.Create(ctx.Context, moved)
+	if kerrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func deleteMovedSecret(ctx *synccontext.SyncContext, from, to types.NamespacedName) error {
+	if from == to {
+		return nil
+	}
+
+	return deleteHost(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: from.Name, Namespace: from.Namespace}})
+}
+
+func deleteHost(ctx *synccontext.SyncContext, pObj client.Object) error {
+	err := ctx.PhysicalClient.Delete(ctx.Context, pObj)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
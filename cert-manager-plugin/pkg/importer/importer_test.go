@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"context"
+	"testing"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	hostNamespace    = "vcluster"
+	virtualNamespace = "shop"
+)
+
+func newSyncContext(t *testing.T, pObjs ...runtime.Object) *synccontext.SyncContext {
+	t.Helper()
+
+	registerCtx := fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme), testingutil.NewFakeClient(scheme.Scheme, pObjs...))
+	return registerCtx.ToSyncContext("test")
+}
+
+func newMarkedIssuer(name string) *certmanagerv1.Issuer {
+	return &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   hostNamespace,
+			Annotations: map[string]string{constants.ImportAnnotation: virtualNamespace},
+		},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			ACME: &cmacme.ACMEIssuer{
+				Server:     "https://acme-v02.api.letsencrypt.org/directory",
+				PrivateKey: cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: name + "-account"}},
+				Solvers: []cmacme.ACMEChallengeSolver{{
+					DNS01: &cmacme.ACMEChallengeSolverDNS01{
+						Cloudflare: &cmacme.ACMEIssuerDNS01ProviderCloudflare{
+							APIToken: &cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: "cloudflare"}, Key: "token"},
+						},
+					},
+				}},
+			},
+		}},
+	}
+}
+
+func newMarkedCertificate(name, issuer string) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   hostNamespace,
+			Annotations: map[string]string{constants.ImportAnnotation: virtualNamespace},
+		},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: name + "-tls",
+			DNSNames:   []string{"shop.example.com"},
+			IssuerRef:  cmmeta.ObjectReference{Kind: "Issuer", Name: issuer},
+		},
+	}
+}
+
+func newSecret(name string, annotations map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: hostNamespace, Annotations: annotations},
+		Data:       map[string][]byte{"data": []byte(name)},
+	}
+}
+
+// newIssuedSecret returns the secret cert-manager wrote for the certificate
+func newIssuedSecret(certificate *certmanagerv1.Certificate) *corev1.Secret {
+	return newSecret(certificate.Spec.SecretName, map[string]string{
+		certmanagerv1.CertificateNameKey:      certificate.Name,
+		certmanagerv1.IssuerNameAnnotationKey: certificate.Spec.IssuerRef.Name,
+		certmanagerv1.IssuerKindAnnotationKey: certificate.Spec.IssuerRef.Kind,
+	})
+}
+
+func get(t *testing.T, c client.Client, name types.NamespacedName, obj client.Object) {
+	t.Helper()
+
+	err := c.Get(context.Background(), name, obj)
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+}
+
+func expectDeleted(t *testing.T, c client.Client, name types.NamespacedName, obj client.Object) {
+	t.Helper()
+
+	err := c.Get(context.Background(), name, obj)
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected %s to be deleted, got %v", name, err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	fixtures.WithTranslator(t, translate.NewSingleNamespaceTranslator(hostNamespace))
+	issuer := newMarkedIssuer("letsencrypt")
+	certificate := newMarkedCertificate("web", "letsencrypt")
+	ctx := newSyncContext(t,
+		issuer.DeepCopy(),
+		certificate.DeepCopy(),
+		newSecret("letsencrypt-account", nil),
+		newSecret("cloudflare", nil),
+		newIssuedSecret(certificate),
+	)
+
+	// the certificate waits for its issuer
+	_, pending, err := ImportCertificate(ctx, certificate.DeepCopy())
+	if err != nil {
+		t.Fatalf("import certificate: %v", err)
+	} else if !pending {
+		t.Fatalf("expected the certificate to wait for the import of its issuer")
+	}
+
+	_, err = ImportIssuer(ctx, issuer.DeepCopy())
+	if err != nil {
+		t.Fatalf("import issuer: %v", err)
+	}
+
+	vIssuer := &certmanagerv1.Issuer{}
+	get(t, ctx.VirtualClient, types.NamespacedName{Namespace: virtualNamespace, Name: "letsencrypt"}, vIssuer)
+	if vIssuer.Annotations[constants.ImportedFromAnnotation] != "vcluster/letsencrypt" {
+		t.Errorf("expected the virtual issuer to record its origin, got annotations %v", vIssuer.Annotations)
+	} else if _, ok := vIssuer.Annotations[constants.ImportAnnotation]; ok {
+		t.Errorf("expected the import annotation to be removed from the virtual issuer")
+	}
+
+	// the solver credentials are managed within the virtual cluster now, the account key
+	// moved on the host
+	get(t, ctx.VirtualClient, types.NamespacedName{Namespace: virtualNamespace, Name: "cloudflare"}, &corev1.Secret{})
+	get(t, ctx.PhysicalClient, types.NamespacedName{Namespace: hostNamespace, Name: "cloudflare"}, &corev1.Secret{})
+	get(t, ctx.PhysicalClient, naming.HostName(ctx, naming.Secret, "letsencrypt-account", virtualNamespace), &corev1.Secret{})
+	expectDeleted(t, ctx.PhysicalClient, types.NamespacedName{Namespace: hostNamespace, Name: "letsencrypt-account"}, &corev1.Secret{})
+	expectDeleted(t, ctx.PhysicalClient, client.ObjectKeyFromObject(issuer), &certmanagerv1.Issuer{})
+
+	_, pending, err = ImportCertificate(ctx, certificate.DeepCopy())
+	if err != nil {
+		t.Fatalf("import certificate: %v", err)
+	} else if pending {
+		t.Fatalf("expected the certificate to be imported")
+	}
+
+	vCertificate := &certmanagerv1.Certificate{}
+	get(t, ctx.VirtualClient, types.NamespacedName{Namespace: virtualNamespace, Name: "web"}, vCertificate)
+	if vCertificate.Spec.SecretName != "web-tls" || vCertificate.Spec.IssuerRef.Name != "letsencrypt" {
+		t.Errorf("expected the virtual certificate to keep the original names, got %#v", vCertificate.Spec)
+	}
+
+	// the issued secret is moved with annotations that match the new host names, so that
+	// cert-manager doesn't reissue
+	pSecret := &corev1.Secret{}
+	get(t, ctx.PhysicalClient, naming.HostName(ctx, naming.Secret, "web-tls", virtualNamespace), pSecret)
+	if name := naming.HostName(ctx, naming.Certificate, "web", virtualNamespace).Name; pSecret.Annotations[certmanagerv1.CertificateNameKey] != name {
+		t.Errorf("expected certificate name annotation %s, got %s", name, pSecret.Annotations[certmanagerv1.CertificateNameKey])
+	}
+	if name := naming.HostName(ctx, naming.Issuer, "letsencrypt", virtualNamespace).Name; pSecret.Annotations[certmanagerv1.IssuerNameAnnotationKey] != name {
+		t.Errorf("expected issuer name annotation %s, got %s", name, pSecret.Annotations[certmanagerv1.IssuerNameAnnotationKey])
+	}
+	if pSecret.Labels[translate.MarkerLabel] != translate.VClusterName || pSecret.Labels[translate.NamespaceLabel] != virtualNamespace {
+		t.Errorf("expected the moved secret to carry the vcluster labels, got %v", pSecret.Labels)
+	}
+	if pSecret.Annotations[translate.NameAnnotation] != "web-tls" || pSecret.Annotations[translate.NamespaceAnnotation] != virtualNamespace {
+		t.Errorf("expected the moved secret to carry the virtual name, got %v", pSecret.Annotations)
+	}
+	if pSecret.Annotations[certmanagerv1.IssuerKindAnnotationKey] != "Issuer" {
+		t.Errorf("expected the cert-manager annotations to be kept, got %v", pSecret.Annotations)
+	}
+	if string(pSecret.Data["data"]) != "web-tls" {
+		t.Errorf("expected the secret data to be kept, got %v", pSecret.Data)
+	}
+	expectDeleted(t, ctx.PhysicalClient, types.NamespacedName{Namespace: hostNamespace, Name: "web-tls"}, &corev1.Secret{})
+	expectDeleted(t, ctx.PhysicalClient, client.ObjectKeyFromObject(certificate), &certmanagerv1.Certificate{})
+
+	// importing again is a no-op
+	_, _, err = ImportCertificate(ctx, certificate.DeepCopy())
+	if err != nil {
+		t.Fatalf("import certificate again: %v", err)
+	}
+}
+
+func TestImportRelabelsHostObjectWithPluginName(t *testing.T) {
+	// with the multi namespace translator names are kept, so a certificate that already lives
+	// in the host namespace of its virtual namespace keeps its name
+	fixtures.WithTranslator(t, translate.NewMultiNamespaceTranslator(hostNamespace))
+	pName := naming.HostName(nil, naming.Certificate, "web", virtualNamespace)
+	certificate := newMarkedCertificate(pName.Name, "letsencrypt")
+	certificate.Namespace = pName.Namespace
+	certificate.Spec.IssuerRef.Kind = "ClusterIssuer"
+	ctx := newSyncContext(t, certificate.DeepCopy())
+	get(t, ctx.PhysicalClient, pName, certificate)
+
+	_, _, err := ImportCertificate(ctx, certificate)
+	if err != nil {
+		t.Fatalf("import certificate: %v", err)
+	}
+
+	pCertificate := &certmanagerv1.Certificate{}
+	get(t, ctx.PhysicalClient, pName, pCertificate)
+	if !translate.Default.IsManaged(ctx, pCertificate) {
+		t.Errorf("expected the host certificate to be relabeled, got annotations %v", pCertificate.Annotations)
+	}
+	if pCertificate.Annotations[translate.NameAnnotation] != "web" || pCertificate.Annotations[translate.NamespaceAnnotation] != virtualNamespace {
+		t.Errorf("expected the host certificate to reference the virtual certificate, got annotations %v", pCertificate.Annotations)
+	}
+	if _, ok := pCertificate.Annotations[constants.ImportAnnotation]; ok {
+		t.Errorf("expected the import annotation to be removed from the host certificate")
+	}
+	if name := naming.HostName(ctx, naming.Secret, certificate.Spec.SecretName, virtualNamespace).Name; pCertificate.Spec.SecretName != name {
+		t.Errorf("expected secret name %s, got %s", name, pCertificate.Spec.SecretName)
+	}
+}
+
+func TestImportRefusesExistingVirtualObject(t *testing.T) {
+	fixtures.WithTranslator(t, translate.NewSingleNamespaceTranslator(hostNamespace))
+	issuer := newMarkedIssuer("letsencrypt")
+	ctx := newSyncContext(t, issuer.DeepCopy())
+
+	err := ctx.VirtualClient.Create(ctx, &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt", Namespace: virtualNamespace}})
+	if err != nil {
+		t.Fatalf("create virtual issuer: %v", err)
+	}
+
+	_, err = ImportIssuer(ctx, issuer.DeepCopy())
+	if err == nil {
+		t.Fatalf("expected the import to fail")
+	}
+	get(t, ctx.PhysicalClient, client.ObjectKeyFromObject(issuer), &certmanagerv1.Issuer{})
+}
@@ -0,0 +1,216 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// syncedBackwards selects the virtual secrets the plugin synced from the host, which include
+// the secrets of all virtual Certificates
+var syncedBackwards = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return obj.GetAnnotations()[constants.BackwardSyncAnnotation] == "true"
+})
+
+// Copier copies the host secrets of virtual Certificates that back virtual Gateways into the
+// namespace of the Istio ingress gateway. The copies live outside the host namespace of the
+// vcluster, so they outlive a deleted vcluster and have to be deleted by their VClusterLabel.
+type Copier struct {
+	registerCtx *synccontext.RegisterContext
+	owners      *owners.Registry
+
+	// namespace is the host namespace of the ingress gateway
+	namespace string
+
+	// hostReader reads the copies, as the namespace of the ingress gateway isn't cached
+	hostReader client.Reader
+}
+
+// NewCopier creates a new secret copier for the namespace of the configuration
+func NewCopier(ctx *synccontext.RegisterContext, cfg config.IstioGateways, registry *owners.Registry) *Copier {
+	return &Copier{
+		registerCtx: ctx,
+		owners:      registry,
+		namespace:   cfg.Namespace,
+		hostReader:  ctx.PhysicalManager.GetAPIReader(),
+	}
+}
+
+func (c *Copier) Name() string {
+	return "istio-gateway-secrets"
+}
+
+var _ syncertypes.ControllerStarter = &Copier{}
+
+// Register starts a controller on the virtual cluster that reconciles the virtual secrets.
+// Changes of Certificates, Gateways and host secrets are mapped to the virtual secrets.
+func (c *Copier) Register(ctx *synccontext.RegisterContext) error {
+	return ctrl.NewControllerManagedBy(ctx.VirtualManager).
+		Named("istio-gateway-secrets").
+		For(&corev1.Secret{}, builder.WithPredicates(syncedBackwards)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(mapCertificate)).
+		Watches(NewGateway(), handler.EnqueueRequestsFromMapFunc(mapGateway)).
+		WatchesRawSource(source.Kind(ctx.PhysicalManager.GetCache(), &corev1.Secret{}, handler.TypedEnqueueRequestsFromMapFunc(c.mapHostSecret))).
+		Complete(reconcile.Func(c.reconcile))
+}
+
+// mapCertificate maps a changed virtual Certificate to its secret
+func mapCertificate(_ context.Context, obj client.Object) []reconcile.Request {
+	certificate, ok := obj.(*certmanagerv1.Certificate)
+	if !ok {
+		return nil
+	}
+
+	name := certificate.Name
+	if certificate.Spec.SecretName != "" {
+		name = certificate.Spec.SecretName
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: certificate.Namespace, Name: name}}}
+}
+
+// mapGateway maps a changed virtual Gateway to the secrets it references
+func mapGateway(_ context.Context, obj client.Object) []reconcile.Request {
+	gateway, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, name := range CredentialNames(gateway) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: gateway.GetNamespace(), Name: name}})
+	}
+
+	return requests
+}
+
+// mapHostSecret maps a changed host secret to the virtual secret of the Certificate that owns it
+func (c *Copier) mapHostSecret(_ context.Context, pSecret *corev1.Secret) []reconcile.Request {
+	owner, ok := c.owners.Owner(owners.KindSecret, types.NamespacedName{Namespace: pSecret.Namespace, Name: pSecret.Name}, owners.KindCertificate)
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: owner.Target}}
+}
+
+func (c *Copier) reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	syncCtx := c.registerCtx.ToSyncContext("istio-gateway-secrets")
+	syncCtx.Context = ctx
+
+	return reconcile.Result{}, c.Copy(syncCtx, req.NamespacedName)
+}
+
+// Copy copies the host secret of the virtual secret into the namespace of the ingress gateway if
+// the virtual secret is the secret of a virtual Certificate and referenced by a virtual Gateway.
+// Otherwise the copy is deleted. Secrets in the namespace that aren't copies of the virtual
+// secret of this vcluster are left alone.
+func (c *Copier) Copy(ctx *synccontext.SyncContext, vName types.NamespacedName) error {
+	source, err := c.source(ctx, vName)
+	if err != nil {
+		return err
+	}
+
+	cName := types.NamespacedName{Namespace: c.namespace, Name: CredentialName(ctx, vName, c.namespace)}
+	existing := &corev1.Secret{}
+	err = c.hostReader.Get(ctx, cName, existing)
+	if kerrors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return fmt.Errorf("get host secret %s: %w", cName, err)
+	} else if existing.Annotations[constants.GatewaySecretOfAnnotation] != vName.String() || existing.Labels[constants.VClusterLabel] != translate.VClusterName {
+		ctx.Log.Infof("don't overwrite host secret %s with secret %s, because it wasn't copied by the plugin of this vcluster", cName, vName)
+		return nil
+	}
+
+	if source == nil {
+		if existing == nil {
+			return nil
+		}
+
+		ctx.Log.Infof("delete host secret %s, because secret %s no longer backs a gateway", cName, vName)
+		err := ctx.PhysicalClient.Delete(ctx, existing)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	// the type of a secret can't be changed, so the copy is created again
+	if existing != nil && existing.Type != source.Type {
+		ctx.Log.Infof("delete host secret %s, because the type of secret %s has changed", cName, vName)
+		err := ctx.PhysicalClient.Delete(ctx, existing)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+		existing = nil
+	}
+
+	if existing == nil {
+		copied := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cName.Name,
+				Namespace: cName.Namespace,
+				Labels: map[string]string{
+					constants.VClusterLabel:         translate.VClusterName,
+					constants.VirtualNamespaceLabel: vName.Namespace,
+				},
+				Annotations: map[string]string{constants.GatewaySecretOfAnnotation: vName.String()},
+			},
+			Type: source.Type,
+			Data: source.Data,
+		}
+
+		ctx.Log.Infof("create host secret %s for gateways of secret %s", cName, vName)
+		return ctx.PhysicalClient.Create(ctx, copied)
+	} else if equality.Semantic.DeepEqual(existing.Data, source.Data) {
+		return nil
+	}
+
+	existing.Data = source.Data
+	ctx.Log.Infof("update host secret %s, because secret %s has changed", cName, vName)
+	return ctx.PhysicalClient.Update(ctx, existing)
+}
+
+// source returns the host secret of the virtual secret if it backs a virtual Gateway
+func (c *Copier) source(ctx *synccontext.SyncContext, vName types.NamespacedName) (*corev1.Secret, error) {
+	certificateSecret, err := CertificateSecret(ctx, ctx.VirtualClient, vName)
+	if err != nil || !certificateSecret {
+		return nil, err
+	}
+	backsGateway, err := gatewaySecret(ctx, ctx.VirtualClient, vName)
+	if err != nil || !backsGateway {
+		return nil, err
+	}
+
+	pName := naming.HostName(ctx, naming.Secret, vName.Name, vName.Namespace)
+	pSecret := &corev1.Secret{}
+	err = ctx.PhysicalClient.Get(ctx, pName, pSecret)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get host secret %s: %w", pName, err)
+	}
+
+	return pSecret, nil
+}
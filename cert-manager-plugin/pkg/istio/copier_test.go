@@ -0,0 +1,266 @@
+package istio
+
+import (
+	"context"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const gatewayNamespace = "istio-system"
+
+func newGatewayObject(namespace, name string, credentialNames ...string) *unstructured.Unstructured {
+	gateway := NewGateway()
+	gateway.SetNamespace(namespace)
+	gateway.SetName(name)
+
+	servers := []interface{}{}
+	for _, credentialName := range credentialNames {
+		servers = append(servers, map[string]interface{}{
+			"port": map[string]interface{}{"number": int64(443), "name": "https", "protocol": "HTTPS"},
+			"tls":  map[string]interface{}{"mode": "SIMPLE", "credentialName": credentialName},
+		})
+	}
+	_ = unstructured.SetNestedSlice(gateway.Object, servers, "spec", "servers")
+	return gateway
+}
+
+func newCertificate(namespace, name, secretName string) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: secretName},
+	}
+}
+
+// newHostSecret returns the host secret of the virtual secret
+func newHostSecret(vNamespace, vName, data string) *corev1.Secret {
+	pName := naming.HostName(nil, naming.Secret, vName, vNamespace)
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: pName.Name},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{"tls.crt": []byte(data)},
+	}
+}
+
+// newSyncContext returns a context with the virtual objects and the host objects. The virtual
+// certificates are indexed by their secrets like the secret syncer does.
+func newSyncContext(t *testing.T, vObjs []runtime.Object, pObjs ...runtime.Object) *synccontext.SyncContext {
+	t.Helper()
+
+	vClient := testingutil.NewFakeClient(scheme.Scheme, vObjs...)
+	vClient.AddMapping(GatewayGVK, meta.RESTScopeNamespace)
+	err := vClient.IndexField(context.Background(), &certmanagerv1.Certificate{}, secrets.IndexByCertificateSecret, func(obj client.Object) []string {
+		certificate := obj.(*certmanagerv1.Certificate)
+		return []string{certificate.Namespace + "/" + certificate.Spec.SecretName}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerCtx := fixtures.NewRegisterContext(vClient, testingutil.NewFakeClient(scheme.Scheme, pObjs...))
+	return registerCtx.ToSyncContext("istio-gateway-secrets")
+}
+
+func newCopier(ctx *synccontext.SyncContext) *Copier {
+	return &Copier{namespace: gatewayNamespace, hostReader: ctx.PhysicalClient}
+}
+
+// newCopy returns the copy of the virtual secret the plugin created in the gateway namespace
+func newCopy(vName types.NamespacedName) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: gatewayNamespace,
+			Name:      CredentialName(nil, vName, gatewayNamespace),
+			Labels: map[string]string{
+				constants.VClusterLabel:         translate.VClusterName,
+				constants.VirtualNamespaceLabel: vName.Namespace,
+			},
+			Annotations: map[string]string{constants.GatewaySecretOfAnnotation: vName.String()},
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+}
+
+func getCopy(t *testing.T, ctx *synccontext.SyncContext, vName types.NamespacedName) *corev1.Secret {
+	t.Helper()
+
+	copied := &corev1.Secret{}
+	err := ctx.PhysicalClient.Get(ctx, types.NamespacedName{Namespace: gatewayNamespace, Name: CredentialName(ctx, vName, gatewayNamespace)}, copied)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return copied
+}
+
+func TestCopy(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vName := types.NamespacedName{Namespace: "shop", Name: "web-tls"}
+
+	t.Run("create", func(t *testing.T) {
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "issued"),
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		copied := getCopy(t, ctx, vName)
+		if copied == nil {
+			t.Fatal("expected the secret to be copied")
+		}
+		if string(copied.Data["tls.crt"]) != "issued" || copied.Type != corev1.SecretTypeTLS {
+			t.Errorf("unexpected copy %v", copied)
+		}
+		if copied.Annotations[constants.GatewaySecretOfAnnotation] != "shop/web-tls" || copied.Labels[constants.VirtualNamespaceLabel] != "shop" {
+			t.Errorf("unexpected metadata of copy %v", copied.ObjectMeta)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		existing := newCopy(vName)
+		existing.Data = map[string][]byte{"tls.crt": []byte("expired")}
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "renewed"), existing,
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied == nil || string(copied.Data["tls.crt"]) != "renewed" {
+			t.Errorf("expected the copy to be updated, got %v", copied)
+		}
+	})
+
+	t.Run("changed type", func(t *testing.T) {
+		existing := newCopy(vName)
+		existing.Type = corev1.SecretTypeOpaque
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "issued"), existing,
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied == nil || copied.Type != corev1.SecretTypeTLS || string(copied.Data["tls.crt"]) != "issued" {
+			t.Errorf("expected the copy to be created again with the new type, got %v", copied)
+		}
+	})
+
+	t.Run("no gateway", func(t *testing.T) {
+		existing := newCopy(vName)
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "other-tls")},
+			newHostSecret("shop", "web-tls", "issued"), existing,
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied != nil {
+			t.Errorf("expected the copy to be deleted, got %v", copied)
+		}
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		ctx := newSyncContext(t,
+			[]runtime.Object{newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "issued"),
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied != nil {
+			t.Errorf("expected no copy of a secret without certificate, got %v", copied)
+		}
+	})
+
+	t.Run("copy of another vcluster", func(t *testing.T) {
+		existing := newCopy(vName)
+		existing.Labels[constants.VClusterLabel] = "other"
+		existing.Data = map[string][]byte{"tls.crt": []byte("other")}
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "issued"), existing,
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied == nil || string(copied.Data["tls.crt"]) != "other" {
+			t.Errorf("expected the copy of the other vcluster to be kept, got %v", copied)
+		}
+	})
+
+	t.Run("foreign secret", func(t *testing.T) {
+		existing := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: gatewayNamespace, Name: CredentialName(nil, vName, gatewayNamespace)},
+			Data:       map[string][]byte{"tls.crt": []byte("foreign")},
+		}
+		ctx := newSyncContext(t,
+			[]runtime.Object{newCertificate("shop", "web", "web-tls"), newGatewayObject("shop", "web", "web-tls")},
+			newHostSecret("shop", "web-tls", "issued"), existing,
+		)
+
+		err := newCopier(ctx).Copy(ctx, vName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if copied := getCopy(t, ctx, vName); copied == nil || string(copied.Data["tls.crt"]) != "foreign" {
+			t.Errorf("expected the foreign secret to be kept, got %v", copied)
+		}
+	})
+}
+
+func TestSetCredentialNames(t *testing.T) {
+	gateway := newGatewayObject("shop", "web", "web-tls", "api-tls")
+	err := SetCredentialNames(gateway, func(name string) string {
+		if name == "web-tls" {
+			return "web-tls-x-shop-x-vcluster"
+		}
+		return name
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := CredentialNames(gateway)
+	if len(names) != 2 || names[0] != "web-tls-x-shop-x-vcluster" || names[1] != "api-tls" {
+		t.Errorf("unexpected credential names %v", names)
+	}
+}
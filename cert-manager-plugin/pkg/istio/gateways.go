@@ -0,0 +1,119 @@
+// Package istio makes the secrets of virtual Certificates available to the Istio ingress
+// gateway of the host. Istio Gateways reference their TLS secrets by credentialName, and the
+// ingress gateway reads them from its own namespace. The credentialNames of synced Gateways are
+// rewritten to the host secrets, which are copied into the namespace of the ingress gateway if
+// it doesn't run in the host namespace of the vcluster.
+package istio
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GatewayGVK is the kind of the Istio Gateways. Gateways are handled as unstructured objects, so
+// the plugin doesn't depend on Istio.
+var GatewayGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "Gateway"}
+
+// NewGateway returns an empty unstructured Gateway
+func NewGateway() *unstructured.Unstructured {
+	gateway := &unstructured.Unstructured{}
+	gateway.SetGroupVersionKind(GatewayGVK)
+	return gateway
+}
+
+// CredentialNames returns the credentialNames of the TLS settings of the Gateway servers
+func CredentialNames(gateway *unstructured.Unstructured) []string {
+	servers, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "servers")
+	names := []string{}
+	for _, server := range servers {
+		serverMap, ok := server.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(serverMap, "tls", "credentialName")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// SetCredentialNames replaces the credentialNames of the Gateway servers by the result of rename
+func SetCredentialNames(gateway *unstructured.Unstructured, rename func(name string) string) error {
+	servers, found, err := unstructured.NestedSlice(gateway.Object, "spec", "servers")
+	if err != nil || !found {
+		return err
+	}
+
+	for _, server := range servers {
+		serverMap, ok := server.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(serverMap, "tls", "credentialName")
+		if name != "" {
+			err := unstructured.SetNestedField(serverMap, rename(name), "tls", "credentialName")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return unstructured.SetNestedSlice(gateway.Object, servers, "spec", "servers")
+}
+
+// CredentialName returns the name the host Gateway references the secret of a virtual
+// Certificate by. Secrets that are copied into the namespace of the ingress gateway are named
+// after the virtual secret, its namespace and the vcluster, as the namespace is shared.
+func CredentialName(ctx *synccontext.SyncContext, vName types.NamespacedName, copyNamespace string) string {
+	if copyNamespace != "" {
+		return translate.SafeConcatName(vName.Name, "x", vName.Namespace, "x", translate.VClusterName)
+	}
+
+	return naming.HostName(ctx, naming.Secret, vName.Name, vName.Namespace).Name
+}
+
+// CertificateSecret checks if the virtual secret is the secret of a virtual Certificate
+func CertificateSecret(ctx context.Context, virtualClient client.Client, vName types.NamespacedName) (bool, error) {
+	certificateList := &certmanagerv1.CertificateList{}
+	err := virtualClient.List(ctx, certificateList, client.MatchingFields{secrets.IndexByCertificateSecret: vName.String()})
+	if err != nil {
+		return false, fmt.Errorf("list certificates of secret %s: %w", vName, err)
+	}
+
+	return meta.LenList(certificateList) > 0, nil
+}
+
+// gatewaySecret checks if a virtual Gateway in the namespace of the virtual secret references it
+func gatewaySecret(ctx context.Context, virtualClient client.Client, vName types.NamespacedName) (bool, error) {
+	gatewayList := &unstructured.UnstructuredList{}
+	gatewayList.SetGroupVersionKind(GatewayGVK.GroupVersion().WithKind(GatewayGVK.Kind + "List"))
+	err := virtualClient.List(ctx, gatewayList, client.InNamespace(vName.Namespace))
+	if err != nil {
+		return false, fmt.Errorf("list gateways in namespace %s: %w", vName.Namespace, err)
+	}
+
+	for i := range gatewayList.Items {
+		for _, name := range CredentialNames(&gatewayList.Items[i]) {
+			if name == vName.Name {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
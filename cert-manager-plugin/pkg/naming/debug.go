@@ -0,0 +1,106 @@
+package naming
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DebugEntry describes the host name a virtual object maps to
+type DebugEntry struct {
+	Kind             Kind   `json:"kind"`
+	VirtualName      string `json:"virtualName"`
+	VirtualNamespace string `json:"virtualNamespace"`
+	HostName         string `json:"hostName"`
+	HostNamespace    string `json:"hostNamespace"`
+	Strategy         string `json:"strategy"`
+	Reason           string `json:"reason"`
+}
+
+// NewDebugHandler returns a handler that shows the host names of virtual objects. It is
+// queried with the parameters kind, namespace and optionally name. Without a name all
+// objects of the kind within the namespace are listed.
+func NewDebugHandler(virtualClient client.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := Kind(r.URL.Query().Get("kind"))
+		namespace := r.URL.Query().Get("namespace")
+		name := r.URL.Query().Get("name")
+		if namespace == "" {
+			http.Error(w, "query parameter namespace is required", http.StatusBadRequest)
+			return
+		}
+
+		kinds := Kinds
+		if kind != "" {
+			kinds = []Kind{kind}
+		}
+
+		entries := []DebugEntry{}
+		for _, kind := range kinds {
+			names := []string{name}
+			if name == "" {
+				var err error
+				names, err = listNames(r, virtualClient, kind, namespace)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			for _, name := range names {
+				result := Explain(nil, kind, name, namespace)
+				entries = append(entries, DebugEntry{
+					Kind:             kind,
+					VirtualName:      name,
+					VirtualNamespace: namespace,
+					HostName:         result.Name,
+					HostNamespace:    result.Namespace,
+					Strategy:         Default.Name(),
+					Reason:           result.Reason,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(entries)
+	})
+}
+
+func listNames(r *http.Request, virtualClient client.Client, kind Kind, namespace string) ([]string, error) {
+	var list client.ObjectList
+	switch kind {
+	case Certificate:
+		list = &certmanagerv1.CertificateList{}
+	case Issuer:
+		list = &certmanagerv1.IssuerList{}
+	case Secret:
+		list = &corev1.SecretList{}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	err := virtualClient.List(r.Context(), list, client.InNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", kind, err)
+	}
+
+	names := []string{}
+	err = meta.EachListItem(list, func(obj runtime.Object) error {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+
+		names = append(names, accessor.GetName())
+		return nil
+	})
+	return names, err
+}
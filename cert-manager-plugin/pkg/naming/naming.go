@@ -0,0 +1,185 @@
+// Package naming holds the naming strategy that translates the names of virtual
+// Certificates, Issuers and Secrets into host names. All syncers, mappers and hooks
+// of the plugin translate names through this package, so that a virtual object
+// always maps to the same host name regardless of the caller.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Kind is the kind of object a name is translated for
+type Kind string
+
+const (
+	Certificate Kind = "Certificate"
+	Issuer      Kind = "Issuer"
+	Secret      Kind = "Secret"
+)
+
+// Kinds are all kinds the naming strategy translates names for
+var Kinds = []Kind{Certificate, Issuer, Secret}
+
+const (
+	StrategyDefault     = "default"
+	StrategyPredictable = "predictable"
+)
+
+// maxNameLength is the maximum length of the names of Certificates, Issuers and Secrets, which
+// are DNS subdomains
+const maxNameLength = 253
+
+// Result is a translated host name together with the reason why it was chosen
+type Result struct {
+	types.NamespacedName
+
+	// Reason explains how the host name was derived from the virtual name
+	Reason string
+}
+
+// Strategy translates the names of virtual objects into host names
+type Strategy interface {
+	// Name returns the name of the strategy
+	Name() string
+
+	// HostName translates the virtual name of an object of the given kind into the host name
+	HostName(ctx *synccontext.SyncContext, kind Kind, vName, vNamespace string) Result
+}
+
+var (
+	// Default is the strategy used by the plugin
+	Default Strategy = &defaultStrategy{}
+
+	// fallbackCtx is used for translations without a sync context
+	fallbackCtx *synccontext.SyncContext
+)
+
+// Init sets the default strategy and the context that is used for translations
+// that happen outside a sync, e.g. within index functions
+func Init(ctx *synccontext.RegisterContext, strategy string) error {
+	err := SetStrategy(strategy)
+	if err != nil {
+		return err
+	}
+
+	fallbackCtx = ctx.ToSyncContext("naming")
+	return nil
+}
+
+// SetStrategy sets the default strategy without a context, e.g. for subcommands that translate
+// names outside of the running plugin
+func SetStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyDefault:
+		Default = &defaultStrategy{}
+	case StrategyPredictable:
+		Default = &predictableStrategy{}
+	default:
+		return fmt.Errorf("unknown naming strategy %q", strategy)
+	}
+
+	return nil
+}
+
+// HostName translates the virtual name into the host name with the default strategy
+func HostName(ctx *synccontext.SyncContext, kind Kind, vName, vNamespace string) types.NamespacedName {
+	return Explain(ctx, kind, vName, vNamespace).NamespacedName
+}
+
+// Explain translates the virtual name into the host name with the default strategy and
+// returns the reason for the chosen name
+func Explain(ctx *synccontext.SyncContext, kind Kind, vName, vNamespace string) Result {
+	if vName == "" {
+		return Result{}
+	}
+	if ctx == nil {
+		ctx = fallbackCtx
+	}
+
+	return Default.HostName(ctx, kind, vName, vNamespace)
+}
+
+// PhysicalNameFunc returns a name translation func for the given kind that can be used
+// for generic mappers
+func PhysicalNameFunc(kind Kind) func(ctx *synccontext.SyncContext, vName, vNamespace string, _ client.Object) types.NamespacedName {
+	return func(ctx *synccontext.SyncContext, vName, vNamespace string, _ client.Object) types.NamespacedName {
+		return HostName(ctx, kind, vName, vNamespace)
+	}
+}
+
+// defaultStrategy uses the vcluster name translation for all kinds
+type defaultStrategy struct{}
+
+func (s *defaultStrategy) Name() string {
+	return StrategyDefault
+}
+
+func (s *defaultStrategy) HostName(ctx *synccontext.SyncContext, _ Kind, vName, vNamespace string) Result {
+	return explainTranslate(ctx, vName, vNamespace)
+}
+
+// predictableStrategy joins the virtual name, the virtual namespace and the vcluster name with
+// dots for Certificates and Issuers. Namespace and vcluster names are DNS labels without dots, so
+// the host name is unique and the virtual name can be read off it. Secrets always use the vcluster
+// name translation as the secrets of ingresses are synced by vcluster itself.
+type predictableStrategy struct{}
+
+func (s *predictableStrategy) Name() string {
+	return StrategyPredictable
+}
+
+func (s *predictableStrategy) HostName(ctx *synccontext.SyncContext, kind Kind, vName, vNamespace string) Result {
+	if kind == Secret || !translate.Default.SingleNamespaceTarget() {
+		return explainTranslate(ctx, vName, vNamespace)
+	}
+
+	hostNamespace := translate.Default.HostName(ctx, vName, vNamespace).Namespace
+	suffix := "." + vNamespace + "." + translate.VClusterName
+	if len(vName)+len(suffix) <= maxNameLength {
+		return Result{
+			NamespacedName: types.NamespacedName{Namespace: hostNamespace, Name: vName + suffix},
+			Reason:         "predictable naming strategy: name joins the virtual name, the virtual namespace and the vcluster name with dots",
+		}
+	}
+
+	// the virtual name is cut, so the hash keeps names that share the cut prefix apart
+	digest := sha256.Sum256([]byte(vName))
+	hash := hex.EncodeToString(digest[:])[0:10]
+	prefix := strings.TrimRight(vName[:maxNameLength-len(suffix)-len(hash)-1], ".-")
+	return Result{
+		NamespacedName: types.NamespacedName{Namespace: hostNamespace, Name: prefix + "-" + hash + suffix},
+		Reason:         fmt.Sprintf("predictable naming strategy: joined name exceeds %d characters, so the virtual name is cut and suffixed with %q, the first 10 hex characters of its sha256 hash", maxNameLength, hash),
+	}
+}
+
+func explainTranslate(ctx *synccontext.SyncContext, vName, vNamespace string) Result {
+	hostName := translate.Default.HostName(ctx, vName, vNamespace)
+	if !translate.Default.SingleNamespaceTarget() {
+		return Result{
+			NamespacedName: hostName,
+			Reason:         fmt.Sprintf("multi-namespace mode: name is kept and namespace %q is mapped to host namespace %q", vNamespace, hostName.Namespace),
+		}
+	}
+
+	fullName := strings.Join([]string{vName, "x", vNamespace, "x", translate.VClusterName}, "-")
+	if fullName == hostName.Name {
+		return Result{
+			NamespacedName: hostName,
+			Reason:         "name concatenates the virtual name, the virtual namespace and the vcluster name",
+		}
+	}
+
+	digest := sha256.Sum256([]byte(fullName))
+	return Result{
+		NamespacedName: hostName,
+		Reason:         fmt.Sprintf("concatenated name %q exceeds 63 characters, so it is cut to 52 characters and suffixed with %q, the first 10 hex characters of its sha256 hash", fullName, hex.EncodeToString(digest[:])[0:10]),
+	}
+}
@@ -0,0 +1,195 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	// registers the cert-manager types in the scheme
+	_ "github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func withStrategy(t *testing.T, strategy string, translator translate.Translator) {
+	oldStrategy, oldTranslator, oldVClusterName := Default, translate.Default, translate.VClusterName
+	translate.Default = translator
+	translate.VClusterName = "vcluster"
+	t.Cleanup(func() {
+		Default, translate.Default, translate.VClusterName = oldStrategy, oldTranslator, oldVClusterName
+	})
+
+	err := SetStrategy(strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetStrategy(t *testing.T) {
+	withStrategy(t, StrategyDefault, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	err := SetStrategy("short")
+	if err == nil {
+		t.Errorf("expected unknown strategy to fail")
+	}
+	if Default.Name() != StrategyDefault {
+		t.Errorf("expected strategy to be kept, got %s", Default.Name())
+	}
+}
+
+func TestDefaultStrategy(t *testing.T) {
+	withStrategy(t, StrategyDefault, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	result := Explain(nil, Certificate, "web", "shop")
+	if result.Name != "web-x-shop-x-vcluster" || result.Namespace != "vcluster" {
+		t.Errorf("unexpected host name %s", result.NamespacedName)
+	}
+	if !strings.Contains(result.Reason, "concatenates") {
+		t.Errorf("unexpected reason %q", result.Reason)
+	}
+
+	long := strings.Repeat("a", 60)
+	result = Explain(nil, Issuer, long, "shop")
+	if len(result.Name) != 63 || !strings.Contains(result.Reason, "exceeds 63 characters") {
+		t.Errorf("expected a shortened name, got %s (%s)", result.Name, result.Reason)
+	}
+
+	if result := Explain(nil, Certificate, "", "shop"); result.Name != "" {
+		t.Errorf("expected empty name for empty virtual name, got %s", result.Name)
+	}
+}
+
+func TestPredictableStrategy(t *testing.T) {
+	withStrategy(t, StrategyPredictable, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	tests := []struct {
+		name       string
+		kind       Kind
+		vName      string
+		vNamespace string
+		expected   string
+	}{
+		{
+			name:       "certificate",
+			kind:       Certificate,
+			vName:      "web",
+			vNamespace: "shop",
+			expected:   "web.shop.vcluster",
+		},
+		{
+			name:       "issuer",
+			kind:       Issuer,
+			vName:      "letsencrypt",
+			vNamespace: "shop",
+			expected:   "letsencrypt.shop.vcluster",
+		},
+		{
+			// the default strategy shortens names longer than 63 characters with a hash
+			name:       "long name",
+			kind:       Certificate,
+			vName:      strings.Repeat("a", 60),
+			vNamespace: "shop",
+			expected:   strings.Repeat("a", 60) + ".shop.vcluster",
+		},
+		{
+			name:       "secret",
+			kind:       Secret,
+			vName:      "web-tls",
+			vNamespace: "shop",
+			expected:   "web-tls-x-shop-x-vcluster",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Explain(nil, test.kind, test.vName, test.vNamespace)
+			if result.Name != test.expected || result.Namespace != "vcluster" {
+				t.Errorf("expected host name vcluster/%s, got %s", test.expected, result.NamespacedName)
+			}
+			if result.Reason == "" {
+				t.Errorf("expected a reason")
+			}
+		})
+	}
+}
+
+func TestPredictableStrategyCollisions(t *testing.T) {
+	withStrategy(t, StrategyPredictable, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	// the default strategy maps both to web-x-shop-x-x-x-vcluster
+	first := HostName(nil, Certificate, "web-x-shop", "x")
+	second := HostName(nil, Certificate, "web", "shop-x-x")
+	if first == second {
+		t.Errorf("expected different host names, got %s for both", first)
+	}
+}
+
+func TestPredictableStrategyMaxLength(t *testing.T) {
+	withStrategy(t, StrategyPredictable, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	first := Explain(nil, Certificate, strings.Repeat("a", 250)+"-1", "shop")
+	second := Explain(nil, Certificate, strings.Repeat("a", 250)+"-2", "shop")
+	for _, result := range []Result{first, second} {
+		if errs := validation.IsDNS1123Subdomain(result.Name); len(errs) > 0 {
+			t.Errorf("invalid host name %s: %v", result.Name, errs)
+		}
+		if !strings.HasSuffix(result.Name, ".shop.vcluster") || !strings.Contains(result.Reason, "exceeds 253 characters") {
+			t.Errorf("unexpected host name %s (%s)", result.Name, result.Reason)
+		}
+	}
+	if first.Name == second.Name {
+		t.Errorf("expected different host names, got %s for both", first.Name)
+	}
+}
+
+func TestMultiNamespace(t *testing.T) {
+	for _, strategy := range []string{StrategyDefault, StrategyPredictable} {
+		t.Run(strategy, func(t *testing.T) {
+			withStrategy(t, strategy, translate.NewMultiNamespaceTranslator("vcluster"))
+
+			result := Explain(nil, Certificate, "web", "shop")
+			if result.Name != "web" || result.Namespace == "shop" || result.Namespace == "" {
+				t.Errorf("expected the name to be kept in the host namespace, got %s", result.NamespacedName)
+			}
+			if !strings.Contains(result.Reason, "multi-namespace mode") {
+				t.Errorf("unexpected reason %q", result.Reason)
+			}
+		})
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	withStrategy(t, StrategyPredictable, translate.NewSingleNamespaceTranslator("vcluster"))
+
+	certificate := &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}}
+	handler := NewDebugHandler(testingutil.NewFakeClient(scheme.Scheme, certificate))
+
+	request := httptest.NewRequest(http.MethodGet, "/debug/names?namespace=shop&kind=Certificate", nil).WithContext(context.Background())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	entries := []DebugEntry{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].VirtualName != "web" || entries[0].HostName != "web.shop.vcluster" || entries[0].Strategy != StrategyPredictable {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/names?kind=Certificate", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected a request without namespace to fail, got %d", recorder.Code)
+	}
+}
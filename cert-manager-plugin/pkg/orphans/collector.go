@@ -0,0 +1,257 @@
+// Package orphans collects host Certificates, Issuers and Secrets whose virtual objects are
+// gone. The syncers only clean up host objects they see through their watches, so objects are
+// left behind if the plugin was down while the virtual object was deleted. The collector lists
+// the host objects periodically and reports or deletes the ones that stay orphaned for longer
+// than the grace period.
+package orphans
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ReasonOrphaned is the reason of the events that report orphans
+	ReasonOrphaned = "Orphaned"
+
+	// ReasonOrphanDeleted is the reason of the events on deleted orphans
+	ReasonOrphanDeleted = "OrphanDeleted"
+)
+
+// Collector periodically collects orphaned host objects
+type Collector struct {
+	cfg    config.OrphanCollection
+	events record.EventRecorder
+	now    func() time.Time
+
+	m sync.Mutex
+
+	// orphanedSince holds the time every orphan was first seen, so that the grace period
+	// starts when the virtual object went missing
+	orphanedSince map[string]time.Time
+
+	// reported holds the orphans that were reported already
+	reported map[string]bool
+}
+
+// New creates a new orphan collector
+func New(ctx *synccontext.RegisterContext, cfg config.OrphanCollection) *Collector {
+	return &Collector{
+		cfg:           cfg,
+		events:        ctx.PhysicalManager.GetEventRecorderFor(constants.PluginName),
+		now:           time.Now,
+		orphanedSince: map[string]time.Time{},
+		reported:      map[string]bool{},
+	}
+}
+
+func (c *Collector) Name() string {
+	return "orphan-collector"
+}
+
+var _ syncertypes.ControllerStarter = &Collector{}
+
+// Register starts the periodic collection
+func (c *Collector) Register(ctx *synccontext.RegisterContext) error {
+	syncCtx := ctx.ToSyncContext("orphan-collector")
+	go wait.UntilWithContext(ctx.Context, func(_ context.Context) {
+		err := c.Collect(syncCtx)
+		if err != nil {
+			syncCtx.Log.Errorf("collect orphans: %v", err)
+		}
+	}, c.cfg.Interval.Duration)
+
+	return nil
+}
+
+// hostKinds are the kinds of host objects that are collected. The virtual objects are of the
+// same kind.
+var hostKinds = []struct {
+	list func() client.ObjectList
+	obj  func() client.Object
+}{
+	{list: func() client.ObjectList { return &certmanagerv1.CertificateList{} }, obj: func() client.Object { return &certmanagerv1.Certificate{} }},
+	{list: func() client.ObjectList { return &certmanagerv1.IssuerList{} }, obj: func() client.Object { return &certmanagerv1.Issuer{} }},
+	{list: func() client.ObjectList { return &corev1.SecretList{} }, obj: func() client.Object { return &corev1.Secret{} }},
+}
+
+// Collect runs a single collection
+func (c *Collector) Collect(ctx *synccontext.SyncContext) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	seen := map[string]bool{}
+	for _, kind := range hostKinds {
+		list := kind.list()
+		err := ctx.PhysicalClient.List(ctx, list)
+		if err != nil {
+			return fmt.Errorf("list host objects: %w", err)
+		}
+
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			pObj := obj.(client.Object)
+			if !Managed(ctx, pObj) {
+				continue
+			}
+
+			orphaned, err := Orphaned(ctx, pObj, kind.obj())
+			if err != nil {
+				return err
+			} else if !orphaned {
+				continue
+			}
+
+			key := c.key(pObj)
+			seen[key] = true
+			err = c.collect(ctx, key, pObj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// forget objects that aren't orphaned anymore
+	for key := range c.orphanedSince {
+		if !seen[key] {
+			delete(c.orphanedSince, key)
+			delete(c.reported, key)
+		}
+	}
+
+	return nil
+}
+
+// Managed checks if the host object was created by the plugin. All host Certificates and
+// Issuers vcluster manages are the plugin's, but vcluster itself syncs secrets, e.g. the ones
+// of pods. The plugin only controls the secrets it synced for Certificates and Issuers, which
+// carry the translated controller label of their virtual secret, so other secrets are left alone.
+func Managed(ctx *synccontext.SyncContext, pObj client.Object) bool {
+	if !translate.Default.IsManaged(ctx, pObj) {
+		return false
+	} else if _, ok := pObj.(*corev1.Secret); !ok {
+		return true
+	}
+
+	return pObj.GetLabels()[translate.HostLabel(translate.ControllerLabel)] == constants.PluginName
+}
+
+// Orphaned checks if the virtual object the host object was created for is gone. vObj is an
+// empty object of the virtual kind.
+func Orphaned(ctx *synccontext.SyncContext, pObj, vObj client.Object) (bool, error) {
+	annotations := pObj.GetAnnotations()
+	vName := types.NamespacedName{Namespace: annotations[translate.NamespaceAnnotation], Name: annotations[translate.NameAnnotation]}
+	if vName.Name == "" {
+		// the virtual object is unknown
+		return false, nil
+	}
+
+	err := ctx.VirtualClient.Get(ctx, vName, vObj)
+	if kerrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get virtual object %s: %w", vName, err)
+	}
+
+	// the virtual object was recreated in the meantime
+	uid := annotations[translate.UIDAnnotation]
+	return uid != "" && uid != string(vObj.GetUID()), nil
+}
+
+// collect reports or deletes the orphan once the grace period is over
+func (c *Collector) collect(ctx *synccontext.SyncContext, key string, pObj client.Object) error {
+	now := c.now()
+	since, ok := c.orphanedSince[key]
+	if !ok {
+		since = now
+		c.orphanedSince[key] = since
+	}
+
+	// objects that were just created might not have a virtual object yet
+	gracePeriod := c.cfg.GracePeriod.Duration
+	if now.Sub(since) < gracePeriod || now.Sub(pObj.GetCreationTimestamp().Time) < gracePeriod {
+		return nil
+	}
+
+	if c.cfg.Action != config.OrphanActionDelete {
+		if !c.reported[key] {
+			c.reported[key] = true
+			ctx.Log.Infof("host %s is orphaned since %s", key, since.Format(time.RFC3339))
+			c.events.Eventf(pObj, corev1.EventTypeWarning, ReasonOrphaned, "Virtual object %s/%s is gone since %s", pObj.GetAnnotations()[translate.NamespaceAnnotation], pObj.GetAnnotations()[translate.NameAnnotation], since.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	ctx.Log.Infof("delete host %s, because it's orphaned since %s", key, since.Format(time.RFC3339))
+	err := ctx.PhysicalClient.Delete(ctx, pObj)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("delete orphan %s: %w", key, err)
+	}
+
+	// cert-manager doesn't mark the secret it issued, so it's deleted with its certificate
+	if pCertificate, ok := pObj.(*certmanagerv1.Certificate); ok {
+		err = c.deleteIssuedSecret(ctx, pCertificate)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.events.Eventf(pObj, corev1.EventTypeNormal, ReasonOrphanDeleted, "Deleted, because virtual object %s/%s is gone", pObj.GetAnnotations()[translate.NamespaceAnnotation], pObj.GetAnnotations()[translate.NameAnnotation])
+	delete(c.orphanedSince, key)
+	delete(c.reported, key)
+	return nil
+}
+
+// deleteIssuedSecret deletes the secret of the deleted certificate unless another host
+// certificate shares it
+func (c *Collector) deleteIssuedSecret(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate) error {
+	certificateList := &certmanagerv1.CertificateList{}
+	err := ctx.PhysicalClient.List(ctx, certificateList, client.InNamespace(pCertificate.Namespace))
+	if err != nil {
+		return err
+	}
+	for _, other := range certificateList.Items {
+		if other.Name != pCertificate.Name && other.Spec.SecretName == pCertificate.Spec.SecretName {
+			return nil
+		}
+	}
+
+	ctx.Log.Infof("delete host secret %s/%s of orphaned certificate %s", pCertificate.Namespace, pCertificate.Spec.SecretName, pCertificate.Name)
+	err = ctx.PhysicalClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: pCertificate.Namespace, Name: pCertificate.Spec.SecretName}})
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *Collector) key(pObj client.Object) string {
+	kind := "secret"
+	switch pObj.(type) {
+	case *certmanagerv1.Certificate:
+		kind = "certificate"
+	case *certmanagerv1.Issuer:
+		kind = "issuer"
+	}
+
+	return kind + " " + pObj.GetNamespace() + "/" + pObj.GetName()
+}
@@ -0,0 +1,180 @@
+package orphans
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const gracePeriod = time.Hour
+
+// newCollector returns a collector whose clock can be advanced with the returned func
+func newCollector(action string) (*Collector, *record.FakeRecorder, func(time.Duration)) {
+	events := record.NewFakeRecorder(10)
+	now := time.Now()
+	collector := &Collector{
+		cfg: config.OrphanCollection{
+			GracePeriod: metav1.Duration{Duration: gracePeriod},
+			Action:      action,
+		},
+		events:        events,
+		now:           func() time.Time { return now },
+		orphanedSince: map[string]time.Time{},
+		reported:      map[string]bool{},
+	}
+
+	return collector, events, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+// newCertificates returns a virtual certificate and the host certificate and secret that were
+// created for it
+func newCertificates(name string) (*certmanagerv1.Certificate, *certmanagerv1.Certificate, *corev1.Secret) {
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID("uid-" + name)},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: name + "-tls"},
+	}
+	pCertificate := translate.HostMetadata(vCertificate, naming.HostName(nil, naming.Certificate, name, "shop"))
+	pCertificate.Spec.SecretName = naming.HostName(nil, naming.Secret, vCertificate.Spec.SecretName, "shop").Name
+	pCertificate.CreationTimestamp = metav1.NewTime(time.Now().Add(-24 * time.Hour))
+
+	pSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: pCertificate.Spec.SecretName, Namespace: pCertificate.Namespace}}
+	return vCertificate, pCertificate, pSecret
+}
+
+func exists(t *testing.T, c client.Client, obj client.Object) bool {
+	t.Helper()
+
+	err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), obj.DeepCopyObject().(client.Object))
+	if kerrors.IsNotFound(err) {
+		return false
+	} else if err != nil {
+		t.Fatalf("get %s: %v", obj.GetName(), err)
+	}
+
+	return true
+}
+
+func TestCollectDeletesOrphansAfterGracePeriod(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vCertificate, pCertificate, pSecret := newCertificates("web")
+	_, orphan, orphanSecret := newCertificates("shop")
+	ctx := fixtures.NewSyncContext([]runtime.Object{vCertificate}, []runtime.Object{pCertificate, pSecret, orphan, orphanSecret})
+	collector, events, advance := newCollector(config.OrphanActionDelete)
+
+	err := collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if !exists(t, ctx.PhysicalClient, orphan) {
+		t.Fatalf("expected the orphan to be kept during the grace period")
+	}
+
+	advance(gracePeriod)
+	err = collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if exists(t, ctx.PhysicalClient, orphan) || exists(t, ctx.PhysicalClient, orphanSecret) {
+		t.Errorf("expected the orphan and its secret to be deleted")
+	}
+	if !exists(t, ctx.PhysicalClient, pCertificate) || !exists(t, ctx.PhysicalClient, pSecret) {
+		t.Errorf("expected the certificate with virtual object and its secret to be kept")
+	}
+	if event := <-events.Events; !strings.Contains(event, ReasonOrphanDeleted) {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestCollectReportsOrphansOnce(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	_, orphan, orphanSecret := newCertificates("shop")
+	ctx := fixtures.NewSyncContext(nil, []runtime.Object{orphan, orphanSecret})
+	collector, events, advance := newCollector(config.OrphanActionReport)
+
+	for i := 0; i < 3; i++ {
+		err := collector.Collect(ctx)
+		if err != nil {
+			t.Fatalf("collect: %v", err)
+		}
+		advance(gracePeriod)
+	}
+
+	if !exists(t, ctx.PhysicalClient, orphan) {
+		t.Errorf("expected the orphan to be kept")
+	}
+	if len(events.Events) != 1 {
+		t.Fatalf("expected the orphan to be reported once, got %d events", len(events.Events))
+	}
+	if event := <-events.Events; !strings.Contains(event, ReasonOrphaned) || !strings.Contains(event, "shop/shop") {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestCollectTreatsRecreatedVirtualObjectAsOrphan(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vCertificate, pCertificate, pSecret := newCertificates("web")
+	vCertificate.UID = "recreated"
+	ctx := fixtures.NewSyncContext([]runtime.Object{vCertificate}, []runtime.Object{pCertificate, pSecret})
+	collector, _, advance := newCollector(config.OrphanActionDelete)
+
+	err := collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	advance(gracePeriod)
+	err = collector.Collect(ctx)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	if exists(t, ctx.PhysicalClient, pCertificate) {
+		t.Errorf("expected the host certificate of the deleted virtual object to be collected")
+	}
+}
+
+func TestCollectOnlyPluginSecrets(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	// vcluster syncs the secrets of pods itself, so they're left to vcluster
+	vPodSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db-password", Namespace: "shop", UID: "uid-db-password"}}
+	pPodSecret := translate.HostMetadata(vPodSecret, naming.HostName(nil, naming.Secret, vPodSecret.Name, "shop"))
+	pPodSecret.CreationTimestamp = metav1.NewTime(time.Now().Add(-24 * time.Hour))
+
+	vToken := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: "shop", UID: "uid-vault-token", Labels: map[string]string{translate.ControllerLabel: constants.PluginName}}}
+	pToken := translate.HostMetadata(vToken, naming.HostName(nil, naming.Secret, vToken.Name, "shop"))
+	pToken.CreationTimestamp = metav1.NewTime(time.Now().Add(-24 * time.Hour))
+
+	ctx := fixtures.NewSyncContext(nil, []runtime.Object{pPodSecret, pToken})
+	collector, _, advance := newCollector(config.OrphanActionDelete)
+	for i := 0; i < 2; i++ {
+		err := collector.Collect(ctx)
+		if err != nil {
+			t.Fatalf("collect: %v", err)
+		}
+		advance(gracePeriod)
+	}
+
+	if !exists(t, ctx.PhysicalClient, pPodSecret) {
+		t.Errorf("expected the secret vcluster synced to be kept")
+	}
+	if exists(t, ctx.PhysicalClient, pToken) {
+		t.Errorf("expected the orphaned secret of the plugin to be deleted")
+	}
+}
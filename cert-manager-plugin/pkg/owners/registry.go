@@ -0,0 +1,282 @@
+// Package owners holds a reverse mapping registry that answers which virtual object owns
+// a given host object. The registry is kept up to date from the watch events of the
+// virtual owner objects, so lookups don't need to query the virtual cluster.
+package owners
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	KindCertificate = "Certificate"
+	KindIngress     = "Ingress"
+	KindIssuer      = "Issuer"
+	KindRoute       = "Route"
+	KindSecret      = "Secret"
+)
+
+// Reference is a host object that is owned by a virtual object
+type Reference struct {
+	// Host is the name of the owned host object
+	Host types.NamespacedName
+
+	// Target is the virtual name the host object maps to
+	Target types.NamespacedName
+}
+
+// Owner is a virtual object that owns a host object
+type Owner struct {
+	// Kind is the kind of the owning virtual object
+	Kind string
+
+	// Object is the name of the owning virtual object
+	Object types.NamespacedName
+
+	// UID of the owning virtual object
+	UID types.UID
+
+	// Target is the virtual name the host object maps to
+	Target types.NamespacedName
+
+	// CreationTimestamp of the owning virtual object, used to order multiple owners
+	CreationTimestamp metav1.Time
+}
+
+// Index describes how virtual objects of a kind own host objects
+type Index struct {
+	// OwnerKind is the kind of the virtual objects that own host objects, e.g. Ingress
+	OwnerKind string
+
+	// HostKind is the kind of the owned host objects, e.g. Certificate
+	HostKind string
+
+	// References returns the host objects owned by the virtual object
+	References func(obj client.Object) []Reference
+}
+
+type hostKey struct {
+	kind string
+	name types.NamespacedName
+}
+
+type ownerKey struct {
+	kind string
+	name types.NamespacedName
+}
+
+type indexKey struct {
+	ownerKind string
+	hostKind  string
+}
+
+// Registry maps host objects to the virtual objects that own them
+type Registry struct {
+	m sync.RWMutex
+
+	// owners holds the sorted owners of every host object
+	owners map[hostKey][]Owner
+
+	// references holds the host objects every virtual object owns
+	references map[ownerKey][]hostKey
+
+	// indices are the registered indices by owner and host kind
+	indices map[indexKey]Index
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		owners:     map[hostKey][]Owner{},
+		references: map[ownerKey][]hostKey{},
+		indices:    map[indexKey]Index{},
+	}
+}
+
+// Watch registers the index and keeps the registry up to date from the watch events of
+// the virtual objects. Objects of a kind can own host objects of several kinds through
+// separate indices. Watching the same owner and host kind twice is a no-op.
+func (r *Registry) Watch(ctx *synccontext.RegisterContext, obj client.Object, index Index) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	iKey := indexKey{ownerKind: index.OwnerKind, hostKind: index.HostKind}
+	if _, ok := r.indices[iKey]; ok {
+		return nil
+	}
+
+	informer, err := ctx.VirtualManager.GetCache().GetInformer(ctx.Context, obj)
+	if err != nil {
+		return fmt.Errorf("get informer for %s: %w", index.OwnerKind, err)
+	}
+
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if vObj, ok := obj.(client.Object); ok {
+				r.Update(index, vObj)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if vObj, ok := newObj.(client.Object); ok {
+				r.Update(index, vObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if vObj, ok := obj.(client.Object); ok {
+				r.Delete(index.OwnerKind, vObj)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("add event handler for %s: %w", index.OwnerKind, err)
+	}
+
+	r.indices[iKey] = index
+	return nil
+}
+
+// Update replaces the references of the virtual object to host objects of the index's host kind
+// with the ones returned by the index
+func (r *Registry) Update(index Index, vObj client.Object) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	key := ownerKey{kind: index.OwnerKind, name: types.NamespacedName{Namespace: vObj.GetNamespace(), Name: vObj.GetName()}}
+	r.deleteLocked(key, index.HostKind)
+
+	references := index.References(vObj)
+	if len(references) == 0 {
+		return
+	}
+
+	hostKeys := make([]hostKey, 0, len(references))
+	for _, reference := range references {
+		hKey := hostKey{kind: index.HostKind, name: reference.Host}
+		r.owners[hKey] = insertSorted(r.owners[hKey], Owner{
+			Kind:              index.OwnerKind,
+			Object:            key.name,
+			UID:               vObj.GetUID(),
+			Target:            reference.Target,
+			CreationTimestamp: vObj.GetCreationTimestamp(),
+		})
+		hostKeys = append(hostKeys, hKey)
+	}
+	r.references[key] = append(r.references[key], hostKeys...)
+}
+
+// Delete removes all references of the virtual object
+func (r *Registry) Delete(ownerKind string, vObj client.Object) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.deleteLocked(ownerKey{kind: ownerKind, name: types.NamespacedName{Namespace: vObj.GetNamespace(), Name: vObj.GetName()}}, "")
+}
+
+// deleteLocked removes the references of the owner to host objects of the host kind, or all
+// references if the host kind is empty
+func (r *Registry) deleteLocked(key ownerKey, hostKind string) {
+	remaining := r.references[key][:0:0]
+	for _, hKey := range r.references[key] {
+		if hostKind != "" && hKey.kind != hostKind {
+			remaining = append(remaining, hKey)
+			continue
+		}
+
+		owners := r.owners[hKey][:0:0]
+		for _, owner := range r.owners[hKey] {
+			if owner.Kind != key.kind || owner.Object != key.name {
+				owners = append(owners, owner)
+			}
+		}
+
+		if len(owners) == 0 {
+			delete(r.owners, hKey)
+		} else {
+			r.owners[hKey] = owners
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(r.references, key)
+	} else {
+		r.references[key] = remaining
+	}
+}
+
+// Owners returns all owners of the host object, optionally filtered by the owner kinds. The
+// owners are ordered by creation timestamp, oldest first, then by kind and name.
+func (r *Registry) Owners(hostKind string, pName types.NamespacedName, ownerKinds ...string) []Owner {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	owners := []Owner{}
+	for _, owner := range r.owners[hostKey{kind: hostKind, name: pName}] {
+		if len(ownerKinds) > 0 && !contains(ownerKinds, owner.Kind) {
+			continue
+		}
+
+		owners = append(owners, owner)
+	}
+
+	return owners
+}
+
+// Owner returns the first owner of the host object, see Owners for the order
+func (r *Registry) Owner(hostKind string, pName types.NamespacedName, ownerKinds ...string) (Owner, bool) {
+	owners := r.Owners(hostKind, pName, ownerKinds...)
+	if len(owners) == 0 {
+		return Owner{}, false
+	}
+
+	return owners[0], true
+}
+
+// Sort sorts the owners in the order returned by Owners
+func Sort(owners []Owner) []Owner {
+	sort.SliceStable(owners, func(i, j int) bool {
+		return less(owners[i], owners[j])
+	})
+
+	return owners
+}
+
+func insertSorted(owners []Owner, owner Owner) []Owner {
+	idx := sort.Search(len(owners), func(i int) bool {
+		return less(owner, owners[i])
+	})
+
+	owners = append(owners, Owner{})
+	copy(owners[idx+1:], owners[idx:])
+	owners[idx] = owner
+	return owners
+}
+
+func less(a, b Owner) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	} else if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+
+	return a.Object.String() < b.Object.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+package owners
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var hostSecret = types.NamespacedName{Namespace: "vcluster", Name: "web-tls-x-shop-x-vcluster"}
+
+// secretIndex lets every object own the host secret named by its "secret" annotation
+func secretIndex(kind string) Index {
+	return Index{
+		OwnerKind: kind,
+		HostKind:  KindSecret,
+		References: func(obj client.Object) []Reference {
+			name := obj.GetAnnotations()["secret"]
+			if name == "" {
+				return nil
+			}
+
+			return []Reference{{
+				Host:   types.NamespacedName{Namespace: hostSecret.Namespace, Name: name},
+				Target: types.NamespacedName{Namespace: obj.GetNamespace(), Name: "web-tls"},
+			}}
+		},
+	}
+}
+
+func newOwner(name string, created time.Time, secret string) client.Object {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "shop",
+		UID:               types.UID(name),
+		CreationTimestamp: metav1.NewTime(created),
+		Annotations:       map[string]string{"secret": secret},
+	}}
+}
+
+func names(owners []Owner) []string {
+	result := []string{}
+	for _, owner := range owners {
+		result = append(result, owner.Kind+" "+owner.Object.Name)
+	}
+
+	return result
+}
+
+func expectOwners(t *testing.T, registry *Registry, expected []string, ownerKinds ...string) {
+	t.Helper()
+
+	actual := names(registry.Owners(KindSecret, hostSecret, ownerKinds...))
+	if len(actual) != len(expected) {
+		t.Fatalf("expected owners %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected owners %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestOwnerOrdering(t *testing.T) {
+	now := time.Now()
+	registry := NewRegistry()
+	registry.Update(secretIndex(KindIssuer), newOwner("ca", now, hostSecret.Name))
+	registry.Update(secretIndex(KindCertificate), newOwner("web", now.Add(time.Minute), hostSecret.Name))
+	registry.Update(secretIndex(KindCertificate), newOwner("api", now.Add(-time.Minute), hostSecret.Name))
+	registry.Update(secretIndex(KindCertificate), newOwner("shop", now, hostSecret.Name))
+
+	// oldest first, then by kind and name
+	expectOwners(t, registry, []string{"Certificate api", "Certificate shop", "Issuer ca", "Certificate web"})
+	expectOwners(t, registry, []string{"Issuer ca"}, KindIssuer)
+
+	owner, ok := registry.Owner(KindSecret, hostSecret)
+	if !ok || owner.Object.Name != "api" || owner.UID != "api" || owner.Target.Name != "web-tls" {
+		t.Errorf("unexpected first owner %v", owner)
+	}
+
+	sorted := Sort([]Owner{
+		{Kind: KindIssuer, Object: types.NamespacedName{Name: "b"}},
+		{Kind: KindCertificate, Object: types.NamespacedName{Name: "b"}},
+		{Kind: KindCertificate, Object: types.NamespacedName{Name: "a"}},
+	})
+	if actual := names(sorted); actual[0] != "Certificate a" || actual[1] != "Certificate b" || actual[2] != "Issuer b" {
+		t.Errorf("unexpected order %v", actual)
+	}
+}
+
+func TestUpdateReplacesReferences(t *testing.T) {
+	now := time.Now()
+	registry := NewRegistry()
+	registry.Update(secretIndex(KindCertificate), newOwner("web", now, hostSecret.Name))
+	registry.Update(secretIndex(KindCertificate), newOwner("api", now.Add(time.Minute), hostSecret.Name))
+
+	// the object references another secret now
+	registry.Update(secretIndex(KindCertificate), newOwner("web", now, "other"))
+	expectOwners(t, registry, []string{"Certificate api"})
+
+	owner, ok := registry.Owner(KindSecret, types.NamespacedName{Namespace: hostSecret.Namespace, Name: "other"})
+	if !ok || owner.Object.Name != "web" {
+		t.Errorf("expected web to own the other secret, got %v", owner)
+	}
+
+	// the object doesn't reference any secret anymore
+	registry.Update(secretIndex(KindCertificate), newOwner("web", now, ""))
+	if _, ok := registry.Owner(KindSecret, types.NamespacedName{Namespace: hostSecret.Namespace, Name: "other"}); ok {
+		t.Errorf("expected the other secret to have no owner")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	now := time.Now()
+	registry := NewRegistry()
+	registry.Update(secretIndex(KindCertificate), newOwner("web", now, hostSecret.Name))
+	registry.Update(secretIndex(KindIssuer), newOwner("web", now, hostSecret.Name))
+
+	// only the owner of the given kind is removed
+	registry.Delete(KindCertificate, newOwner("web", now, hostSecret.Name))
+	expectOwners(t, registry, []string{"Issuer web"})
+
+	registry.Delete(KindIssuer, newOwner("web", now, ""))
+	expectOwners(t, registry, []string{})
+	if len(registry.owners) != 0 || len(registry.references) != 0 {
+		t.Errorf("expected the registry to be empty, got %v and %v", registry.owners, registry.references)
+	}
+
+	// deleting an unknown object is a no-op
+	registry.Delete(KindIssuer, newOwner("web", now, ""))
+}
+
+func TestUpdateKeepsReferencesOfOtherHostKinds(t *testing.T) {
+	now := time.Now()
+	registry := NewRegistry()
+	certificateIndex := Index{
+		OwnerKind: KindRoute,
+		HostKind:  KindCertificate,
+		References: func(obj client.Object) []Reference {
+			return []Reference{{
+				Host:   types.NamespacedName{Namespace: hostSecret.Namespace, Name: "web-x-shop-x-vcluster"},
+				Target: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+			}}
+		},
+	}
+	hostCertificate := types.NamespacedName{Namespace: hostSecret.Namespace, Name: "web-x-shop-x-vcluster"}
+
+	registry.Update(certificateIndex, newOwner("web", now, hostSecret.Name))
+	registry.Update(secretIndex(KindRoute), newOwner("web", now, hostSecret.Name))
+	expectOwners(t, registry, []string{"Route web"})
+
+	// updating the secrets of the route keeps its certificate
+	registry.Update(secretIndex(KindRoute), newOwner("web", now, ""))
+	expectOwners(t, registry, []string{})
+	if _, ok := registry.Owner(KindCertificate, hostCertificate); !ok {
+		t.Errorf("expected the route to still own its certificate")
+	}
+
+	registry.Update(secretIndex(KindRoute), newOwner("web", now, hostSecret.Name))
+	registry.Delete(KindRoute, newOwner("web", now, ""))
+	if len(registry.owners) != 0 || len(registry.references) != 0 {
+		t.Errorf("expected the registry to be empty, got %v and %v", registry.owners, registry.references)
+	}
+}
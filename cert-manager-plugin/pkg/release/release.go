@@ -0,0 +1,281 @@
+// Package release implements the release mode of the plugin. In release mode nothing is synced.
+// Instead the host Certificates and Issuers of the virtual cluster and the secrets they use are
+// handed over on startup: the vcluster ownership markers are stripped, so neither the plugin nor
+// vcluster deletes them anymore, and the virtual object they belonged to is recorded in the
+// released-from annotation. The issued secrets are kept, so cert-manager doesn't issue again.
+package release
+
+import (
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReasonReleased is the reason of the events on released host objects
+const ReasonReleased = "Released"
+
+// markerLabels and markerAnnotations are the vcluster ownership markers that are stripped
+var (
+	markerLabels      = []string{translate.MarkerLabel, translate.NamespaceLabel, translate.ControllerLabel}
+	markerAnnotations = []string{
+		translate.NameAnnotation,
+		translate.NamespaceAnnotation,
+		translate.UIDAnnotation,
+		translate.KindAnnotation,
+		translate.HostNameAnnotation,
+		translate.HostNamespaceAnnotation,
+		translate.ManagedAnnotationsAnnotation,
+		translate.ManagedLabelsAnnotation,
+	}
+)
+
+// Releaser releases the host objects of the plugin
+type Releaser struct {
+	archiveNamespace string
+	events           record.EventRecorder
+}
+
+// New creates a new releaser
+func New(ctx *synccontext.RegisterContext, cfg config.Release) *Releaser {
+	return &Releaser{
+		archiveNamespace: cfg.ArchiveNamespace,
+		events:           ctx.PhysicalManager.GetEventRecorderFor(constants.PluginName),
+	}
+}
+
+func (r *Releaser) Name() string {
+	return "release"
+}
+
+var _ syncertypes.ControllerStarter = &Releaser{}
+
+// Register releases the host objects once the caches are synced
+func (r *Releaser) Register(ctx *synccontext.RegisterContext) error {
+	return r.Release(ctx.ToSyncContext("release"))
+}
+
+// Release releases all host Certificates and Issuers the plugin manages together with their
+// secrets. It can be run several times, objects that were released already are skipped.
+func (r *Releaser) Release(ctx *synccontext.SyncContext) error {
+	releasedIssuers, releasedCertificates := 0, 0
+	issuerList := &certmanagerv1.IssuerList{}
+	err := ctx.PhysicalClient.List(ctx, issuerList)
+	if err != nil {
+		return fmt.Errorf("list host issuers: %w", err)
+	}
+	for i := range issuerList.Items {
+		pIssuer := &issuerList.Items[i]
+		if !translate.Default.IsManaged(ctx, pIssuer) {
+			continue
+		}
+
+		err = r.releaseIssuer(ctx, pIssuer)
+		if err != nil {
+			return fmt.Errorf("release host issuer %s/%s: %w", pIssuer.Namespace, pIssuer.Name, err)
+		}
+		releasedIssuers++
+	}
+
+	certificateList := &certmanagerv1.CertificateList{}
+	err = ctx.PhysicalClient.List(ctx, certificateList)
+	if err != nil {
+		return fmt.Errorf("list host certificates: %w", err)
+	}
+	for i := range certificateList.Items {
+		pCertificate := &certificateList.Items[i]
+		if !translate.Default.IsManaged(ctx, pCertificate) {
+			continue
+		}
+
+		err = r.releaseCertificate(ctx, pCertificate)
+		if err != nil {
+			return fmt.Errorf("release host certificate %s/%s: %w", pCertificate.Namespace, pCertificate.Name, err)
+		}
+		releasedCertificates++
+	}
+
+	ctx.Log.Infof("released %d host issuers and %d host certificates", releasedIssuers, releasedCertificates)
+	return nil
+}
+
+func (r *Releaser) releaseIssuer(ctx *synccontext.SyncContext, pIssuer *certmanagerv1.Issuer) error {
+	releasedFrom := virtualName(pIssuer)
+
+	// the issuer keeps using its secrets, so they're released in place
+	for _, name := range issuers.SecretNames(&pIssuer.Spec) {
+		err := r.releaseSecret(ctx, types.NamespacedName{Namespace: pIssuer.Namespace, Name: name}, releasedFrom)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.update(ctx, pIssuer, releasedFrom)
+}
+
+func (r *Releaser) releaseCertificate(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate) error {
+	releasedFrom := virtualName(pCertificate)
+
+	secrets := []string{}
+	if keystores := pCertificate.Spec.Keystores; keystores != nil && keystores.JKS != nil {
+		secrets = append(secrets, keystores.JKS.PasswordSecretRef.Name)
+	}
+	if keystores := pCertificate.Spec.Keystores; keystores != nil && keystores.PKCS12 != nil {
+		secrets = append(secrets, keystores.PKCS12.PasswordSecretRef.Name)
+	}
+	if r.archiveNamespace == "" {
+		secrets = append(secrets, pCertificate.Spec.SecretName)
+	}
+	for _, name := range secrets {
+		err := r.releaseSecret(ctx, types.NamespacedName{Namespace: pCertificate.Namespace, Name: name}, releasedFrom)
+		if err != nil {
+			return err
+		}
+	}
+	if r.archiveNamespace == "" {
+		return r.update(ctx, pCertificate, releasedFrom)
+	}
+
+	return r.archive(ctx, pCertificate, releasedFrom)
+}
+
+// archive moves the TLS secret of the certificate into the archive namespace and deletes the
+// certificate. The certificate isn't archived, as cert-manager would keep renewing it there if
+// it references a ClusterIssuer. The secret is copied first and the original is deleted last,
+// so that cert-manager never sees the certificate without its secret and doesn't issue again.
+func (r *Releaser) archive(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate, releasedFrom string) error {
+	pSecret := &corev1.Secret{}
+	err := ctx.PhysicalClient.Get(ctx, types.NamespacedName{Namespace: pCertificate.Namespace, Name: pCertificate.Spec.SecretName}, pSecret)
+	if kerrors.IsNotFound(err) {
+		pSecret = nil
+	} else if err != nil {
+		return err
+	}
+
+	if pSecret != nil {
+		archived := &corev1.Secret{
+			ObjectMeta: archivedMetadata(pSecret, r.archiveNamespace, releasedFrom),
+			Type:       pSecret.Type,
+			Data:       pSecret.Data,
+		}
+		err = r.create(ctx, archived)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx.Log.Infof("delete host certificate %s/%s whose secret is archived in %s", pCertificate.Namespace, pCertificate.Name, r.archiveNamespace)
+	err = ctx.PhysicalClient.Delete(ctx, pCertificate)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	} else if pSecret == nil {
+		return nil
+	}
+
+	ctx.Log.Infof("delete host secret %s/%s archived in %s", pSecret.Namespace, pSecret.Name, r.archiveNamespace)
+	err = ctx.PhysicalClient.Delete(ctx, pSecret)
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// releaseSecret releases a secret the released object uses. Secrets the plugin synced carry
+// the ownership markers, the ones cert-manager wrote only get the released-from annotation.
+func (r *Releaser) releaseSecret(ctx *synccontext.SyncContext, name types.NamespacedName, releasedFrom string) error {
+	if name.Name == "" {
+		return nil
+	}
+
+	pSecret := &corev1.Secret{}
+	err := ctx.PhysicalClient.Get(ctx, name, pSecret)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return r.update(ctx, pSecret, releasedFrom)
+}
+
+// update strips the ownership markers of the host object and records where it was released from
+func (r *Releaser) update(ctx *synccontext.SyncContext, pObj client.Object, releasedFrom string) error {
+	if pObj.GetAnnotations()[constants.ReleasedFromAnnotation] != "" {
+		return nil
+	}
+
+	pObj.SetLabels(strip(pObj.GetLabels(), markerLabels))
+	annotations := strip(pObj.GetAnnotations(), markerAnnotations)
+	annotations[constants.ReleasedFromAnnotation] = releasedFrom
+	pObj.SetAnnotations(annotations)
+
+	ctx.Log.Infof("release host %s %s/%s of %s", kind(pObj), pObj.GetNamespace(), pObj.GetName(), releasedFrom)
+	err := ctx.PhysicalClient.Update(ctx, pObj)
+	if err != nil {
+		return err
+	}
+
+	r.events.Eventf(pObj, corev1.EventTypeNormal, ReasonReleased, "Released from virtual %s", releasedFrom)
+	return nil
+}
+
+func (r *Releaser) create(ctx *synccontext.SyncContext, pObj client.Object) error {
+	ctx.Log.Infof("archive host %s %s in %s", kind(pObj), pObj.GetName(), pObj.GetNamespace())
+	err := ctx.PhysicalClient.Create(ctx, pObj)
+	if kerrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// virtualName returns the virtual namespace and name of a host object the plugin manages
+func virtualName(pObj client.Object) string {
+	return pObj.GetAnnotations()[translate.NamespaceAnnotation] + "/" + pObj.GetAnnotations()[translate.NameAnnotation]
+}
+
+func archivedMetadata(pObj client.Object, namespace, releasedFrom string) metav1.ObjectMeta {
+	annotations := strip(pObj.GetAnnotations(), markerAnnotations)
+	annotations[constants.ReleasedFromAnnotation] = releasedFrom
+
+	return metav1.ObjectMeta{
+		Name:        pObj.GetName(),
+		Namespace:   namespace,
+		Labels:      strip(pObj.GetLabels(), markerLabels),
+		Annotations: annotations,
+	}
+}
+
+// strip returns a copy of the map without the given keys
+func strip(m map[string]string, keys []string) map[string]string {
+	stripped := map[string]string{}
+	for k, v := range m {
+		stripped[k] = v
+	}
+	for _, key := range keys {
+		delete(stripped, key)
+	}
+
+	return stripped
+}
+
+func kind(obj client.Object) string {
+	switch obj.(type) {
+	case *certmanagerv1.Certificate:
+		return "certificate"
+	case *certmanagerv1.Issuer:
+		return "issuer"
+	default:
+		return "secret"
+	}
+}
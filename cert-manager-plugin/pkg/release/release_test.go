@@ -0,0 +1,160 @@
+package release
+
+import (
+	"context"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	virtualNamespace = "shop"
+	archiveNamespace = "archive"
+)
+
+func newSyncContext(t *testing.T, pObjs ...runtime.Object) *synccontext.SyncContext {
+	t.Helper()
+
+	registerCtx := fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme), testingutil.NewFakeClient(scheme.Scheme, pObjs...))
+	return registerCtx.ToSyncContext("test")
+}
+
+// newHostObjects returns the host issuer and certificate the plugin created for virtual ones,
+// the issuer credentials it synced and the secret cert-manager issued
+func newHostObjects() []runtime.Object {
+	vIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: virtualNamespace},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			Vault: &certmanagerv1.VaultIssuer{
+				Server: "https://vault.example.com",
+				Path:   "pki/sign/shop",
+				Auth: certmanagerv1.VaultAuth{
+					TokenSecretRef: &cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: "vault-token"}, Key: "token"},
+				},
+			},
+		}},
+	}
+	pIssuer := translate.HostMetadata(vIssuer, naming.HostName(nil, naming.Issuer, vIssuer.Name, virtualNamespace))
+	pIssuer.Spec.Vault.Auth.TokenSecretRef.Name = naming.HostName(nil, naming.Secret, "vault-token", virtualNamespace).Name
+
+	vToken := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: virtualNamespace}}
+	pToken := translate.HostMetadata(vToken, naming.HostName(nil, naming.Secret, vToken.Name, virtualNamespace))
+
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: virtualNamespace},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: "web-tls",
+			IssuerRef:  cmmeta.ObjectReference{Kind: "Issuer", Name: pIssuer.Name},
+		},
+	}
+	pCertificate := translate.HostMetadata(vCertificate, naming.HostName(nil, naming.Certificate, vCertificate.Name, virtualNamespace))
+	pCertificate.Spec.SecretName = naming.HostName(nil, naming.Secret, "web-tls", virtualNamespace).Name
+
+	pSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pCertificate.Spec.SecretName,
+			Namespace:   pCertificate.Namespace,
+			Annotations: map[string]string{certmanagerv1.CertificateNameKey: pCertificate.Name},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("certificate")},
+	}
+
+	return []runtime.Object{pIssuer, pToken, pCertificate, pSecret}
+}
+
+func expectReleased(t *testing.T, c client.Client, name types.NamespacedName, obj client.Object, releasedFrom string) {
+	t.Helper()
+
+	err := c.Get(context.Background(), name, obj)
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+	if obj.GetAnnotations()[constants.ReleasedFromAnnotation] != releasedFrom {
+		t.Errorf("expected %s to be released from %s, got annotations %v", name, releasedFrom, obj.GetAnnotations())
+	}
+	if obj.GetLabels()[translate.MarkerLabel] != "" || obj.GetAnnotations()[translate.NameAnnotation] != "" {
+		t.Errorf("expected the ownership markers of %s to be stripped, got labels %v and annotations %v", name, obj.GetLabels(), obj.GetAnnotations())
+	}
+}
+
+func TestRelease(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	objs := newHostObjects()
+	ctx := newSyncContext(t, objs...)
+	releaser := &Releaser{events: record.NewFakeRecorder(10)}
+
+	err := releaser.Release(ctx)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	for _, obj := range objs {
+		obj := obj.(client.Object)
+		name := client.ObjectKeyFromObject(obj)
+		switch obj.GetName() {
+		case naming.HostName(nil, naming.Issuer, "vault", virtualNamespace).Name, naming.HostName(nil, naming.Secret, "vault-token", virtualNamespace).Name:
+			expectReleased(t, ctx.PhysicalClient, name, obj.DeepCopyObject().(client.Object), "shop/vault")
+		default:
+			expectReleased(t, ctx.PhysicalClient, name, obj.DeepCopyObject().(client.Object), "shop/web")
+		}
+	}
+
+	// released objects aren't managed anymore, so a second release is a no-op
+	err = releaser.Release(ctx)
+	if err != nil {
+		t.Fatalf("release again: %v", err)
+	}
+}
+
+func TestReleaseArchivesCertificates(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	objs := newHostObjects()
+	ctx := newSyncContext(t, objs...)
+	releaser := &Releaser{archiveNamespace: archiveNamespace, events: record.NewFakeRecorder(10)}
+
+	err := releaser.Release(ctx)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	pCertificate, pSecret := objs[2].(*certmanagerv1.Certificate), objs[3].(*corev1.Secret)
+	archivedSecret := &corev1.Secret{}
+	expectReleased(t, ctx.PhysicalClient, types.NamespacedName{Namespace: archiveNamespace, Name: pSecret.Name}, archivedSecret, "shop/web")
+	if string(archivedSecret.Data[corev1.TLSCertKey]) != "certificate" || archivedSecret.Annotations[certmanagerv1.CertificateNameKey] != pCertificate.Name {
+		t.Errorf("expected the archived secret to keep data and cert-manager annotations, got %v", archivedSecret)
+	}
+
+	// the certificate isn't archived, so it isn't renewed in the archive namespace
+	err = ctx.PhysicalClient.Get(ctx, types.NamespacedName{Namespace: archiveNamespace, Name: pCertificate.Name}, &certmanagerv1.Certificate{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected the certificate not to be archived, got %v", err)
+	}
+	err = ctx.PhysicalClient.Get(ctx, client.ObjectKeyFromObject(pCertificate), &certmanagerv1.Certificate{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected the certificate to be deleted, got %v", err)
+	}
+	err = ctx.PhysicalClient.Get(ctx, client.ObjectKeyFromObject(pSecret), &corev1.Secret{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected the secret to be moved to the archive, got %v", err)
+	}
+
+	// issuers stay in place
+	pIssuer := objs[0].(*certmanagerv1.Issuer)
+	expectReleased(t, ctx.PhysicalClient, client.ObjectKeyFromObject(pIssuer), &certmanagerv1.Issuer{}, "shop/vault")
+}
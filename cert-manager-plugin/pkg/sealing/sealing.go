@@ -0,0 +1,147 @@
+// Package sealing wraps private keys that are synced from the host cluster into the
+// virtual cluster with a per-vcluster NaCl box key. Workloads inside the vcluster can
+// use this package to unwrap the private keys again.
+package sealing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SealedAnnotation is set on virtual secrets that contain sealed private keys
+	SealedAnnotation = "cert-manager.vcluster.loft.sh/sealed"
+
+	// SealedSuffix is appended to the data key of every sealed value
+	SealedSuffix = ".sealed"
+
+	// Algorithm is the value of the SealedAnnotation
+	Algorithm = "nacl-box"
+
+	// KeySize is the size of public and private keys in bytes
+	KeySize = 32
+
+	// SecretTypeSealedTLS is the type of sealed TLS secrets. The api server rejects TLS secrets
+	// without a tls.key, so sealed TLS secrets can't keep their type.
+	SecretTypeSealedTLS corev1.SecretType = "cert-manager.vcluster.loft.sh/sealed-tls"
+)
+
+// PrivateKeyDataKeys are the secret data keys cert-manager writes private key material to
+var PrivateKeyDataKeys = []string{
+	"tls.key",
+	"key.der",
+	"tls-combined.pem",
+}
+
+// GenerateKey creates a new public and private key pair
+func GenerateKey() (publicKey, privateKey *[KeySize]byte, err error) {
+	return box.GenerateKey(rand.Reader)
+}
+
+// ParseKey parses a public or private key that is either raw or base64 encoded
+func ParseKey(raw []byte) (*[KeySize]byte, error) {
+	if len(raw) != KeySize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("decode key: %w", err)
+		}
+		raw = decoded
+	}
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("key has invalid size %d, expected %d", len(raw), KeySize)
+	}
+
+	key := &[KeySize]byte{}
+	copy(key[:], raw)
+	return key, nil
+}
+
+// EncodeKey encodes the key as base64
+func EncodeKey(key *[KeySize]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// Seal encrypts the message for the owner of the private key that belongs to the public key
+func Seal(message []byte, publicKey *[KeySize]byte) ([]byte, error) {
+	return box.SealAnonymous(nil, message, publicKey, rand.Reader)
+}
+
+// Open decrypts a message that was sealed with Seal
+func Open(sealed []byte, publicKey, privateKey *[KeySize]byte) ([]byte, error) {
+	message, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+	if !ok {
+		return nil, fmt.Errorf("open sealed message: decryption failed")
+	}
+
+	return message, nil
+}
+
+// SealType returns the type of a secret with sealed data
+func SealType(secretType corev1.SecretType) corev1.SecretType {
+	if secretType == corev1.SecretTypeTLS {
+		return SecretTypeSealedTLS
+	}
+
+	return secretType
+}
+
+// OpenType reverses SealType
+func OpenType(secretType corev1.SecretType) corev1.SecretType {
+	if secretType == SecretTypeSealedTLS {
+		return corev1.SecretTypeTLS
+	}
+
+	return secretType
+}
+
+// SealData returns a copy of the secret data where all private key material is sealed.
+// A sealed value is stored under its original key with the SealedSuffix appended.
+func SealData(data map[string][]byte, publicKey *[KeySize]byte) (map[string][]byte, error) {
+	retData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		retData[k] = v
+	}
+
+	for _, k := range PrivateKeyDataKeys {
+		v, ok := retData[k]
+		if !ok {
+			continue
+		}
+
+		sealed, err := Seal(v, publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("seal %s: %w", k, err)
+		}
+
+		delete(retData, k)
+		retData[k+SealedSuffix] = sealed
+	}
+
+	return retData, nil
+}
+
+// OpenData reverses SealData and returns a copy of the secret data with all private
+// key material unwrapped
+func OpenData(data map[string][]byte, publicKey, privateKey *[KeySize]byte) (map[string][]byte, error) {
+	retData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		if !strings.HasSuffix(k, SealedSuffix) {
+			retData[k] = v
+			continue
+		}
+
+		opened, err := Open(v, publicKey, privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", k, err)
+		}
+
+		retData[strings.TrimSuffix(k, SealedSuffix)] = opened
+	}
+
+	return retData, nil
+}
@@ -0,0 +1,166 @@
+package sealing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSealOpen(t *testing.T) {
+	publicKey, privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := Seal([]byte("private key"), publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("private key")) {
+		t.Errorf("sealed message contains the plain text")
+	}
+
+	opened, err := Open(sealed, publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != "private key" {
+		t.Errorf("expected the opened message to be %q, got %q", "private key", opened)
+	}
+
+	otherPublicKey, otherPrivateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(sealed, otherPublicKey, otherPrivateKey)
+	if err == nil {
+		t.Errorf("expected opening with another key to fail")
+	}
+}
+
+func TestSealOpenData(t *testing.T) {
+	publicKey, privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string][]byte{
+		"tls.crt":          []byte("certificate"),
+		"ca.crt":           []byte("ca"),
+		"tls.key":          []byte("key"),
+		"key.der":          []byte("der"),
+		"tls-combined.pem": []byte("combined"),
+	}
+	sealed, err := SealData(data, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range PrivateKeyDataKeys {
+		if _, ok := sealed[k]; ok {
+			t.Errorf("expected %s to be sealed", k)
+		}
+		if _, ok := sealed[k+SealedSuffix]; !ok {
+			t.Errorf("expected %s to exist", k+SealedSuffix)
+		}
+	}
+	if string(sealed["tls.crt"]) != "certificate" || string(sealed["ca.crt"]) != "ca" {
+		t.Errorf("expected the certificates to be kept, got %v", sealed)
+	}
+	if _, ok := data["tls.key.sealed"]; ok || string(data["tls.key"]) != "key" {
+		t.Errorf("the original data must not be changed, got %v", data)
+	}
+
+	opened, err := OpenData(sealed, publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != len(data) {
+		t.Fatalf("expected %d keys, got %v", len(data), opened)
+	}
+	for k, v := range data {
+		if string(opened[k]) != string(v) {
+			t.Errorf("expected %s to be %q, got %q", k, v, opened[k])
+		}
+	}
+}
+
+func TestOpenDataInvalid(t *testing.T) {
+	publicKey, privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenData(map[string][]byte{"tls.key.sealed": []byte("not sealed")}, publicKey, privateKey)
+	if err == nil {
+		t.Errorf("expected opening invalid data to fail")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	publicKey, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		invalid bool
+	}{
+		{
+			name: "raw",
+			raw:  publicKey[:],
+		},
+		{
+			name: "base64",
+			raw:  []byte(EncodeKey(publicKey)),
+		},
+		{
+			name: "base64 with newline",
+			raw:  []byte(EncodeKey(publicKey) + "\n"),
+		},
+		{
+			name:    "invalid base64",
+			raw:     []byte("not a key"),
+			invalid: true,
+		},
+		{
+			name:    "invalid size",
+			raw:     []byte(base64.StdEncoding.EncodeToString([]byte("short"))),
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ParseKey(test.raw)
+			if test.invalid {
+				if err == nil {
+					t.Errorf("expected an error, got key %v", key)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if *key != *publicKey {
+				t.Errorf("expected key %s, got %s", EncodeKey(publicKey), EncodeKey(key))
+			}
+		})
+	}
+}
+
+func TestSealType(t *testing.T) {
+	for _, secretType := range []corev1.SecretType{corev1.SecretTypeTLS, corev1.SecretTypeOpaque} {
+		sealed := SealType(secretType)
+		if secretType == corev1.SecretTypeTLS && sealed != SecretTypeSealedTLS {
+			t.Errorf("expected sealed TLS secrets to have type %s, got %s", SecretTypeSealedTLS, sealed)
+		}
+		if opened := OpenType(sealed); opened != secretType {
+			t.Errorf("expected type %s, got %s", secretType, opened)
+		}
+	}
+}
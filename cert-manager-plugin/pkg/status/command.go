@@ -0,0 +1,178 @@
+package status
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	vclusterconfig "github.com/loft-sh/vcluster/pkg/config"
+	"github.com/loft-sh/vcluster/pkg/mappings"
+	"github.com/loft-sh/vcluster/pkg/mappings/resources"
+	"github.com/loft-sh/vcluster/pkg/mappings/store"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const commandUsage = `Usage: cert-manager-plugin status [flags] certificate/NAME | ingress/NAME ...
+
+Prints the host Certificate, CertificateRequest, Order, Challenges, Issuer and Secret of virtual
+Certificates and Ingresses together with their conditions and expiry, and reports problems of the
+sync between the virtual cluster and the host. The host names are translated like the plugin
+does, so the naming strategy must match the plugin config and --multi-namespace must be set if
+the vcluster runs in multi-namespace mode.
+
+Flags:
+`
+
+// Command runs the status subcommand. It only reads objects, so it needs read access to the
+// virtual cluster and the host namespace of the vcluster.
+func Command(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig of the host cluster, defaults to the in-cluster config")
+	virtualKubeconfig := flags.String("virtual-kubeconfig", "", "path to the kubeconfig of the virtual cluster")
+	vcluster := flags.String("vcluster", "", "name of the vcluster")
+	hostNamespace := flags.String("host-namespace", "", "host namespace the vcluster syncs into, or the namespace of the vcluster with --multi-namespace")
+	multiNamespace := flags.Bool("multi-namespace", false, "the vcluster syncs every virtual namespace into its own host namespace")
+	namespace := flags.String("namespace", "default", "virtual namespace of the Certificates and Ingresses")
+	namingStrategy := flags.String("naming-strategy", naming.StrategyDefault, "naming strategy of the plugin, default or predictable")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), commandUsage)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	} else if *virtualKubeconfig == "" || *vcluster == "" || *hostNamespace == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("--virtual-kubeconfig, --vcluster, --host-namespace and at least one object are required")
+	}
+
+	// translate names like the plugin running in the vcluster
+	translate.VClusterName = *vcluster
+	if *multiNamespace {
+		translate.Default = translate.NewMultiNamespaceTranslator(*hostNamespace)
+	} else {
+		translate.Default = translate.NewSingleNamespaceTranslator(*hostNamespace)
+	}
+	err = naming.SetStrategy(*namingStrategy)
+	if err != nil {
+		return err
+	}
+
+	_ = cmacme.AddToScheme(scheme.Scheme)
+	hostConfig, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return fmt.Errorf("load host kubeconfig: %w", err)
+	}
+	virtualConfig, err := clientcmd.BuildConfigFromFlags("", *virtualKubeconfig)
+	if err != nil {
+		return fmt.Errorf("load virtual kubeconfig: %w", err)
+	}
+
+	ctx, err := newSyncContext(context.Background(), hostConfig, virtualConfig, *hostNamespace, *multiNamespace)
+	if err != nil {
+		return err
+	}
+	for i, arg := range flags.Args() {
+		kind, name, ok := strings.Cut(arg, "/")
+		if !ok || name == "" {
+			return fmt.Errorf("expected certificate/NAME or ingress/NAME, got %q", arg)
+		}
+
+		report, err := Inspect(ctx, kind, types.NamespacedName{Namespace: *namespace, Name: name})
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", arg, err)
+		}
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		report.Print(os.Stdout)
+	}
+
+	return nil
+}
+
+// newSyncContext returns a sync context that reads from the host and the virtual cluster
+// directly. The mappers of the syncers are registered like in the plugin, so names are mapped
+// between the clusters the same way.
+func newSyncContext(ctx context.Context, hostConfig, virtualConfig *rest.Config, hostNamespace string, multiNamespace bool) (*synccontext.SyncContext, error) {
+	hostClient, err := client.New(hostConfig, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("create host client: %w", err)
+	}
+	virtualClient, err := client.New(virtualConfig, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("create virtual client: %w", err)
+	}
+
+	// the managers aren't started, they only hand their configs and clients to the mappers
+	hostManager, err := newManager(hostConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create host manager: %w", err)
+	}
+	virtualManager, err := newManager(virtualConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create virtual manager: %w", err)
+	}
+
+	vClusterConfig := &vclusterconfig.VirtualClusterConfig{WorkloadNamespace: hostNamespace}
+	vClusterConfig.Experimental.MultiNamespaceMode.Enabled = multiNamespace
+	registerCtx := &synccontext.RegisterContext{
+		Context:                ctx,
+		Config:                 vClusterConfig,
+		CurrentNamespace:       hostNamespace,
+		CurrentNamespaceClient: hostClient,
+		VirtualManager:         virtualManager,
+		PhysicalManager:        hostManager,
+	}
+	mappingsStore, err := store.NewStore(ctx, virtualClient, hostClient, store.NewMemoryBackend())
+	if err != nil {
+		return nil, fmt.Errorf("create mappings store: %w", err)
+	}
+	registerCtx.Mappings = mappings.NewMappingsRegistry(mappingsStore)
+
+	createMappers := []func(*synccontext.RegisterContext) (synccontext.Mapper, error){
+		resources.CreateSecretsMapper,
+		issuers.NewMapper,
+		func(ctx *synccontext.RegisterContext) (synccontext.Mapper, error) {
+			return certificates.NewMapper(ctx, owners.NewRegistry())
+		},
+	}
+	for _, createMapper := range createMappers {
+		mapper, err := createMapper(registerCtx)
+		if err != nil {
+			return nil, fmt.Errorf("create mapper: %w", err)
+		}
+		err = registerCtx.Mappings.AddMapper(mapper)
+		if err != nil {
+			return nil, fmt.Errorf("add mapper %s: %w", mapper.GroupVersionKind(), err)
+		}
+	}
+
+	syncCtx := registerCtx.ToSyncContext("status")
+	syncCtx.PhysicalClient = hostClient
+	syncCtx.VirtualClient = virtualClient
+	return syncCtx, nil
+}
+
+func newManager(config *rest.Config) (manager.Manager, error) {
+	return manager.New(config, manager.Options{
+		Scheme:                 scheme.Scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+}
@@ -0,0 +1,510 @@
+// Package status implements the status subcommand. It follows a virtual Certificate or Ingress
+// to the host Certificate, CertificateRequest, Order, Challenges, Issuer and Secret cert-manager
+// works with and reports the problems of the sync. Host names are translated with the same naming
+// strategy and the same spec translation the syncers use, so the report shows what the running
+// plugin expects on the host.
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/consistency"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/sealing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Object is an object on the way from the virtual object to the issued secret
+type Object struct {
+	Kind string
+	Name string
+
+	// Missing is set if the object doesn't exist (yet)
+	Missing bool
+
+	Details []string
+}
+
+// Report is the result of an inspection
+type Report struct {
+	Objects  []Object
+	Problems []string
+}
+
+func (r *Report) add(kind string, obj client.Object, details ...string) {
+	r.Objects = append(r.Objects, Object{Kind: kind, Name: key(obj.GetNamespace(), obj.GetName()), Details: details})
+}
+
+func (r *Report) missing(kind string, name types.NamespacedName) {
+	r.Objects = append(r.Objects, Object{Kind: kind, Name: key(name.Namespace, name.Name), Missing: true})
+}
+
+func (r *Report) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Print writes the report in a human readable form
+func (r *Report) Print(out io.Writer) {
+	for _, obj := range r.Objects {
+		if obj.Missing {
+			fmt.Fprintf(out, "%s %s: not found\n", obj.Kind, obj.Name)
+			continue
+		}
+
+		fmt.Fprintf(out, "%s %s\n", obj.Kind, obj.Name)
+		for _, detail := range obj.Details {
+			fmt.Fprintf(out, "  %s\n", detail)
+		}
+	}
+
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return
+	}
+	fmt.Fprintln(out, "Problems:")
+	for _, problem := range r.Problems {
+		fmt.Fprintf(out, "  - %s\n", problem)
+	}
+}
+
+// Inspect follows the virtual object of the kind, a certificate or an ingress, to its host objects
+func Inspect(ctx *synccontext.SyncContext, kind string, name types.NamespacedName) (*Report, error) {
+	report := &Report{}
+	var err error
+	switch strings.ToLower(kind) {
+	case "certificate", "certificates", "cert":
+		err = inspectCertificate(ctx, report, name)
+	case "ingress", "ingresses", "ing":
+		err = inspectIngress(ctx, report, name)
+	default:
+		return nil, fmt.Errorf("can't inspect %s, only certificates and ingresses can be inspected", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func inspectCertificate(ctx *synccontext.SyncContext, report *Report, name types.NamespacedName) error {
+	vCertificate := &certmanagerv1.Certificate{}
+	found, err := get(ctx, ctx.VirtualClient, name, vCertificate)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Certificate", name)
+		report.problem("virtual certificate %s doesn't exist", name)
+		return nil
+	}
+	report.add("Certificate", vCertificate, certificateDetails(vCertificate)...)
+
+	// the ingress shim names host certificates after their secret
+	if vCertificate.Annotations[constants.BackwardSyncAnnotation] == "true" {
+		return inspectHostCertificate(ctx, report, vCertificate, name, naming.Explain(ctx, naming.Secret, name.Name, name.Namespace))
+	}
+
+	return inspectHostCertificate(ctx, report, vCertificate, name, naming.Explain(ctx, naming.Certificate, name.Name, name.Namespace))
+}
+
+func inspectIngress(ctx *synccontext.SyncContext, report *Report, name types.NamespacedName) error {
+	vIngress := &networkingv1.Ingress{}
+	found, err := get(ctx, ctx.VirtualClient, name, vIngress)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Ingress", name)
+		report.problem("virtual ingress %s doesn't exist", name)
+		return nil
+	}
+
+	issuer, clusterIssuer := vIngress.Annotations[constants.IssuerAnnotation], vIngress.Annotations[constants.ClusterIssuerAnnotation]
+	details := []string{}
+	if issuer != "" {
+		details = append(details, "Issuer: "+issuer)
+	}
+	if clusterIssuer != "" {
+		details = append(details, "ClusterIssuer: "+clusterIssuer)
+	}
+	report.add("Ingress", vIngress, details...)
+
+	// the host ingress is synced by vcluster, the plugin only rewrites its issuer annotation
+	pIngress := &networkingv1.Ingress{}
+	pName := translate.Default.HostName(ctx, name.Name, name.Namespace)
+	found, err = get(ctx, ctx.PhysicalClient, pName, pIngress)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Host Ingress", pName)
+		report.problem("host ingress %s doesn't exist, it's created by the ingress syncer of vcluster", pName)
+	} else {
+		report.add("Host Ingress", pIngress)
+		expected := naming.HostName(ctx, naming.Issuer, issuer, name.Namespace).Name
+		if actual := pIngress.Annotations[constants.IssuerAnnotation]; actual != expected {
+			report.problem("host ingress %s references issuer %q instead of %q", pName, actual, expected)
+		}
+	}
+
+	if issuer != "" {
+		vIssuer := types.NamespacedName{Namespace: name.Namespace, Name: issuer}
+		found, err = get(ctx, ctx.VirtualClient, vIssuer, &certmanagerv1.Issuer{})
+		if err != nil {
+			return err
+		} else if !found {
+			report.problem("virtual issuer %s referenced by the ingress doesn't exist", vIssuer)
+		}
+	}
+
+	references := certificates.CertificateReferencesFromIngress(vIngress)
+	if len(references) == 0 {
+		report.problem("ingress requests no certificates, it needs the %s or %s annotation and a tls entry with a secret name", constants.IssuerAnnotation, constants.ClusterIssuerAnnotation)
+		return nil
+	}
+	for _, reference := range references {
+		vCertificate := &certmanagerv1.Certificate{}
+		found, err = get(ctx, ctx.VirtualClient, reference.Target, vCertificate)
+		if err != nil {
+			return err
+		} else if !found {
+			report.missing("Certificate", reference.Target)
+			vCertificate = nil
+		} else {
+			report.add("Certificate", vCertificate, certificateDetails(vCertificate)...)
+		}
+
+		err = inspectHostCertificate(ctx, report, vCertificate, reference.Target, naming.Explain(ctx, naming.Secret, reference.Target.Name, reference.Target.Namespace))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inspectHostCertificate inspects the host certificate of a virtual certificate and the objects
+// cert-manager creates for it. The virtual certificate is nil if an ingress requested the
+// certificate and it wasn't synced back yet.
+func inspectHostCertificate(ctx *synccontext.SyncContext, report *Report, vCertificate *certmanagerv1.Certificate, vName types.NamespacedName, pName naming.Result) error {
+	backward := vCertificate == nil || vCertificate.Annotations[constants.BackwardSyncAnnotation] == "true"
+	pCertificate := &certmanagerv1.Certificate{}
+	found, err := get(ctx, ctx.PhysicalClient, pName.NamespacedName, pCertificate)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Host Certificate", pName.NamespacedName)
+		if backward {
+			report.problem("host certificate %s doesn't exist, it's created by cert-manager's ingress shim for the host ingress", pName.NamespacedName)
+		} else {
+			report.problem("host certificate %s doesn't exist, it's created by the plugin for the virtual certificate", pName.NamespacedName)
+		}
+		return nil
+	}
+	report.add("Host Certificate", pCertificate, append([]string{"Name: " + pName.Reason}, certificateDetails(pCertificate)...)...)
+
+	if vCertificate == nil {
+		report.problem("virtual certificate %s doesn't exist, it's synced back from host certificate %s", vName, pName.NamespacedName)
+	} else if !backward {
+		checkHostSpec(ctx, report, vCertificate, pCertificate)
+	}
+	if vCertificate != nil && !equality.Semantic.DeepEqual(vCertificate.Status.NotAfter, pCertificate.Status.NotAfter) {
+		report.problem("status of the virtual certificate differs from host certificate %s, it's copied with the next sync", pName.NamespacedName)
+	}
+
+	err = inspectRequest(ctx, report, pCertificate)
+	if err != nil {
+		return err
+	}
+	err = inspectIssuer(ctx, report, vCertificate, pCertificate, backward)
+	if err != nil {
+		return err
+	}
+
+	vSecretName := vName.Name
+	if vCertificate != nil {
+		vSecretName = vCertificate.Spec.SecretName
+	}
+	return inspectSecret(ctx, report, pCertificate, types.NamespacedName{Namespace: vName.Namespace, Name: vSecretName})
+}
+
+// checkHostSpec compares the host spec with the translated virtual spec like the syncer does
+func checkHostSpec(ctx *synccontext.SyncContext, report *Report, vCertificate, pCertificate *certmanagerv1.Certificate) {
+	if reason := consistency.Conflict(vCertificate, pCertificate); reason != "" {
+		report.problem("host certificate %s/%s conflicts: %s", pCertificate.Namespace, pCertificate.Name, reason)
+		return
+	}
+
+	pSpec := certificates.HostSpec(ctx, &vCertificate.Spec, vCertificate.Namespace)
+	if equality.Semantic.DeepEqual(pCertificate.Spec, *pSpec) {
+		return
+	}
+
+	changed := strings.Join(certificates.ChangedFields(pSpec, &pCertificate.Spec), ", ")
+	lastHash := pCertificate.Annotations[constants.SpecHashAnnotation]
+	if lastHash != "" && lastHash != certificates.SpecHash(&pCertificate.Spec) {
+		report.problem("host certificate %s/%s was changed outside of the vcluster: %s", pCertificate.Namespace, pCertificate.Name, changed)
+		return
+	}
+	report.problem("host certificate %s/%s differs from the virtual certificate, it's updated with the next sync: %s", pCertificate.Namespace, pCertificate.Name, changed)
+}
+
+// inspectRequest inspects the latest certificate request of the host certificate and its ACME
+// order and challenges
+func inspectRequest(ctx *synccontext.SyncContext, report *Report, pCertificate *certmanagerv1.Certificate) error {
+	requestList := &certmanagerv1.CertificateRequestList{}
+	err := ctx.PhysicalClient.List(ctx, requestList, client.InNamespace(pCertificate.Namespace))
+	if err != nil {
+		return fmt.Errorf("list host certificate requests: %w", err)
+	}
+
+	var request *certmanagerv1.CertificateRequest
+	for i := range requestList.Items {
+		candidate := &requestList.Items[i]
+		if metav1.IsControlledBy(candidate, pCertificate) && (request == nil || revision(candidate) > revision(request)) {
+			request = candidate
+		}
+	}
+	if request == nil {
+		report.Objects = append(report.Objects, Object{Kind: "CertificateRequest", Name: "of host certificate " + key(pCertificate.Namespace, pCertificate.Name), Missing: true})
+		return nil
+	}
+
+	details := []string{fmt.Sprintf("Revision: %d", revision(request))}
+	for _, condition := range request.Status.Conditions {
+		details = append(details, conditionDetail(string(condition.Type), string(condition.Status), condition.Reason, condition.Message))
+	}
+	report.add("CertificateRequest", request, details...)
+
+	orderList := &cmacme.OrderList{}
+	err = ctx.PhysicalClient.List(ctx, orderList, client.InNamespace(pCertificate.Namespace))
+	if err != nil {
+		return fmt.Errorf("list host orders: %w", err)
+	}
+	for i := range orderList.Items {
+		order := &orderList.Items[i]
+		if !metav1.IsControlledBy(order, request) {
+			continue
+		}
+
+		report.add("Order", order, stateDetail(order.Status.State, order.Status.Reason))
+		err = inspectChallenges(ctx, report, order)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func inspectChallenges(ctx *synccontext.SyncContext, report *Report, order *cmacme.Order) error {
+	challengeList := &cmacme.ChallengeList{}
+	err := ctx.PhysicalClient.List(ctx, challengeList, client.InNamespace(order.Namespace))
+	if err != nil {
+		return fmt.Errorf("list host challenges: %w", err)
+	}
+
+	for i := range challengeList.Items {
+		challenge := &challengeList.Items[i]
+		if !metav1.IsControlledBy(challenge, order) {
+			continue
+		}
+
+		report.add("Challenge", challenge,
+			fmt.Sprintf("Type: %s for %s", challenge.Spec.Type, challenge.Spec.DNSName),
+			fmt.Sprintf("Presented: %t", challenge.Status.Presented),
+			stateDetail(challenge.Status.State, challenge.Status.Reason),
+		)
+	}
+
+	return nil
+}
+
+// inspectIssuer inspects the host issuer of the host certificate and checks that the virtual
+// issuer it's translated from exists
+func inspectIssuer(ctx *synccontext.SyncContext, report *Report, vCertificate, pCertificate *certmanagerv1.Certificate, backward bool) error {
+	issuerRef := pCertificate.Spec.IssuerRef
+	if issuerRef.Group != "" && issuerRef.Group != certmanagerv1.SchemeGroupVersion.Group {
+		report.Objects = append(report.Objects, Object{Kind: "Issuer", Name: issuerRef.Name, Details: []string{fmt.Sprintf("External issuer %s of group %s", issuerRef.Kind, issuerRef.Group)}})
+		return nil
+	}
+
+	var issuer client.Object
+	var status *certmanagerv1.IssuerStatus
+	var kind string
+	pName := types.NamespacedName{Name: issuerRef.Name}
+	if issuerRef.Kind == certmanagerv1.ClusterIssuerKind {
+		clusterIssuer := &certmanagerv1.ClusterIssuer{}
+		issuer, status, kind = clusterIssuer, &clusterIssuer.Status, "ClusterIssuer"
+	} else {
+		hostIssuer := &certmanagerv1.Issuer{}
+		issuer, status, kind = hostIssuer, &hostIssuer.Status, "Host Issuer"
+		pName.Namespace = pCertificate.Namespace
+
+		if !backward {
+			vIssuer := types.NamespacedName{Namespace: vCertificate.Namespace, Name: vCertificate.Spec.IssuerRef.Name}
+			found, err := get(ctx, ctx.VirtualClient, vIssuer, &certmanagerv1.Issuer{})
+			if err != nil {
+				return err
+			} else if !found {
+				report.problem("virtual issuer %s referenced by the certificate doesn't exist", vIssuer)
+			}
+		}
+	}
+
+	found, err := get(ctx, ctx.PhysicalClient, pName, issuer)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing(kind, pName)
+		report.problem("%s %s referenced by host certificate %s/%s doesn't exist", strings.ToLower(kind), key(pName.Namespace, pName.Name), pCertificate.Namespace, pCertificate.Name)
+		return nil
+	}
+
+	details := []string{}
+	for _, condition := range status.Conditions {
+		details = append(details, conditionDetail(string(condition.Type), string(condition.Status), condition.Reason, condition.Message))
+	}
+	report.add(kind, issuer, details...)
+	return nil
+}
+
+// inspectSecret inspects the host secret of the host certificate and its virtual copy
+func inspectSecret(ctx *synccontext.SyncContext, report *Report, pCertificate *certmanagerv1.Certificate, vName types.NamespacedName) error {
+	pSecret := &corev1.Secret{}
+	pName := types.NamespacedName{Namespace: pCertificate.Namespace, Name: pCertificate.Spec.SecretName}
+	found, err := get(ctx, ctx.PhysicalClient, pName, pSecret)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Host Secret", pName)
+		if ready(pCertificate) {
+			report.problem("host secret %s doesn't exist, but host certificate %s/%s is ready", pName, pCertificate.Namespace, pCertificate.Name)
+		}
+		return nil
+	}
+	report.add("Host Secret", pSecret, "Keys: "+strings.Join(keys(pSecret.Data), ", "))
+
+	vSecret := &corev1.Secret{}
+	found, err = get(ctx, ctx.VirtualClient, vName, vSecret)
+	if err != nil {
+		return err
+	} else if !found {
+		report.missing("Secret", vName)
+		report.problem("virtual secret %s doesn't exist, it's synced back from host secret %s", vName, pName)
+		return nil
+	}
+
+	sealed := vSecret.Annotations[sealing.SealedAnnotation] != ""
+	details := []string{"Keys: " + strings.Join(keys(vSecret.Data), ", ")}
+	if sealed {
+		details = append(details, "Private key is sealed")
+	}
+	report.add("Secret", vSecret, details...)
+	if !secrets.BackwardDataInSync(pSecret, vSecret, sealed) {
+		report.problem("data of virtual secret %s differs from host secret %s, it's copied with the next sync", vName, pName)
+	}
+
+	return nil
+}
+
+func certificateDetails(certificate *certmanagerv1.Certificate) []string {
+	details := []string{}
+	for _, condition := range certificate.Status.Conditions {
+		details = append(details, conditionDetail(string(condition.Type), string(condition.Status), condition.Reason, condition.Message))
+	}
+	if certificate.Status.NotAfter != nil {
+		details = append(details, "Not after: "+certificate.Status.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if certificate.Status.RenewalTime != nil {
+		details = append(details, "Renewal time: "+certificate.Status.RenewalTime.UTC().Format(time.RFC3339))
+	}
+
+	return details
+}
+
+func conditionDetail(conditionType, status, reason, message string) string {
+	detail := conditionType + ": " + status
+	if reason != "" {
+		detail += " (" + reason + ")"
+	}
+	if message != "" {
+		detail += " " + message
+	}
+
+	return detail
+}
+
+func stateDetail(state cmacme.State, reason string) string {
+	detail := "State: " + string(state)
+	if state == cmacme.Unknown {
+		detail = "State: unknown"
+	}
+	if reason != "" {
+		detail += " (" + reason + ")"
+	}
+
+	return detail
+}
+
+func ready(certificate *certmanagerv1.Certificate) bool {
+	for _, condition := range certificate.Status.Conditions {
+		if condition.Type == certmanagerv1.CertificateConditionReady {
+			return condition.Status == cmmeta.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// revision returns the certificate revision a request was created for
+func revision(request *certmanagerv1.CertificateRequest) int {
+	value, _ := strconv.Atoi(request.Annotations[certmanagerv1.CertificateRequestRevisionAnnotationKey])
+	return value
+}
+
+// get reads the object and returns false if it doesn't exist
+func get(ctx context.Context, c client.Client, name types.NamespacedName, obj client.Object) (bool, error) {
+	err := c.Get(ctx, name, obj)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+func keys(data map[string][]byte) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func key(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "/" + name
+}
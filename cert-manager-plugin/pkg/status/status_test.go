@@ -0,0 +1,230 @@
+package status
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const virtualNamespace = "shop"
+
+func controlledBy(owner metav1.Object, kind string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: owner.GetName(), UID: owner.GetUID(), Controller: &controller}}
+}
+
+// newIssuance returns the virtual objects of a certificate issued by an ACME issuer and the host
+// objects cert-manager created for it
+func newIssuance() ([]runtime.Object, []runtime.Object) {
+	notAfter := metav1.NewTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	status := certmanagerv1.CertificateStatus{
+		Conditions: []certmanagerv1.CertificateCondition{{Type: certmanagerv1.CertificateConditionReady, Status: cmmeta.ConditionTrue, Reason: "Ready"}},
+		NotAfter:   &notAfter,
+	}
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "web", UID: "virtual"},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: "web-tls",
+			DNSNames:   []string{"web.example.com"},
+			IssuerRef:  cmmeta.ObjectReference{Kind: "Issuer", Name: "letsencrypt"},
+		},
+		Status: status,
+	}
+	vIssuer := &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "letsencrypt"}}
+	vSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "web-tls"},
+		Data:       map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")},
+	}
+
+	pName := naming.HostName(nil, naming.Certificate, "web", virtualNamespace)
+	pCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pName.Namespace,
+			Name:      pName.Name,
+			UID:       "host",
+			Annotations: map[string]string{
+				translate.NameAnnotation:      "web",
+				translate.NamespaceAnnotation: virtualNamespace,
+				translate.UIDAnnotation:       "virtual",
+			},
+		},
+		Spec:   *certificates.HostSpec(nil, &vCertificate.Spec, virtualNamespace),
+		Status: status,
+	}
+	pCertificate.Annotations[constants.SpecHashAnnotation] = certificates.SpecHash(&pCertificate.Spec)
+	pIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: pCertificate.Spec.IssuerRef.Name},
+		Status: certmanagerv1.IssuerStatus{
+			Conditions: []certmanagerv1.IssuerCondition{{Type: certmanagerv1.IssuerConditionReady, Status: cmmeta.ConditionTrue, Reason: "ACMEAccountRegistered"}},
+		},
+	}
+	pSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: pCertificate.Spec.SecretName},
+		Data:       map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")},
+	}
+
+	oldRequest := &certmanagerv1.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       pName.Namespace,
+		Name:            pName.Name + "-1",
+		UID:             "request-1",
+		Annotations:     map[string]string{certmanagerv1.CertificateRequestRevisionAnnotationKey: "1"},
+		OwnerReferences: controlledBy(pCertificate, "Certificate"),
+	}}
+	request := &certmanagerv1.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       pName.Namespace,
+			Name:            pName.Name + "-2",
+			UID:             "request-2",
+			Annotations:     map[string]string{certmanagerv1.CertificateRequestRevisionAnnotationKey: "2"},
+			OwnerReferences: controlledBy(pCertificate, "Certificate"),
+		},
+		Status: certmanagerv1.CertificateRequestStatus{
+			Conditions: []certmanagerv1.CertificateRequestCondition{{Type: certmanagerv1.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: "Pending"}},
+		},
+	}
+	order := &cmacme.Order{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: request.Name + "-order", UID: "order", OwnerReferences: controlledBy(request, "CertificateRequest")},
+		Status:     cmacme.OrderStatus{State: cmacme.Pending},
+	}
+	challenge := &cmacme.Challenge{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: order.Name + "-challenge", OwnerReferences: controlledBy(order, "Order")},
+		Spec:       cmacme.ChallengeSpec{Type: cmacme.ACMEChallengeTypeHTTP01, DNSName: "web.example.com"},
+		Status:     cmacme.ChallengeStatus{State: cmacme.Pending, Reason: "Waiting for HTTP-01 challenge propagation"},
+	}
+
+	return []runtime.Object{vCertificate, vIssuer, vSecret}, []runtime.Object{pCertificate, pIssuer, pSecret, oldRequest, request, order, challenge}
+}
+
+func kinds(report *Report) []string {
+	kinds := []string{}
+	for _, obj := range report.Objects {
+		kind := obj.Kind
+		if obj.Missing {
+			kind += " (missing)"
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+func TestInspectCertificate(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vObjs, pObjs := newIssuance()
+
+	report, err := Inspect(fixtures.NewSyncContext(vObjs, pObjs), "certificate", types.NamespacedName{Namespace: virtualNamespace, Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Certificate, Host Certificate, CertificateRequest, Order, Challenge, Host Issuer, Host Secret, Secret"
+	if actual := strings.Join(kinds(report), ", "); actual != expected {
+		t.Errorf("expected objects %s, got %s", expected, actual)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+
+	out := &bytes.Buffer{}
+	report.Print(out)
+	for _, expected := range []string{"Not after: 2025-01-01T00:00:00Z", "Revision: 2", "Type: HTTP-01 for web.example.com", "State: pending (Waiting for HTTP-01 challenge propagation)", "No problems found"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestInspectCertificateMultiNamespace(t *testing.T) {
+	fixtures.WithTranslator(t, translate.NewMultiNamespaceTranslator("vcluster"))
+	vObjs, pObjs := newIssuance()
+
+	report, err := Inspect(fixtures.NewSyncContext(vObjs, pObjs), "certificate", types.NamespacedName{Namespace: virtualNamespace, Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host objects keep their names in the host namespace of the virtual namespace
+	if pName := naming.HostName(nil, naming.Certificate, "web", virtualNamespace); pName.Name != "web" || pName.Namespace == virtualNamespace {
+		t.Errorf("unexpected host name %s", pName)
+	}
+	expected := "Certificate, Host Certificate, CertificateRequest, Order, Challenge, Host Issuer, Host Secret, Secret"
+	if actual := strings.Join(kinds(report), ", "); actual != expected {
+		t.Errorf("expected objects %s, got %s", expected, actual)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+}
+
+func TestInspectCertificateProblems(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	vObjs, pObjs := newIssuance()
+
+	// the issuer is gone, the host certificate was changed on the host and the virtual secret
+	// wasn't synced back yet
+	vObjs = vObjs[:1]
+	pCertificate := pObjs[0].(*certmanagerv1.Certificate)
+	pCertificate.Spec.DNSNames = []string{"other.example.com"}
+
+	report, err := Inspect(fixtures.NewSyncContext(vObjs, pObjs), "cert", types.NamespacedName{Namespace: virtualNamespace, Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := strings.Join(report.Problems, "\n")
+	for _, expected := range []string{"was changed outside of the vcluster: dnsNames", "virtual issuer shop/letsencrypt", "virtual secret shop/web-tls doesn't exist"} {
+		if !strings.Contains(problems, expected) {
+			t.Errorf("expected problem %q, got:\n%s", expected, problems)
+		}
+	}
+}
+
+func TestInspectIngress(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	vIngress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "web", Annotations: map[string]string{constants.IssuerAnnotation: "letsencrypt"}},
+		Spec:       networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{{Hosts: []string{"web.example.com"}, SecretName: "web-tls"}}},
+	}
+	pName := translate.Default.HostName(nil, "web", virtualNamespace)
+	pIngress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: pName.Namespace, Name: pName.Name, Annotations: map[string]string{constants.IssuerAnnotation: "letsencrypt"}}}
+
+	report, err := Inspect(fixtures.NewSyncContext([]runtime.Object{vIngress}, []runtime.Object{pIngress}), "ingress", types.NamespacedName{Namespace: virtualNamespace, Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Ingress, Host Ingress, Certificate (missing), Host Certificate (missing)"
+	if actual := strings.Join(kinds(report), ", "); actual != expected {
+		t.Errorf("expected objects %s, got %s", expected, actual)
+	}
+
+	pCertificate := naming.HostName(nil, naming.Secret, "web-tls", virtualNamespace)
+	problems := strings.Join(report.Problems, "\n")
+	for _, expected := range []string{"references issuer \"letsencrypt\" instead of", "virtual issuer shop/letsencrypt", "host certificate " + pCertificate.String() + " doesn't exist"} {
+		if !strings.Contains(problems, expected) {
+			t.Errorf("expected problem %q, got:\n%s", expected, problems)
+		}
+	}
+}
+
+func TestInspectUnknownKind(t *testing.T) {
+	_, err := Inspect(fixtures.NewSyncContext(nil, nil), "secret", types.NamespacedName{Namespace: virtualNamespace, Name: "web"})
+	if err == nil {
+		t.Errorf("expected error for unsupported kind")
+	}
+}
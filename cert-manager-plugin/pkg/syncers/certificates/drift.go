@@ -0,0 +1,179 @@
+package certificates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	// ReasonHostDrift is the reason of the events that report changes made on the host
+	ReasonHostDrift = "HostDrift"
+
+	// ReasonHostDriftAdopted is the reason of the events on virtual certificates that adopted
+	// changes made on the host
+	ReasonHostDriftAdopted = "HostDriftAdopted"
+)
+
+// reconcileDrift returns the spec to write to the host certificate. The host spec drifted if it
+// neither matches the spec the plugin wrote last nor the translated virtual spec. A drifted host
+// spec is overwritten, kept or adopted into the virtual certificate depending on the drift
+// policy. Once the virtual spec changes as well, it's written regardless of the policy, so that
+// changes made inside the vcluster aren't lost. nil means the host spec is kept. A kept drift is
+// only reported once per drifted host spec.
+func (s *certificateSyncer) reconcileDrift(ctx *synccontext.SyncContext, vCertificate, pCertificate *certmanagerv1.Certificate, pSpec *certmanagerv1.CertificateSpec) *certmanagerv1.CertificateSpec {
+	// host certificates created before the hash was recorded can't have drifted
+	lastHash := pCertificate.Annotations[constants.SpecHashAnnotation]
+	hostHash := SpecHash(&pCertificate.Spec)
+	if lastHash == "" || hostHash == lastHash || equality.Semantic.DeepEqual(pCertificate.Spec, *pSpec) {
+		return pSpec
+	}
+
+	changed := strings.Join(ChangedFields(pSpec, &pCertificate.Spec), ", ")
+	if SpecHash(pSpec) != lastHash {
+		ctx.Log.Infof("overwrite changes of host certificate %s/%s (%s), because the virtual certificate changed", pCertificate.Namespace, pCertificate.Name, changed)
+		s.EventRecorder().Eventf(vCertificate, corev1.EventTypeWarning, ReasonHostDrift, "Overwrote changes of host certificate %s/%s with the changed virtual certificate: %s", pCertificate.Namespace, pCertificate.Name, changed)
+		return pSpec
+	}
+
+	alerted := pCertificate.Annotations[constants.DriftAlertedHashAnnotation] == hostHash
+	switch s.driftPolicy {
+	case config.DriftPolicyAlert:
+		if alerted {
+			return nil
+		}
+
+		markAlerted(pCertificate, hostHash)
+		ctx.Log.Infof("host certificate %s/%s was changed outside of the vcluster (%s), keep host change", pCertificate.Namespace, pCertificate.Name, changed)
+		s.EventRecorder().Eventf(vCertificate, corev1.EventTypeWarning, ReasonHostDrift, "Host certificate %s/%s was changed outside of the vcluster: %s", pCertificate.Namespace, pCertificate.Name, changed)
+		return nil
+	case config.DriftPolicyAdopt:
+		vSpec, err := virtualSpec(ctx, vCertificate, &pCertificate.Spec)
+		if err != nil {
+			if alerted {
+				return nil
+			}
+
+			markAlerted(pCertificate, hostHash)
+			ctx.Log.Infof("host certificate %s/%s was changed outside of the vcluster (%s), but can't be adopted: %v", pCertificate.Namespace, pCertificate.Name, changed, err)
+			s.EventRecorder().Eventf(vCertificate, corev1.EventTypeWarning, ReasonHostDrift, "Host certificate %s/%s was changed outside of the vcluster (%s), but can't be adopted: %v", pCertificate.Namespace, pCertificate.Name, changed, err)
+			return nil
+		}
+
+		ctx.Log.Infof("adopt changes of host certificate %s/%s (%s)", pCertificate.Namespace, pCertificate.Name, changed)
+		s.EventRecorder().Eventf(vCertificate, corev1.EventTypeNormal, ReasonHostDriftAdopted, "Adopted changes of host certificate %s/%s: %s", pCertificate.Namespace, pCertificate.Name, changed)
+		vCertificate.Spec = *vSpec
+		return pCertificate.Spec.DeepCopy()
+	default:
+		ctx.Log.Infof("overwrite changes of host certificate %s/%s (%s)", pCertificate.Namespace, pCertificate.Name, changed)
+		s.EventRecorder().Eventf(vCertificate, corev1.EventTypeWarning, ReasonHostDrift, "Overwrote changes of host certificate %s/%s: %s", pCertificate.Namespace, pCertificate.Name, changed)
+		return pSpec
+	}
+}
+
+// markAlerted records the hash of the drifted host spec that was reported
+func markAlerted(pCertificate *certmanagerv1.Certificate, hostHash string) {
+	if pCertificate.Annotations == nil {
+		pCertificate.Annotations = map[string]string{}
+	}
+	pCertificate.Annotations[constants.DriftAlertedHashAnnotation] = hostHash
+}
+
+// virtualSpec translates a host spec back into a virtual spec. The host names the plugin
+// translated are only mapped back if they still belong to the virtual names, as host names
+// that were changed on the host have no virtual counterpart.
+func virtualSpec(ctx *synccontext.SyncContext, vCertificate *certmanagerv1.Certificate, pSpec *certmanagerv1.CertificateSpec) (*certmanagerv1.CertificateSpec, error) {
+	vSpec := pSpec.DeepCopy()
+	restore := func(field string, pName *string, vName string, kind naming.Kind) error {
+		if vName != "" && *pName == naming.HostName(ctx, kind, vName, vCertificate.Namespace).Name {
+			*pName = vName
+			return nil
+		}
+
+		return fmt.Errorf("%s %s has no virtual counterpart", field, *pName)
+	}
+
+	if vSpec.SecretName != "" {
+		err := restore("secretName", &vSpec.SecretName, vCertificate.Spec.SecretName, naming.Secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if vSpec.IssuerRef.Kind == "Issuer" {
+		vIssuerName := ""
+		if vCertificate.Spec.IssuerRef.Kind == "Issuer" {
+			vIssuerName = vCertificate.Spec.IssuerRef.Name
+		}
+		err := restore("issuerRef.name", &vSpec.IssuerRef.Name, vIssuerName, naming.Issuer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if vSpec.Keystores != nil && vSpec.Keystores.JKS != nil {
+		vName := ""
+		if vCertificate.Spec.Keystores != nil && vCertificate.Spec.Keystores.JKS != nil {
+			vName = vCertificate.Spec.Keystores.JKS.PasswordSecretRef.Name
+		}
+		err := restore("keystores.jks.passwordSecretRef.name", &vSpec.Keystores.JKS.PasswordSecretRef.Name, vName, naming.Secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if vSpec.Keystores != nil && vSpec.Keystores.PKCS12 != nil {
+		vName := ""
+		if vCertificate.Spec.Keystores != nil && vCertificate.Spec.Keystores.PKCS12 != nil {
+			vName = vCertificate.Spec.Keystores.PKCS12.PasswordSecretRef.Name
+		}
+		err := restore("keystores.pkcs12.passwordSecretRef.name", &vSpec.Keystores.PKCS12.PasswordSecretRef.Name, vName, naming.Secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return vSpec, nil
+}
+
+// SpecHash returns the hash of a certificate spec
+func SpecHash(spec *certmanagerv1.CertificateSpec) string {
+	out, _ := json.Marshal(spec)
+	hash := sha256.Sum256(out)
+	return hex.EncodeToString(hash[:])
+}
+
+// ChangedFields returns the sorted names of the top level spec fields that differ
+func ChangedFields(a, b *certmanagerv1.CertificateSpec) []string {
+	aFields, bFields := specFields(a), specFields(b)
+	changed := []string{}
+	for field, value := range aFields {
+		other, ok := bFields[field]
+		if !ok || !equality.Semantic.DeepEqual(value, other) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range bFields {
+		if _, ok := aFields[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+func specFields(spec *certmanagerv1.CertificateSpec) map[string]interface{} {
+	fields := map[string]interface{}{}
+	out, _ := json.Marshal(spec)
+	_ = json.Unmarshal(out, &fields)
+	return fields
+}
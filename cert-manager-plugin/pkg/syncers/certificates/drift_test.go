@@ -0,0 +1,205 @@
+package certificates
+
+import (
+	"strings"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeTranslator only provides the event recorder of the syncer
+type fakeTranslator struct {
+	syncertypes.GenericTranslator
+
+	recorder *record.FakeRecorder
+}
+
+func (f *fakeTranslator) EventRecorder() record.EventRecorder {
+	return f.recorder
+}
+
+// newDriftedCertificates returns a virtual certificate and its host certificate, whose spec was
+// written by the plugin and then changed by edit
+func newDriftedCertificates(edit func(spec *certmanagerv1.CertificateSpec)) (*certmanagerv1.Certificate, *certmanagerv1.Certificate) {
+	vCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: certmanagerv1.CertificateSpec{
+			CommonName: "web.example.com",
+			SecretName: "web-tls",
+			IssuerRef:  cmmeta.ObjectReference{Kind: "Issuer", Name: "vault"},
+		},
+	}
+
+	pName := naming.HostName(nil, naming.Certificate, vCertificate.Name, vCertificate.Namespace)
+	pSpec := HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace)
+	pCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pName.Name,
+			Namespace:   pName.Namespace,
+			Annotations: map[string]string{constants.SpecHashAnnotation: SpecHash(pSpec)},
+		},
+		Spec: *pSpec,
+	}
+	edit(&pCertificate.Spec)
+	return vCertificate, pCertificate
+}
+
+func TestReconcileDrift(t *testing.T) {
+	changeCommonName := func(spec *certmanagerv1.CertificateSpec) { spec.CommonName = "changed.example.com" }
+	changeSecretName := func(spec *certmanagerv1.CertificateSpec) { spec.SecretName = "other-tls" }
+
+	tests := []struct {
+		name   string
+		policy string
+		edit   func(spec *certmanagerv1.CertificateSpec)
+
+		expectedCommonName        string
+		expectedVirtualCommonName string
+		expectKept                bool
+		expectedEvent             string
+	}{
+		{
+			name:                      "no drift",
+			policy:                    config.DriftPolicyAlert,
+			edit:                      func(spec *certmanagerv1.CertificateSpec) {},
+			expectedCommonName:        "web.example.com",
+			expectedVirtualCommonName: "web.example.com",
+		},
+		{
+			name:                      "overwrite",
+			policy:                    config.DriftPolicyOverwrite,
+			edit:                      changeCommonName,
+			expectedCommonName:        "web.example.com",
+			expectedVirtualCommonName: "web.example.com",
+			expectedEvent:             "Warning HostDrift Overwrote changes of host certificate",
+		},
+		{
+			name:                      "alert",
+			policy:                    config.DriftPolicyAlert,
+			edit:                      changeCommonName,
+			expectKept:                true,
+			expectedVirtualCommonName: "web.example.com",
+			expectedEvent:             "was changed outside of the vcluster: commonName",
+		},
+		{
+			name:                      "adopt",
+			policy:                    config.DriftPolicyAdopt,
+			edit:                      changeCommonName,
+			expectedCommonName:        "changed.example.com",
+			expectedVirtualCommonName: "changed.example.com",
+			expectedEvent:             "Normal HostDriftAdopted Adopted changes of host certificate",
+		},
+		{
+			name:                      "adopt host name without virtual counterpart",
+			policy:                    config.DriftPolicyAdopt,
+			edit:                      changeSecretName,
+			expectKept:                true,
+			expectedVirtualCommonName: "web.example.com",
+			expectedEvent:             "secretName other-tls has no virtual counterpart",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			syncer := &certificateSyncer{GenericTranslator: &fakeTranslator{recorder: recorder}, driftPolicy: test.policy}
+			vCertificate, pCertificate := newDriftedCertificates(test.edit)
+
+			pSpec := syncer.reconcileDrift(newSyncContext(t), vCertificate, pCertificate, HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace))
+			if test.expectKept != (pSpec == nil) {
+				t.Fatalf("expected host spec to be kept: %v, got %v", test.expectKept, pSpec)
+			}
+			if pSpec != nil && pSpec.CommonName != test.expectedCommonName {
+				t.Errorf("expected host common name %s, got %s", test.expectedCommonName, pSpec.CommonName)
+			}
+			if pSpec != nil && pSpec.SecretName != pCertificate.Spec.SecretName {
+				t.Errorf("expected host secret name %s, got %s", pCertificate.Spec.SecretName, pSpec.SecretName)
+			}
+			if vCertificate.Spec.CommonName != test.expectedVirtualCommonName || vCertificate.Spec.SecretName != "web-tls" || vCertificate.Spec.IssuerRef.Name != "vault" {
+				t.Errorf("unexpected virtual spec %+v", vCertificate.Spec)
+			}
+
+			if test.expectedEvent == "" {
+				if len(recorder.Events) != 0 {
+					t.Errorf("expected no event, got %s", <-recorder.Events)
+				}
+				return
+			}
+			if event := <-recorder.Events; !strings.Contains(event, test.expectedEvent) {
+				t.Errorf("expected event %q, got %q", test.expectedEvent, event)
+			}
+		})
+	}
+}
+
+func TestReconcileDriftAfterVirtualChange(t *testing.T) {
+	for _, policy := range []string{config.DriftPolicyAlert, config.DriftPolicyAdopt} {
+		t.Run(policy, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			syncer := &certificateSyncer{GenericTranslator: &fakeTranslator{recorder: recorder}, driftPolicy: policy}
+			vCertificate, pCertificate := newDriftedCertificates(func(spec *certmanagerv1.CertificateSpec) {
+				spec.SecretName = "other-tls"
+			})
+
+			// the drift is kept while the virtual certificate doesn't change
+			pSpec := syncer.reconcileDrift(newSyncContext(t), vCertificate, pCertificate, HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace))
+			if pSpec != nil {
+				t.Fatalf("expected the host spec to be kept, got %v", pSpec)
+			}
+			<-recorder.Events
+
+			vCertificate.Spec.DNSNames = []string{"web.example.com"}
+			pSpec = syncer.reconcileDrift(newSyncContext(t), vCertificate, pCertificate, HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace))
+			if pSpec == nil || len(pSpec.DNSNames) != 1 || pSpec.SecretName != naming.HostName(nil, naming.Secret, "web-tls", "shop").Name {
+				t.Fatalf("expected the changed virtual spec to be written, got %v", pSpec)
+			}
+			if event := <-recorder.Events; !strings.Contains(event, "with the changed virtual certificate: dnsNames, secretName") {
+				t.Errorf("unexpected event %q", event)
+			}
+		})
+	}
+}
+
+func TestReconcileDriftAlertsOnce(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	syncer := &certificateSyncer{GenericTranslator: &fakeTranslator{recorder: recorder}, driftPolicy: config.DriftPolicyAlert}
+	vCertificate, pCertificate := newDriftedCertificates(func(spec *certmanagerv1.CertificateSpec) {
+		spec.CommonName = "changed.example.com"
+	})
+
+	// the host certificate keeps the annotation written by the first sync
+	for i := 0; i < 2; i++ {
+		pSpec := syncer.reconcileDrift(newSyncContext(t), vCertificate, pCertificate, HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace))
+		if pSpec != nil {
+			t.Fatalf("expected the host spec to be kept, got %v", pSpec)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(recorder.Events))
+	}
+	<-recorder.Events
+
+	// another change on the host is reported again
+	pCertificate.Spec.CommonName = "other.example.com"
+	syncer.reconcileDrift(newSyncContext(t), vCertificate, pCertificate, HostSpec(nil, &vCertificate.Spec, vCertificate.Namespace))
+	if event := <-recorder.Events; !strings.Contains(event, "was changed outside of the vcluster: commonName") {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	a := &certmanagerv1.CertificateSpec{CommonName: "a", DNSNames: []string{"a"}, SecretName: "tls"}
+	b := &certmanagerv1.CertificateSpec{CommonName: "b", SecretName: "tls", IsCA: true}
+
+	changed := strings.Join(ChangedFields(a, b), ",")
+	if changed != "commonName,dnsNames,isCA" {
+		t.Errorf("unexpected changed fields %s", changed)
+	}
+}
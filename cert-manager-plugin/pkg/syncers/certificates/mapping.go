@@ -9,9 +9,10 @@ import (
 	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	context "github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
-	"github.com/loft-sh/vcluster/pkg/util/clienthelper"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -20,65 +21,79 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-var (
-	IndexByIngressCertificate = "indexbyingresscertificate"
-)
+// ingressIndex maps the host certificates the ingress shim creates to the virtual ingresses
+var ingressIndex = owners.Index{
+	OwnerKind: owners.KindIngress,
+	HostKind:  owners.KindCertificate,
+	References: func(obj client.Object) []owners.Reference {
+		return CertificateReferencesFromIngress(obj.(*networkingv1.Ingress))
+	},
+}
 
 type certificateMapper struct {
 	synccontext.Mapper
 
-	virtualClient client.Client
+	owners *owners.Registry
 }
 
-func CreateCertificateMapper(ctx *synccontext.RegisterContext) (synccontext.Mapper, error) {
+func CreateCertificateMapper(ctx *synccontext.RegisterContext, registry *owners.Registry) (synccontext.Mapper, error) {
 	_, _, err := translate.EnsureCRDFromPhysicalCluster(ctx.Context, ctx.PhysicalManager.GetConfig(), ctx.VirtualManager.GetConfig(), certmanagerv1.SchemeGroupVersion.WithKind("Certificate"))
 
 	if err != nil {
 		return nil, err
 	}
-	mapper, err := generic.NewMapperWithoutRecorder(ctx, &certmanagerv1.Certificate{}, func(ctx *synccontext.SyncContext, vName, vNamespace string, _ client.Object) types.NamespacedName {
-		return translate.Default.HostName(ctx, vName, vNamespace)
-	})
+	return NewMapper(ctx, registry)
+}
+
+// NewMapper creates the mapper that translates certificate names between the virtual and the
+// host cluster. Unlike CreateCertificateMapper, it doesn't ensure the Certificate CRD in the
+// virtual cluster, so subcommands that only read can use it.
+func NewMapper(ctx *synccontext.RegisterContext, registry *owners.Registry) (synccontext.Mapper, error) {
+	mapper, err := generic.NewMapperWithoutRecorder(ctx, &certmanagerv1.Certificate{}, naming.PhysicalNameFunc(naming.Certificate))
 	if err != nil {
 		return nil, err
 	}
 
 	return generic.WithRecorder(&certificateMapper{
-		Mapper:        mapper,
-		virtualClient: ctx.VirtualManager.GetClient(),
+		Mapper: mapper,
+		owners: registry,
 	}), nil
 }
 
-var _ syncertypes.IndicesRegisterer = &certificateMapper{}
+var _ syncertypes.IndicesRegisterer = &certificateSyncer{}
 
-func (s *certificateMapper) RegisterIndices(ctx *context.RegisterContext) error {
-	return ctx.VirtualManager.GetFieldIndexer().IndexField(ctx.Context, &networkingv1.Ingress{}, IndexByIngressCertificate, func(rawObj client.Object) []string {
-		return certificateNamesFromIngress(rawObj.(*networkingv1.Ingress))
-	})
+func (s *certificateSyncer) RegisterIndices(ctx *context.RegisterContext) error {
+	err := s.owners.Watch(ctx, &networkingv1.Ingress{}, ingressIndex)
+	if err != nil || !s.routes {
+		return err
+	}
+
+	err = s.owners.Watch(ctx, NewRoute(), routeIndex)
+	if err != nil {
+		return err
+	}
+
+	return s.owners.Watch(ctx, NewRoute(), s.routeSecrets)
 }
 
-var _ syncertypes.ControllerModifier = &certificateMapper{}
+var _ syncertypes.ControllerModifier = &certificateSyncer{}
 
-func (s *certificateMapper) ModifyController(ctx *context.RegisterContext, builder *builder.Builder) (*builder.Builder, error) {
+func (s *certificateSyncer) ModifyController(ctx *context.RegisterContext, builder *builder.Builder) (*builder.Builder, error) {
 	builder = builder.Watches(&networkingv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(mapIngresses))
+	if s.routes {
+		builder = builder.Watches(NewRoute(), handler.EnqueueRequestsFromMapFunc(mapRoutes(ctx.PhysicalManager.GetClient())))
+	}
 	return builder, nil
 }
 
-func (s *certificateMapper) nameByIngress(pObj client.Object) types.NamespacedName {
-	vIngress := &networkingv1.Ingress{}
-	err := clienthelper.GetByIndex(context2.TODO(), s.virtualClient, vIngress, IndexByIngressCertificate, pObj.GetName())
-	if err == nil && vIngress.Name != "" {
-		for _, secret := range vIngress.Spec.TLS {
-			if translate.Default.HostName(nil, secret.SecretName, vIngress.Namespace).Name == pObj.GetName() {
-				return types.NamespacedName{
-					Name:      secret.SecretName,
-					Namespace: vIngress.Namespace,
-				}
-			}
-		}
+// nameByIngress returns the virtual name of a host certificate that was created for a virtual ingress
+func nameByIngress(registry *owners.Registry, pObj client.Object) types.NamespacedName {
+	owner, ok := registry.Owner(owners.KindCertificate, types.NamespacedName{Namespace: pObj.GetNamespace(), Name: pObj.GetName()}, owners.KindIngress)
+	if !ok {
+		return types.NamespacedName{}
 	}
 
-	return types.NamespacedName{}
+	return owner.Target
 }
 
 func (s *certificateMapper) HostToVirtual(ctx *synccontext.SyncContext, req types.NamespacedName, pObj client.Object) types.NamespacedName {
@@ -87,14 +102,28 @@ func (s *certificateMapper) HostToVirtual(ctx *synccontext.SyncContext, req type
 		return namespacedName
 	}
 
-	namespacedName = s.nameByIngress(pObj)
+	namespacedName = nameByIngress(s.owners, pObj)
 	if namespacedName.Name != "" {
 		return namespacedName
 	}
 
-	return types.NamespacedName{}
+	return nameByRoute(s.owners, pObj)
 }
 
+func (s *certificateMapper) VirtualToHost(ctx *synccontext.SyncContext, req types.NamespacedName, vObj client.Object) types.NamespacedName {
+	// the ingress shim names certificates after the secret, which can differ from the host
+	// name the naming strategy chooses for certificates
+	pName := naming.HostName(ctx, naming.Secret, req.Name, req.Namespace)
+	for _, owner := range s.owners.Owners(owners.KindCertificate, pName, owners.KindIngress) {
+		if owner.Target == req {
+			return pName
+		}
+	}
+
+	return s.Mapper.VirtualToHost(ctx, req, vObj)
+}
+
+// certificateNamesFromIngress returns the virtual names of the certificates requested by the ingress
 func certificateNamesFromIngress(ingress *networkingv1.Ingress) []string {
 	certificates := []string{}
 
@@ -105,13 +134,31 @@ func certificateNamesFromIngress(ingress *networkingv1.Ingress) []string {
 				continue
 			}
 
-			certificates = append(certificates, translate.Default.HostName(nil, secret.SecretName, ingress.Namespace).Name)
 			certificates = append(certificates, ingress.Namespace+"/"+secret.SecretName)
 		}
 	}
 	return certificates
 }
 
+// CertificateReferencesFromIngress returns the host certificates requested by the ingress. The ingress
+// shim names certificates after the secret, so these are the host names of the ingress secrets.
+func CertificateReferencesFromIngress(ingress *networkingv1.Ingress) []owners.Reference {
+	references := []owners.Reference{}
+	if ingress.Annotations != nil && (ingress.Annotations[constants.IssuerAnnotation] != "" || ingress.Annotations[constants.ClusterIssuerAnnotation] != "") {
+		for _, secret := range ingress.Spec.TLS {
+			if secret.SecretName == "" {
+				continue
+			}
+
+			references = append(references, owners.Reference{
+				Host:   naming.HostName(nil, naming.Secret, secret.SecretName, ingress.Namespace),
+				Target: types.NamespacedName{Namespace: ingress.Namespace, Name: secret.SecretName},
+			})
+		}
+	}
+	return references
+}
+
 func mapIngresses(ctx context2.Context, obj client.Object) []reconcile.Request {
 	ingress, ok := obj.(*networkingv1.Ingress)
 	if !ok {
@@ -0,0 +1,225 @@
+package certificates
+
+import (
+	"context"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var translators = map[string]translate.Translator{
+	"single namespace": translate.NewSingleNamespaceTranslator("vcluster"),
+	"multi namespace":  translate.NewMultiNamespaceTranslator("vcluster"),
+}
+
+func newIngress(namespace, name, secretName string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Annotations: map[string]string{
+				constants.IssuerAnnotation: "letsencrypt",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{{SecretName: secretName}},
+		},
+	}
+}
+
+func newRegistry(ingresses ...*networkingv1.Ingress) *owners.Registry {
+	registry := owners.NewRegistry()
+	for _, ingress := range ingresses {
+		registry.Update(ingressIndex, ingress)
+	}
+
+	return registry
+}
+
+func TestNameByIngress(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			// both ingresses use the same secret name in different namespaces
+			registry := newRegistry(
+				newIngress("team-a", "web", "web-tls"),
+				newIngress("team-b", "web", "web-tls"),
+			)
+
+			for _, namespace := range []string{"team-a", "team-b"} {
+				pName := naming.HostName(nil, naming.Secret, "web-tls", namespace)
+				pCertificate := &certmanagerv1.Certificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      pName.Name,
+						Namespace: pName.Namespace,
+					},
+				}
+
+				expected := types.NamespacedName{Namespace: namespace, Name: "web-tls"}
+				if actual := nameByIngress(registry, pCertificate); actual != expected {
+					t.Errorf("expected host certificate %s to map to %s, got %s", pName, expected, actual)
+				}
+			}
+
+			// a certificate in a namespace that is not synced by vcluster does not match
+			pCertificate := &certmanagerv1.Certificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      naming.HostName(nil, naming.Secret, "web-tls", "team-a").Name,
+					Namespace: "other",
+				},
+			}
+			if actual := nameByIngress(registry, pCertificate); actual.Name != "" {
+				t.Errorf("expected certificate %s/%s not to map to a virtual certificate, got %s", pCertificate.Namespace, pCertificate.Name, actual)
+			}
+
+			// a deleted ingress no longer owns its certificate
+			registry.Delete(owners.KindIngress, newIngress("team-a", "web", "web-tls"))
+			pName := naming.HostName(nil, naming.Secret, "web-tls", "team-a")
+			pCertificate = &certmanagerv1.Certificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      pName.Name,
+					Namespace: pName.Namespace,
+				},
+			}
+			if actual := nameByIngress(registry, pCertificate); actual.Name != "" {
+				t.Errorf("expected certificate %s not to map to a virtual certificate after the ingress was deleted, got %s", pName, actual)
+			}
+		})
+	}
+}
+
+func TestMapIngresses(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			requests := mapIngresses(context.Background(), newIngress("team-a", "web", "web-tls"))
+			expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "web-tls"}}}
+			if len(requests) != len(expected) || requests[0] != expected[0] {
+				t.Errorf("expected requests %v, got %v", expected, requests)
+			}
+		})
+	}
+}
+
+func newRoute(namespace, name string) *unstructured.Unstructured {
+	route := NewRoute()
+	route.SetNamespace(namespace)
+	route.SetName(name)
+	route.SetAnnotations(map[string]string{constants.IssuerNameAnnotation: "letsencrypt"})
+	return route
+}
+
+// newRouteCertificate returns a host certificate the route integration created for the host route
+func newRouteCertificate(pRoute types.NamespacedName, name, secretName string) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pRoute.Namespace,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: RouteGroupVersionKind.GroupVersion().String(),
+				Kind:       RouteGroupVersionKind.Kind,
+				Name:       pRoute.Name,
+			}},
+		},
+		Spec: certmanagerv1.CertificateSpec{SecretName: secretName},
+	}
+}
+
+func TestNameByRoute(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			registry := owners.NewRegistry()
+			registry.Update(routeIndex, newRoute("team-a", "web"))
+
+			pRoute := translator.HostName(nil, "web", "team-a")
+			expected := types.NamespacedName{Namespace: "team-a", Name: "web-cert"}
+			if actual := nameByRoute(registry, newRouteCertificate(pRoute, pRoute.Name+"-cert", pRoute.Name+"-tls")); actual != expected {
+				t.Errorf("expected host certificate of route %s to map to %s, got %s", pRoute, expected, actual)
+			}
+
+			// certificates that aren't named after the route or belong to another route don't match
+			if actual := nameByRoute(registry, newRouteCertificate(pRoute, "other", "other")); actual.Name != "" {
+				t.Errorf("expected certificate not named after the route not to map to a virtual certificate, got %s", actual)
+			}
+			other := translator.HostName(nil, "api", "team-a")
+			if actual := nameByRoute(registry, newRouteCertificate(other, other.Name+"-cert", other.Name+"-tls")); actual.Name != "" {
+				t.Errorf("expected certificate of an unknown route not to map to a virtual certificate, got %s", actual)
+			}
+
+			// routes without the annotations aren't indexed
+			unannotated := newRoute("team-a", "web")
+			unannotated.SetAnnotations(nil)
+			registry.Update(routeIndex, unannotated)
+			if actual := nameByRoute(registry, newRouteCertificate(pRoute, pRoute.Name+"-cert", pRoute.Name+"-tls")); actual.Name != "" {
+				t.Errorf("expected certificate of an unannotated route not to map to a virtual certificate, got %s", actual)
+			}
+		})
+	}
+}
+
+func TestMapRoutes(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			pRoute := translator.HostName(nil, "web", "team-a")
+			physicalClient := testingutil.NewFakeClient(scheme.Scheme,
+				newRouteCertificate(pRoute, pRoute.Name+"-cert", pRoute.Name+"-tls"),
+				&certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: pRoute.Name + "-other", Namespace: pRoute.Namespace}},
+			)
+
+			requests := mapRoutes(physicalClient)(context.Background(), newRoute("team-a", "web"))
+			expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "web-cert"}}}
+			if len(requests) != len(expected) || requests[0] != expected[0] {
+				t.Errorf("expected requests %v, got %v", expected, requests)
+			}
+		})
+	}
+}
+
+func TestRouteSecretIndex(t *testing.T) {
+	tests := map[string]struct {
+		expectReferences bool
+	}{
+		"single namespace": {expectReferences: true},
+		// the host secret is named like any other secret of a certificate
+		"multi namespace": {expectReferences: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			translator := translators[name]
+			fixtures.WithTranslator(t, translator)
+
+			pRoute := translator.HostName(nil, "web", "team-a")
+			physicalClient := testingutil.NewFakeClient(scheme.Scheme, newRouteCertificate(pRoute, pRoute.Name+"-cert", pRoute.Name+"-tls"))
+
+			registry := owners.NewRegistry()
+			registry.Update(routeSecretIndex(physicalClient), newRoute("team-a", "web"))
+
+			owner, ok := registry.Owner(owners.KindSecret, types.NamespacedName{Namespace: pRoute.Namespace, Name: pRoute.Name + "-tls"}, owners.KindRoute)
+			if ok != test.expectReferences {
+				t.Fatalf("expected host secret to be owned: %v, got %v", test.expectReferences, owner)
+			}
+			if ok && (owner.Object.Name != "web" || owner.Target != (types.NamespacedName{Namespace: "team-a", Name: "web-tls"})) {
+				t.Errorf("unexpected owner %v", owner)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package certificates
+
+import (
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReasonManuallyTriggered is the reason of the Issuing condition cmctl renew sets
+	ReasonManuallyTriggered = "ManuallyTriggered"
+
+	// ReasonRenewalForwarded is the reason of the events on virtual certificates whose renewal
+	// request was forwarded to the host
+	ReasonRenewalForwarded = "RenewalForwarded"
+)
+
+// forwardRenewal forwards a manual renewal request of the virtual certificate to the host
+// certificate by setting the Issuing condition there, like cmctl renew does. The host status,
+// and with it the outcome of the renewal, is copied back into the virtual certificate
+// afterwards. Returns whether the host certificate was updated.
+func (s *certificateSyncer) forwardRenewal(ctx *synccontext.SyncContext, pCertificate, vCertificate *certmanagerv1.Certificate) (bool, error) {
+	record, condition := renewalRequest(pCertificate, vCertificate)
+	if len(record) == 0 {
+		return false, nil
+	}
+
+	updated := pCertificate.DeepCopy()
+	if condition != nil {
+		ctx.Log.Infof("forward renewal request of virtual certificate %s/%s to host certificate %s/%s", vCertificate.Namespace, vCertificate.Name, pCertificate.Namespace, pCertificate.Name)
+		s.EventRecorder().Eventf(vCertificate, corev1.EventTypeNormal, ReasonRenewalForwarded, "Forwarded renewal request to host certificate %s/%s", pCertificate.Namespace, pCertificate.Name)
+		setCondition(updated, *condition)
+		err := ctx.PhysicalClient.Status().Update(ctx.Context, updated)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// remember the request, so that it's forwarded only once
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	for k, v := range record {
+		updated.Annotations[k] = v
+	}
+	return true, ctx.PhysicalClient.Update(ctx.Context, updated)
+}
+
+// renewalRequest returns the annotations that record a new renewal request on the host
+// certificate and the Issuing condition to set there. The host annotations hold the requests
+// that were forwarded already. No annotations mean there is no new request, a nil condition
+// means the request only needs to be recorded.
+//
+// Forwarded conditions are identified by their transition time, which is kept when the host
+// status is copied back. Renewals triggered on the host are recorded as well, so that their
+// conditions aren't forwarded back once they were copied into the virtual certificate.
+func renewalRequest(pCertificate, vCertificate *certmanagerv1.Certificate) (map[string]string, *certmanagerv1.CertificateCondition) {
+	forwarded := pCertificate.Annotations[constants.RenewalForwardedAnnotation]
+	hostCondition := issuing(pCertificate)
+
+	// the request annotation is mirrored on the host
+	requested := vCertificate.Annotations[constants.RenewRequestedAtAnnotation]
+	if requested != "" && requested != pCertificate.Annotations[constants.RenewRequestedAtAnnotation] {
+		record := map[string]string{constants.RenewRequestedAtAnnotation: requested}
+		if hostCondition != nil {
+			return record, nil
+		}
+
+		now := metav1.Now()
+		condition := &certmanagerv1.CertificateCondition{
+			Type:               certmanagerv1.CertificateConditionIssuing,
+			Status:             cmmeta.ConditionTrue,
+			Reason:             ReasonManuallyTriggered,
+			Message:            "Certificate re-issuance manually triggered from the vcluster with the " + constants.RenewRequestedAtAnnotation + " annotation",
+			LastTransitionTime: &now,
+			ObservedGeneration: pCertificate.Generation,
+		}
+		record[constants.RenewalForwardedAnnotation] = transitionTime(condition)
+		return record, condition
+	}
+
+	if hostCondition != nil {
+		if hostCondition.Reason == ReasonManuallyTriggered && transitionTime(hostCondition) != forwarded {
+			return map[string]string{constants.RenewalForwardedAnnotation: transitionTime(hostCondition)}, nil
+		}
+		return nil, nil
+	}
+
+	condition := issuing(vCertificate)
+	if condition == nil || condition.Reason != ReasonManuallyTriggered || transitionTime(condition) == forwarded {
+		return nil, nil
+	}
+	forward := condition.DeepCopy()
+	forward.ObservedGeneration = pCertificate.Generation
+	return map[string]string{constants.RenewalForwardedAnnotation: transitionTime(condition)}, forward
+}
+
+// issuing returns the Issuing condition of the certificate if it's true
+func issuing(certificate *certmanagerv1.Certificate) *certmanagerv1.CertificateCondition {
+	for i := range certificate.Status.Conditions {
+		condition := &certificate.Status.Conditions[i]
+		if condition.Type == certmanagerv1.CertificateConditionIssuing && condition.Status == cmmeta.ConditionTrue {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+// transitionTime identifies a condition by its transition time
+func transitionTime(condition *certmanagerv1.CertificateCondition) string {
+	if condition.LastTransitionTime == nil {
+		return ""
+	}
+
+	return condition.LastTransitionTime.UTC().Format(time.RFC3339)
+}
+
+// setCondition replaces the condition of the same type or adds it
+func setCondition(certificate *certmanagerv1.Certificate, condition certmanagerv1.CertificateCondition) {
+	for i := range certificate.Status.Conditions {
+		if certificate.Status.Conditions[i].Type == condition.Type {
+			certificate.Status.Conditions[i] = condition
+			return
+		}
+	}
+
+	certificate.Status.Conditions = append(certificate.Status.Conditions, condition)
+}
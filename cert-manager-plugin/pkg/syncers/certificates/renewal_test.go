@@ -0,0 +1,124 @@
+package certificates
+
+import (
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRenewalCertificate(annotations map[string]string, issuing *metav1.Time, reason string) *certmanagerv1.Certificate {
+	certificate := &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: annotations, Generation: 2}}
+	if issuing != nil {
+		certificate.Status.Conditions = []certmanagerv1.CertificateCondition{{
+			Type:               certmanagerv1.CertificateConditionIssuing,
+			Status:             cmmeta.ConditionTrue,
+			Reason:             reason,
+			LastTransitionTime: issuing,
+		}}
+	}
+	return certificate
+}
+
+func TestRenewalRequest(t *testing.T) {
+	requested := metav1.NewTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	forwarded := map[string]string{constants.RenewalForwardedAnnotation: "2024-05-01T10:00:00Z"}
+
+	tests := []struct {
+		name             string
+		pCertificate     *certmanagerv1.Certificate
+		vCertificate     *certmanagerv1.Certificate
+		expectedRecord   map[string]string
+		expectedForward  bool
+		expectedReason   string
+		expectedIssuedAt string
+	}{
+		{
+			name:         "no request",
+			pCertificate: newRenewalCertificate(nil, nil, ""),
+			vCertificate: newRenewalCertificate(nil, nil, ""),
+		},
+		{
+			name:            "new annotation",
+			pCertificate:    newRenewalCertificate(nil, nil, ""),
+			vCertificate:    newRenewalCertificate(map[string]string{constants.RenewRequestedAtAnnotation: "now"}, nil, ""),
+			expectedRecord:  map[string]string{constants.RenewRequestedAtAnnotation: "now"},
+			expectedForward: true,
+			expectedReason:  ReasonManuallyTriggered,
+		},
+		{
+			name:         "annotation forwarded already",
+			pCertificate: newRenewalCertificate(map[string]string{constants.RenewRequestedAtAnnotation: "now"}, nil, ""),
+			vCertificate: newRenewalCertificate(map[string]string{constants.RenewRequestedAtAnnotation: "now"}, nil, ""),
+		},
+		{
+			name:           "annotation while the host is issuing",
+			pCertificate:   newRenewalCertificate(nil, &requested, "DoesNotExist"),
+			vCertificate:   newRenewalCertificate(map[string]string{constants.RenewRequestedAtAnnotation: "now"}, nil, ""),
+			expectedRecord: map[string]string{constants.RenewRequestedAtAnnotation: "now"},
+		},
+		{
+			name:             "cmctl renew",
+			pCertificate:     newRenewalCertificate(nil, nil, ""),
+			vCertificate:     newRenewalCertificate(nil, &requested, ReasonManuallyTriggered),
+			expectedRecord:   forwarded,
+			expectedForward:  true,
+			expectedReason:   ReasonManuallyTriggered,
+			expectedIssuedAt: "2024-05-01T10:00:00Z",
+		},
+		{
+			name:         "copied back condition",
+			pCertificate: newRenewalCertificate(forwarded, nil, ""),
+			vCertificate: newRenewalCertificate(nil, &requested, ReasonManuallyTriggered),
+		},
+		{
+			name:         "other issuing reason",
+			pCertificate: newRenewalCertificate(nil, nil, ""),
+			vCertificate: newRenewalCertificate(nil, &requested, "Expiring"),
+		},
+		{
+			name:           "renewal triggered on the host",
+			pCertificate:   newRenewalCertificate(nil, &requested, ReasonManuallyTriggered),
+			vCertificate:   newRenewalCertificate(nil, nil, ""),
+			expectedRecord: forwarded,
+		},
+		{
+			name:         "forwarded renewal in progress",
+			pCertificate: newRenewalCertificate(forwarded, &requested, ReasonManuallyTriggered),
+			vCertificate: newRenewalCertificate(nil, &requested, ReasonManuallyTriggered),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record, condition := renewalRequest(test.pCertificate, test.vCertificate)
+			for k, v := range test.expectedRecord {
+				if record[k] != v {
+					t.Errorf("expected annotation %s=%s to be recorded, got %v", k, v, record)
+				}
+			}
+			if len(test.expectedRecord) == 0 && len(record) > 0 {
+				t.Errorf("expected nothing to be recorded, got %v", record)
+			}
+
+			if test.expectedForward != (condition != nil) {
+				t.Fatalf("expected forward: %v, got %v", test.expectedForward, condition)
+			}
+			if condition == nil {
+				return
+			}
+			if condition.Reason != test.expectedReason || condition.ObservedGeneration != test.pCertificate.Generation {
+				t.Errorf("unexpected condition %v", condition)
+			}
+			if record[constants.RenewalForwardedAnnotation] != transitionTime(condition) {
+				t.Errorf("expected the forwarded condition to be recorded, got %v", record)
+			}
+			if test.expectedIssuedAt != "" && transitionTime(condition) != test.expectedIssuedAt {
+				t.Errorf("expected transition time %s to be kept, got %s", test.expectedIssuedAt, transitionTime(condition))
+			}
+		})
+	}
+}
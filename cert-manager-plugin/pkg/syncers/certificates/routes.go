@@ -0,0 +1,215 @@
+package certificates
+
+import (
+	context2 "context"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RouteGroupVersionKind is the kind of OpenShift Routes. Routes are handled as unstructured
+// objects, so the plugin doesn't depend on the OpenShift API.
+var RouteGroupVersionKind = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// NewRoute returns an empty unstructured Route
+func NewRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(RouteGroupVersionKind)
+	return route
+}
+
+// routeIndex maps the host routes to the annotated virtual routes. The route integration names
+// the certificates it creates after the host route and sets the route as their owner, so the
+// certificates are found through their owner instead of by name like the ones of ingresses.
+var routeIndex = owners.Index{
+	OwnerKind: owners.KindRoute,
+	HostKind:  owners.KindRoute,
+	References: func(obj client.Object) []owners.Reference {
+		if !RouteAnnotated(obj) {
+			return nil
+		}
+
+		return []owners.Reference{{
+			Host:   translate.Default.HostName(nil, obj.GetName(), obj.GetNamespace()),
+			Target: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+		}}
+	},
+}
+
+// RouteAnnotated checks if the route requests a certificate from cert-manager's route integration
+func RouteAnnotated(route client.Object) bool {
+	annotations := route.GetAnnotations()
+	return annotations[constants.IssuerNameAnnotation] != "" || annotations[constants.IssuerAnnotation] != ""
+}
+
+// routeOwner returns the name of the host route that owns the host object
+func routeOwner(pObj client.Object) string {
+	for _, ownerReference := range pObj.GetOwnerReferences() {
+		gv, err := schema.ParseGroupVersion(ownerReference.APIVersion)
+		if err == nil && gv.Group == RouteGroupVersionKind.Group && ownerReference.Kind == RouteGroupVersionKind.Kind {
+			return ownerReference.Name
+		}
+	}
+
+	return ""
+}
+
+// routeOf returns the host and the virtual route of a host certificate created by the route
+// integration
+func routeOf(registry *owners.Registry, pObj client.Object) (string, types.NamespacedName, bool) {
+	pRoute := routeOwner(pObj)
+	if pRoute == "" {
+		return "", types.NamespacedName{}, false
+	}
+
+	owner, ok := registry.Owner(owners.KindRoute, types.NamespacedName{Namespace: pObj.GetNamespace(), Name: pRoute}, owners.KindRoute)
+	if !ok {
+		return "", types.NamespacedName{}, false
+	}
+
+	return pRoute, owner.Target, true
+}
+
+// nameByRoute returns the virtual name of a host certificate that was created for a virtual route
+func nameByRoute(registry *owners.Registry, pObj client.Object) types.NamespacedName {
+	pRoute, vRoute, ok := routeOf(registry, pObj)
+	if !ok {
+		return types.NamespacedName{}
+	}
+
+	name, ok := virtualRouteName(pRoute, vRoute.Name, pObj.GetName())
+	if !ok {
+		return types.NamespacedName{}
+	}
+
+	return types.NamespacedName{Namespace: vRoute.Namespace, Name: name}
+}
+
+// virtualRouteName replaces the host route name the name starts with by the virtual route name,
+// e.g. web-x-shop-x-vcluster-cert becomes web-cert for the virtual route web
+func virtualRouteName(pRoute, vRoute, pName string) (string, bool) {
+	if !strings.HasPrefix(pName, pRoute) {
+		return "", false
+	}
+
+	return vRoute + strings.TrimPrefix(pName, pRoute), true
+}
+
+// routeSecretIndex maps the host secrets of the certificates the route integration created for a
+// host route to the virtual secrets, e.g. web-x-shop-x-vcluster-tls to web-tls for the virtual route
+// web. The secrets are named on the host, so they are looked up through the host certificates owned
+// by the host route. Secrets whose host name follows from the virtual name, as in multi-namespace
+// mode, are left to the certificate index of the secret syncer.
+func routeSecretIndex(physicalClient client.Reader) owners.Index {
+	return owners.Index{
+		OwnerKind: owners.KindRoute,
+		HostKind:  owners.KindSecret,
+		References: func(obj client.Object) []owners.Reference {
+			if !RouteAnnotated(obj) {
+				return nil
+			}
+
+			pRoute := translate.Default.HostName(nil, obj.GetName(), obj.GetNamespace())
+			certificates, err := routeCertificates(context2.TODO(), physicalClient, pRoute)
+			if err != nil {
+				return nil
+			}
+
+			references := []owners.Reference{}
+			for _, certificate := range certificates {
+				name, ok := virtualRouteName(pRoute.Name, obj.GetName(), certificate.Spec.SecretName)
+				if !ok {
+					continue
+				}
+
+				pSecret := types.NamespacedName{Namespace: pRoute.Namespace, Name: certificate.Spec.SecretName}
+				if naming.HostName(nil, naming.Secret, name, obj.GetNamespace()) == pSecret {
+					continue
+				}
+
+				references = append(references, owners.Reference{
+					Host:   pSecret,
+					Target: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name},
+				})
+			}
+
+			return references
+		},
+	}
+}
+
+// updateRouteSecrets refreshes the secrets of the virtual route that owns the host certificate.
+// The route integration creates the host certificates after the route was observed, so the
+// secrets can't be known when the route changes.
+func (s *certificateSyncer) updateRouteSecrets(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate) error {
+	_, vName, ok := routeOf(s.owners, pCertificate)
+	if !ok {
+		return nil
+	}
+
+	vRoute := NewRoute()
+	err := ctx.VirtualClient.Get(ctx.Context, vName, vRoute)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	s.owners.Update(s.routeSecrets, vRoute)
+	return nil
+}
+
+// routeCertificates returns the host certificates the route integration created for the host route
+func routeCertificates(ctx context2.Context, physicalClient client.Reader, pRoute types.NamespacedName) ([]certmanagerv1.Certificate, error) {
+	certificateList := &certmanagerv1.CertificateList{}
+	err := physicalClient.List(ctx, certificateList, client.InNamespace(pRoute.Namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := []certmanagerv1.Certificate{}
+	for i := range certificateList.Items {
+		if routeOwner(&certificateList.Items[i]) == pRoute.Name {
+			certificates = append(certificates, certificateList.Items[i])
+		}
+	}
+
+	return certificates, nil
+}
+
+// mapRoutes enqueues the certificates the route integration created for a virtual route. Their
+// names are chosen on the host, so the host certificates owned by the host route are listed.
+func mapRoutes(physicalClient client.Client) handler.MapFunc {
+	return func(ctx context2.Context, obj client.Object) []reconcile.Request {
+		if !RouteAnnotated(obj) {
+			return nil
+		}
+
+		pRoute := translate.Default.HostName(nil, obj.GetName(), obj.GetNamespace())
+		certificates, err := routeCertificates(ctx, physicalClient, pRoute)
+		if err != nil {
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for _, certificate := range certificates {
+			name, ok := virtualRouteName(pRoute.Name, obj.GetName(), certificate.Name)
+			if ok {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name},
+				})
+			}
+		}
+
+		return requests
+	}
+}
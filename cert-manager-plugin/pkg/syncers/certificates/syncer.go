@@ -1,8 +1,8 @@
 package certificates
 
 import (
-	context2 "context"
 	"fmt"
+	"maps"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/loft-sh/vcluster/pkg/patcher"
@@ -10,10 +10,12 @@ import (
 	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	"github.com/loft-sh/vcluster/pkg/syncer/translator"
 	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
-	"github.com/loft-sh/vcluster/pkg/util/clienthelper"
-	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/approverpolicy"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
-	networkingv1 "k8s.io/api/networking/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -22,8 +24,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func New(ctx *synccontext.RegisterContext) (syncertypes.Syncer, error) {
-	mapper, err := CreateCertificateMapper(ctx)
+func New(ctx *synccontext.RegisterContext, cfg *config.Config, registry *owners.Registry, resolver *conflicts.Resolver) (syncertypes.Syncer, error) {
+	mapper, err := CreateCertificateMapper(ctx, registry)
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +33,11 @@ func New(ctx *synccontext.RegisterContext) (syncertypes.Syncer, error) {
 		GenericTranslator: translator.NewGenericTranslator(ctx, "certificate", &certmanagerv1.Certificate{}, mapper),
 
 		virtualClient: ctx.VirtualManager.GetClient(),
+		owners:        registry,
+		conflicts:     resolver,
+		driftPolicy:   cfg.DriftPolicy,
+		routes:        cfg.Routes.Enabled,
+		routeSecrets:  routeSecretIndex(ctx.PhysicalManager.GetClient()),
 	}, nil
 }
 
@@ -38,6 +45,11 @@ type certificateSyncer struct {
 	syncertypes.GenericTranslator
 
 	virtualClient client.Client
+	owners        *owners.Registry
+	conflicts     *conflicts.Resolver
+	driftPolicy   string
+	routes        bool
+	routeSecrets  owners.Index
 }
 
 func (f *certificateSyncer) Syncer() syncertypes.Sync[client.Object] {
@@ -45,7 +57,7 @@ func (f *certificateSyncer) Syncer() syncertypes.Sync[client.Object] {
 }
 
 func (s *certificateSyncer) SyncToHost(ctx *synccontext.SyncContext, evt *synccontext.SyncToHostEvent[*certmanagerv1.Certificate]) (ctrl.Result, error) {
-	// was certificate created by ingress?
+	// was certificate created by ingress or route?
 	shouldSync, _ := s.shouldSyncBackwards(nil, evt.Virtual)
 	if shouldSync {
 		// delete here as certificate is no longer needed
@@ -53,10 +65,21 @@ func (s *certificateSyncer) SyncToHost(ctx *synccontext.SyncContext, evt *syncco
 		return ctrl.Result{}, ctx.VirtualClient.Delete(ctx.Context, evt.Virtual)
 	}
 
+	// don't create the certificate if another owner claims its secret
+	if !s.conflicts.Allowed(owners.KindCertificate, evt.Virtual, owners.KindSecret, SecretReference(ctx, evt.Virtual)) {
+		return ctrl.Result{}, nil
+	}
+
 	return patcher.CreateHostObject(ctx, evt.Virtual, s.translate(ctx, evt.Virtual), s.EventRecorder(), true)
 }
 
 func (s *certificateSyncer) Sync(ctx *synccontext.SyncContext, evt *synccontext.SyncEvent[*certmanagerv1.Certificate]) (_ ctrl.Result, retErr error) {
+	// forward manual renewals before the virtual status is overwritten with the host status
+	forwarded, err := s.forwardRenewal(ctx, evt.Host, evt.Virtual)
+	if err != nil || forwarded {
+		return ctrl.Result{}, err
+	}
+
 	if !equality.Semantic.DeepEqual(evt.Virtual.Status, evt.Host.Status) {
 		newIssuer := evt.Virtual.DeepCopy()
 		newIssuer.Status = evt.Host.Status
@@ -70,9 +93,19 @@ func (s *certificateSyncer) Sync(ctx *synccontext.SyncContext, evt *synccontext.
 		return ctrl.Result{}, nil
 	}
 
-	// was certificate created by ingress?
-	shouldSync, _ := s.shouldSyncBackwards(evt.Host, evt.Virtual)
+	// was certificate created by ingress or route?
+	shouldSync, vName := s.shouldSyncBackwards(evt.Host, evt.Virtual)
 	if shouldSync {
+		err := s.labelHost(ctx, evt.Host, vName.Namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		err = s.updateRouteSecrets(ctx, evt.Host)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
 		updated, err := s.translateUpdateBackwards(ctx, evt.Host, evt.Virtual)
 		if err != nil {
 			return ctrl.Result{}, err
@@ -85,6 +118,11 @@ func (s *certificateSyncer) Sync(ctx *synccontext.SyncContext, evt *synccontext.
 		return ctrl.Result{}, nil
 	}
 
+	// don't update the certificate if another owner claims its secret
+	if !s.conflicts.Allowed(owners.KindCertificate, evt.Virtual, owners.KindSecret, SecretReference(ctx, evt.Virtual)) {
+		return ctrl.Result{}, nil
+	}
+
 	patchHelper, err := patcher.NewSyncerPatcher(ctx, evt.Host, evt.Virtual)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("new syncer patcher: %w", err)
@@ -107,6 +145,16 @@ func (s *certificateSyncer) Sync(ctx *synccontext.SyncContext, evt *synccontext.
 
 var _ syncertypes.Syncer = &certificateSyncer{}
 
+// IsManaged also treats the host certificates the ingress shim and the route integration create
+// for virtual ingresses and routes as managed, as they don't copy the vcluster markers onto them
+func (s *certificateSyncer) IsManaged(ctx *synccontext.SyncContext, pObj client.Object) (bool, error) {
+	if nameByIngress(s.owners, pObj).Name != "" || nameByRoute(s.owners, pObj).Name != "" {
+		return true, nil
+	}
+
+	return s.GenericTranslator.IsManaged(ctx, pObj)
+}
+
 func (s *certificateSyncer) shouldSyncBackwards(pCertificate, vCertificate *certmanagerv1.Certificate) (bool, types.NamespacedName) {
 	// we sync secrets that were generated from certificates or issuers into the vcluster
 	if vCertificate != nil && vCertificate.Annotations != nil && vCertificate.Annotations[constants.BackwardSyncAnnotation] == "true" {
@@ -118,7 +166,12 @@ func (s *certificateSyncer) shouldSyncBackwards(pCertificate, vCertificate *cert
 		return false, types.NamespacedName{}
 	}
 
-	name := s.nameByIngress(pCertificate)
+	name := nameByIngress(s.owners, pCertificate)
+	if name.Name != "" {
+		return true, name
+	}
+
+	name = nameByRoute(s.owners, pCertificate)
 	if name.Name != "" {
 		return true, name
 	}
@@ -126,28 +179,48 @@ func (s *certificateSyncer) shouldSyncBackwards(pCertificate, vCertificate *cert
 	return false, types.NamespacedName{}
 }
 
-// TODO: This function is duplicated and also exists in the mapper
-func (s *certificateSyncer) nameByIngress(pObj client.Object) types.NamespacedName {
-	vIngress := &networkingv1.Ingress{}
-	err := clienthelper.GetByIndex(context2.TODO(), s.virtualClient, vIngress, IndexByIngressCertificate, pObj.GetName())
-	if err == nil && vIngress.Name != "" {
-		for _, secret := range vIngress.Spec.TLS {
-			if translate.Default.HostName(nil, secret.SecretName, vIngress.Namespace).Name == pObj.GetName() {
-				return types.NamespacedName{
-					Name:      secret.SecretName,
-					Namespace: vIngress.Namespace,
-				}
-			}
-		}
+// labelHost labels a host certificate of the ingress shim or the route integration with its
+// tenant. The ingress shim copies the labels of the ingress, but the route integration doesn't
+// copy the labels of the route.
+func (s *certificateSyncer) labelHost(ctx *synccontext.SyncContext, pCertificate *certmanagerv1.Certificate, vNamespace string) error {
+	labels := approverpolicy.AddLabels(maps.Clone(pCertificate.Labels), vNamespace)
+	if equality.Semantic.DeepEqual(labels, pCertificate.Labels) {
+		return nil
 	}
 
-	return types.NamespacedName{}
+	ctx.Log.Infof("label host certificate %s/%s with its vcluster and virtual namespace", pCertificate.Namespace, pCertificate.Name)
+	patch := client.MergeFrom(pCertificate.DeepCopy())
+	pCertificate.Labels = labels
+	return ctx.PhysicalClient.Patch(ctx, pCertificate, patch)
+}
+
+// SecretReference returns the host secret the certificate produces
+func SecretReference(ctx *synccontext.SyncContext, vCertificate *certmanagerv1.Certificate) owners.Reference {
+	name := vCertificate.Name
+	if vCertificate.Spec.SecretName != "" {
+		name = vCertificate.Spec.SecretName
+	}
+
+	return owners.Reference{
+		Host:   naming.HostName(ctx, naming.Secret, name, vCertificate.Namespace),
+		Target: types.NamespacedName{Namespace: vCertificate.Namespace, Name: name},
+	}
 }
 
 func (s *certificateSyncer) SyncToVirtual(ctx *synccontext.SyncContext, evt *synccontext.SyncToVirtualEvent[*certmanagerv1.Certificate]) (ctrl.Result, error) {
-	// was certificate created by ingress?
+	// was certificate created by ingress or route?
 	shouldSync, vName := s.shouldSyncBackwards(evt.Host, nil)
 	if shouldSync {
+		err := s.labelHost(ctx, evt.Host, vName.Namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		err = s.updateRouteSecrets(ctx, evt.Host)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
 		ctx.Log.Infof("create virtual certificate %s/%s, because physical is there and virtual is missing", vName.Namespace, vName.Name)
 		vCertificate, err := s.translateBackwards(ctx, evt.Host, vName)
 		if err != nil {
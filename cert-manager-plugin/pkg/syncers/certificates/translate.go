@@ -1,50 +1,74 @@
 package certificates
 
 import (
+	"fmt"
+
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/loft-sh/vcluster/pkg/mappings"
 	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/approverpolicy"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// ReasonIssuerNotFound is the reason of the events on backward synced certificates whose host
+// issuer has no virtual counterpart
+const ReasonIssuerNotFound = "IssuerNotFound"
+
 func (s *certificateSyncer) translate(ctx *synccontext.SyncContext, vObj client.Object) *certmanagerv1.Certificate {
 	pObj := translate.HostMetadata(vObj, s.VirtualToHost(ctx, types.NamespacedName{Name: vObj.GetName(), Namespace: vObj.GetNamespace()}, vObj)).(*certmanagerv1.Certificate)
-	vCertificate := vObj.(*certmanagerv1.Certificate)
-	rewriteSpec(ctx, &vCertificate.Spec, vCertificate.Namespace)
+	rewriteSpec(ctx, &pObj.Spec, vObj.GetNamespace())
+	pObj.Labels = approverpolicy.AddLabels(pObj.Labels, vObj.GetNamespace())
+	if pObj.Annotations == nil {
+		pObj.Annotations = map[string]string{}
+	}
+	pObj.Annotations[constants.SpecHashAnnotation] = SpecHash(&pObj.Spec)
 	return pObj
 }
 
 func (s *certificateSyncer) translateUpdate(ctx *synccontext.SyncContext, evt *synccontext.SyncEvent[*certmanagerv1.Certificate]) {
 	// sync metadata
 	evt.Host.Annotations = translate.HostAnnotations(evt.Virtual, evt.Host)
-	evt.Host.Labels = translate.HostLabels(evt.Virtual, evt.Host)
+	evt.Host.Labels = approverpolicy.AddLabels(translate.HostLabels(evt.Virtual, evt.Host), evt.Virtual.Namespace)
 
-	// sync virtual to host
-	evt.Host.Spec = evt.Virtual.Spec
+	// sync virtual to host unless the host spec drifted and is kept
+	pSpec := s.reconcileDrift(ctx, evt.Virtual, evt.Host, HostSpec(ctx, &evt.Virtual.Spec, evt.Virtual.GetNamespace()))
+	if pSpec == nil {
+		return
+	}
 
-	// update spec
-	rewriteSpec(ctx, &evt.Virtual.Spec, evt.Virtual.GetNamespace())
+	evt.Host.Spec = *pSpec
+	evt.Host.Annotations[constants.SpecHashAnnotation] = SpecHash(pSpec)
+	delete(evt.Host.Annotations, constants.DriftAlertedHashAnnotation)
+}
+
+// HostSpec returns the spec of the host certificate for the spec of a virtual certificate
+func HostSpec(ctx *synccontext.SyncContext, vSpec *certmanagerv1.CertificateSpec, namespace string) *certmanagerv1.CertificateSpec {
+	pSpec := vSpec.DeepCopy()
+	rewriteSpec(ctx, pSpec, namespace)
+	return pSpec
 }
 
 func rewriteSpec(ctx *synccontext.SyncContext, vObjSpec *certmanagerv1.CertificateSpec, namespace string) {
 	if vObjSpec.SecretName != "" {
-		vObjSpec.SecretName = translate.Default.HostName(ctx, vObjSpec.SecretName, namespace).Name
+		vObjSpec.SecretName = naming.HostName(ctx, naming.Secret, vObjSpec.SecretName, namespace).Name
 	}
+	// cluster issuers are shared with the host and keep their names
 	if vObjSpec.IssuerRef.Kind == "Issuer" {
-		vObjSpec.IssuerRef.Name = translate.Default.HostName(ctx, vObjSpec.IssuerRef.Name, namespace).Name
-	} else if vObjSpec.IssuerRef.Kind == "ClusterIssuer" {
-		// TODO: rewrite ClusterIssuers
+		vObjSpec.IssuerRef.Name = naming.HostName(ctx, naming.Issuer, vObjSpec.IssuerRef.Name, namespace).Name
 	}
 	if vObjSpec.Keystores != nil && vObjSpec.Keystores.JKS != nil {
-		vObjSpec.Keystores.JKS.PasswordSecretRef.Name = translate.Default.HostName(ctx, vObjSpec.Keystores.JKS.PasswordSecretRef.Name, namespace).Name
+		vObjSpec.Keystores.JKS.PasswordSecretRef.Name = naming.HostName(ctx, naming.Secret, vObjSpec.Keystores.JKS.PasswordSecretRef.Name, namespace).Name
 	}
 	if vObjSpec.Keystores != nil && vObjSpec.Keystores.PKCS12 != nil {
-		vObjSpec.Keystores.PKCS12.PasswordSecretRef.Name = translate.Default.HostName(ctx, vObjSpec.Keystores.PKCS12.PasswordSecretRef.Name, namespace).Name
+		vObjSpec.Keystores.PKCS12.PasswordSecretRef.Name = naming.HostName(ctx, naming.Secret, vObjSpec.Keystores.PKCS12.PasswordSecretRef.Name, namespace).Name
 	}
 }
 
@@ -64,7 +88,7 @@ func (s *certificateSyncer) translateBackwards(ctx *synccontext.SyncContext, pOb
 	vCertificate.Annotations[constants.BackwardSyncAnnotation] = "true"
 
 	// rewrite spec
-	vCertificateSpec, err := s.rewriteSpecBackwards(ctx, &pObj.Spec, name)
+	vCertificateSpec, err := s.rewriteSpecBackwards(ctx, pObj, name, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +118,7 @@ func (s *certificateSyncer) translateUpdateBackwards(ctx *synccontext.SyncContex
 	}
 
 	// update spec
-	vSpec, err := s.rewriteSpecBackwards(ctx, &pObj.Spec, types.NamespacedName{Namespace: vObj.Namespace, Name: vObj.Name})
+	vSpec, err := s.rewriteSpecBackwards(ctx, pObj, types.NamespacedName{Namespace: vObj.Namespace, Name: vObj.Name}, vObj)
 	if err != nil {
 		return nil, err
 	}
@@ -106,19 +130,58 @@ func (s *certificateSyncer) translateUpdateBackwards(ctx *synccontext.SyncContex
 	return updated, nil
 }
 
-func (s *certificateSyncer) rewriteSpecBackwards(ctx *synccontext.SyncContext, pObjSpec *certmanagerv1.CertificateSpec, vName types.NamespacedName) (*certmanagerv1.CertificateSpec, error) {
-	vObjSpec := pObjSpec.DeepCopy()
+// rewriteSpecBackwards translates the spec of a host certificate into the spec of the virtual
+// certificate vName. vObj is the existing virtual certificate or nil if it's created. If the host
+// issuer has no virtual counterpart in the namespace of the certificate, the issuer reference is
+// kept as it is and a warning is reported on the virtual certificate, as requeuing can't fix that.
+func (s *certificateSyncer) rewriteSpecBackwards(ctx *synccontext.SyncContext, pObj *certmanagerv1.Certificate, vName types.NamespacedName, vObj *certmanagerv1.Certificate) (*certmanagerv1.CertificateSpec, error) {
+	vObjSpec := pObj.Spec.DeepCopy()
 
-	// find issuer
+	// ingress certificates are named after their secret, route certificates and their secrets
+	// after the route
 	vObjSpec.SecretName = vName.Name
+	if pRoute, vRoute, ok := routeOf(s.owners, pObj); ok {
+		if name, ok := virtualRouteName(pRoute, vRoute.Name, pObj.Spec.SecretName); ok {
+			vObjSpec.SecretName = name
+		}
+	}
+
+	// find issuer, cluster issuers are shared with the host and keep their names
 	if vObjSpec.IssuerRef.Kind == "Issuer" {
-		vIssuerName := mappings.HostToVirtual(ctx, vName.Name, vName.Namespace, nil, certmanagerv1.SchemeGroupVersion.WithKind("Issuer"))
-		vObjSpec.IssuerRef.Name = vIssuerName.Name
+		vIssuerName, err := virtualIssuerName(ctx, types.NamespacedName{Namespace: pObj.Namespace, Name: pObj.Spec.IssuerRef.Name})
+		if err != nil {
+			return nil, err
+		}
+
+		if vIssuerName.Name != "" && vIssuerName.Namespace == vName.Namespace {
+			vObjSpec.IssuerRef.Name = vIssuerName.Name
+		} else {
+			ctx.Log.Infof("couldn't find virtual issuer of host issuer %s/%s in namespace %s, keep issuer reference", pObj.Namespace, pObj.Spec.IssuerRef.Name, vName.Namespace)
+			if vObj != nil {
+				s.EventRecorder().Eventf(vObj, corev1.EventTypeWarning, ReasonIssuerNotFound, "Couldn't find the virtual issuer of host issuer %s/%s in namespace %s", pObj.Namespace, pObj.Spec.IssuerRef.Name, vName.Namespace)
+				vObjSpec.IssuerRef = vObj.Spec.IssuerRef
+			}
+		}
 	}
 
 	return vObjSpec, nil
 }
 
+// virtualIssuerName maps the name of a host issuer back to the virtual issuer. The host issuer
+// is passed to the mapper, as the issuers the plugin creates carry their virtual name.
+func virtualIssuerName(ctx *synccontext.SyncContext, pName types.NamespacedName) (types.NamespacedName, error) {
+	var pIssuer client.Object
+	issuer := &certmanagerv1.Issuer{}
+	err := ctx.PhysicalClient.Get(ctx, pName, issuer)
+	if err == nil {
+		pIssuer = issuer
+	} else if !kerrors.IsNotFound(err) {
+		return types.NamespacedName{}, fmt.Errorf("get host issuer %s: %w", pName, err)
+	}
+
+	return mappings.HostToVirtual(ctx, pName.Name, pName.Namespace, pIssuer, certmanagerv1.SchemeGroupVersion.WithKind("Issuer")), nil
+}
+
 func newIfNil(updated *certmanagerv1.Certificate, pObj *certmanagerv1.Certificate) *certmanagerv1.Certificate {
 	if updated == nil {
 		return pObj.DeepCopy()
@@ -0,0 +1,272 @@
+package certificates
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/google/go-cmp/cmp"
+	"github.com/loft-sh/vcluster/pkg/mappings"
+	"github.com/loft-sh/vcluster/pkg/mappings/store"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/golden"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+const rewriteSpecFixtures = "testdata/rewritespec"
+
+// syncedBackwards checks if the certificate is one that is synced backwards. Only the
+// certificates ingress-shim creates for ingresses are, and those are named like their secret.
+func syncedBackwards(vCertificate *certmanagerv1.Certificate) bool {
+	return vCertificate.Name == vCertificate.Spec.SecretName
+}
+
+// translateFixture loads the virtual certificate testdata/rewritespec/<name>.virtual.yaml and
+// translates it to the host
+func translateFixture(t *testing.T, name string) (*certmanagerv1.Certificate, *certmanagerv1.Certificate) {
+	t.Helper()
+
+	vCertificate := &certmanagerv1.Certificate{}
+	golden.Load(t, filepath.Join(rewriteSpecFixtures, name+".virtual.yaml"), vCertificate)
+
+	pName := naming.HostName(nil, naming.Certificate, vCertificate.Name, vCertificate.Namespace)
+	pCertificate := &certmanagerv1.Certificate{
+		TypeMeta:   vCertificate.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: pName.Name, Namespace: pName.Namespace},
+		Spec:       *vCertificate.Spec.DeepCopy(),
+	}
+	rewriteSpec(nil, &pCertificate.Spec, vCertificate.Namespace)
+	return vCertificate, pCertificate
+}
+
+// newSyncContext returns a sync context that knows the issuer mapper and whose host client
+// holds the given objects
+func newSyncContext(t *testing.T, pObjs ...runtime.Object) *synccontext.SyncContext {
+	t.Helper()
+
+	vClient := testingutil.NewFakeClient(scheme.Scheme)
+	pClient := testingutil.NewFakeClient(scheme.Scheme, pObjs...)
+	registerCtx := fixtures.NewRegisterContext(vClient, pClient)
+
+	mappingsStore, err := store.NewStore(registerCtx, vClient, pClient, store.NewMemoryBackend())
+	if err != nil {
+		t.Fatalf("create mappings store: %v", err)
+	}
+	registerCtx.Mappings = mappings.NewMappingsRegistry(mappingsStore)
+	mapper, err := issuers.NewMapper(registerCtx)
+	if err != nil {
+		t.Fatalf("create issuer mapper: %v", err)
+	}
+	err = registerCtx.Mappings.AddMapper(mapper)
+	if err != nil {
+		t.Fatalf("add issuer mapper: %v", err)
+	}
+
+	return registerCtx.ToSyncContext("test")
+}
+
+// newHostIssuer returns the host issuer the plugin creates for the virtual issuer
+func newHostIssuer(vName, vNamespace string) *certmanagerv1.Issuer {
+	vIssuer := &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Name: vName, Namespace: vNamespace}}
+	return translate.HostMetadata(vIssuer, naming.HostName(nil, naming.Issuer, vName, vNamespace))
+}
+
+// translateFixtureBackwards translates the host certificate back into the virtual one. The
+// host issuer of the virtual issuer the certificate references exists.
+func translateFixtureBackwards(t *testing.T, vCertificate, pCertificate *certmanagerv1.Certificate) *certmanagerv1.Certificate {
+	t.Helper()
+
+	ctx := newSyncContext(t, newHostIssuer(vCertificate.Spec.IssuerRef.Name, vCertificate.Namespace))
+	vName := types.NamespacedName{Namespace: vCertificate.Namespace, Name: vCertificate.Name}
+	vSpec, err := (&certificateSyncer{}).rewriteSpecBackwards(ctx, pCertificate, vName, nil)
+	if err != nil {
+		t.Fatalf("rewrite spec backwards: %v", err)
+	}
+
+	return &certmanagerv1.Certificate{
+		TypeMeta:   pCertificate.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: vName.Name, Namespace: vName.Namespace},
+		Spec:       *vSpec,
+	}
+}
+
+// TestRewriteSpec translates the virtual certificates of testdata/rewritespec/<case>.virtual.yaml
+// and compares them with the host certificates of <case>.host.yaml. Certificates that are
+// synced backwards are translated back again and compared with <case>.backward.yaml.
+func TestRewriteSpec(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	for _, name := range golden.Cases(t, rewriteSpecFixtures, ".virtual.yaml") {
+		t.Run(name, func(t *testing.T) {
+			vCertificate, pCertificate := translateFixture(t, name)
+			golden.Assert(t, filepath.Join(rewriteSpecFixtures, name+".host.yaml"), pCertificate)
+
+			if syncedBackwards(vCertificate) {
+				golden.Assert(t, filepath.Join(rewriteSpecFixtures, name+".backward.yaml"), translateFixtureBackwards(t, vCertificate, pCertificate))
+			}
+		})
+	}
+}
+
+// TestRewriteSpecRoundTrip checks that translating a certificate that is synced backwards to
+// the host and back again results in the original spec
+func TestRewriteSpecRoundTrip(t *testing.T) {
+	for translatorName, translator := range translators {
+		t.Run(translatorName, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			for _, name := range golden.Cases(t, rewriteSpecFixtures, ".virtual.yaml") {
+				t.Run(name, func(t *testing.T) {
+					vCertificate, pCertificate := translateFixture(t, name)
+					if !syncedBackwards(vCertificate) {
+						t.Skip("certificate is not synced backwards")
+					}
+
+					roundTripped := translateFixtureBackwards(t, vCertificate, pCertificate)
+					if diff := cmp.Diff(vCertificate.Spec, roundTripped.Spec); diff != "" {
+						t.Errorf("round trip changed the spec (-original +round tripped):\n%s", diff)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRewriteSpecBackwardsIssuer(t *testing.T) {
+	// the certificate is named differently than its issuer, so a lookup by the certificate
+	// name can't succeed by accident
+	vName := types.NamespacedName{Namespace: "team-a", Name: "shop-tls"}
+	longName := "letsencrypt-production-issuer-with-a-name-that-exceeds-the-limit"
+
+	for translatorName, translator := range translators {
+		t.Run(translatorName, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			tests := []struct {
+				name      string
+				issuerRef cmmeta.ObjectReference
+				pObjs     []runtime.Object
+				expected  string
+				keep      bool
+			}{
+				{
+					name:      "issuer",
+					issuerRef: cmmeta.ObjectReference{Kind: "Issuer", Name: naming.HostName(nil, naming.Issuer, "letsencrypt", "team-a").Name},
+					pObjs:     []runtime.Object{newHostIssuer("letsencrypt", "team-a")},
+					expected:  "letsencrypt",
+				},
+				{
+					name:      "issuer with shortened host name",
+					issuerRef: cmmeta.ObjectReference{Kind: "Issuer", Name: naming.HostName(nil, naming.Issuer, longName, "team-a").Name},
+					pObjs:     []runtime.Object{newHostIssuer(longName, "team-a")},
+					expected:  longName,
+				},
+				{
+					name:      "issuer of another namespace",
+					issuerRef: cmmeta.ObjectReference{Kind: "Issuer", Name: naming.HostName(nil, naming.Issuer, "letsencrypt", "team-b").Name},
+					pObjs:     []runtime.Object{newHostIssuer("letsencrypt", "team-b")},
+					keep:      true,
+				},
+				{
+					name:      "missing issuer",
+					issuerRef: cmmeta.ObjectReference{Kind: "Issuer", Name: naming.HostName(nil, naming.Issuer, "letsencrypt", "team-a").Name},
+					keep:      true,
+				},
+				{
+					name:      "cluster issuer",
+					issuerRef: cmmeta.ObjectReference{Kind: "ClusterIssuer", Name: "letsencrypt"},
+					expected:  "letsencrypt",
+				},
+			}
+
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					pName := naming.HostName(nil, naming.Certificate, vName.Name, vName.Namespace)
+					pCertificate := &certmanagerv1.Certificate{
+						ObjectMeta: metav1.ObjectMeta{Name: pName.Name, Namespace: pName.Namespace},
+						Spec: certmanagerv1.CertificateSpec{
+							SecretName: naming.HostName(nil, naming.Secret, vName.Name, vName.Namespace).Name,
+							IssuerRef:  test.issuerRef,
+						},
+					}
+
+					// the virtual certificate still references the issuer it was created with
+					vCertificate := &certmanagerv1.Certificate{
+						ObjectMeta: metav1.ObjectMeta{Name: vName.Name, Namespace: vName.Namespace},
+						Spec:       certmanagerv1.CertificateSpec{IssuerRef: cmmeta.ObjectReference{Kind: "Issuer", Name: "previous"}},
+					}
+					recorder := record.NewFakeRecorder(10)
+					syncer := &certificateSyncer{GenericTranslator: &fakeTranslator{recorder: recorder}}
+					vSpec, err := syncer.rewriteSpecBackwards(newSyncContext(t, test.pObjs...), pCertificate, vName, vCertificate)
+					if err != nil {
+						t.Fatalf("rewrite spec backwards: %v", err)
+					}
+
+					expected := test.expected
+					if test.keep {
+						expected = "previous"
+					}
+					if vSpec.IssuerRef.Name != expected {
+						t.Errorf("expected issuer %s, got %s", expected, vSpec.IssuerRef.Name)
+					}
+					if vSpec.IssuerRef.Kind != test.issuerRef.Kind {
+						t.Errorf("expected issuer kind %s, got %s", test.issuerRef.Kind, vSpec.IssuerRef.Kind)
+					}
+					if !test.keep && len(recorder.Events) != 0 {
+						t.Errorf("expected no event, got %s", <-recorder.Events)
+					} else if test.keep && (len(recorder.Events) != 1 || !strings.Contains(<-recorder.Events, ReasonIssuerNotFound)) {
+						t.Errorf("expected one %s event", ReasonIssuerNotFound)
+					}
+
+					// certificates that are created keep the host issuer reference
+					vSpec, err = (&certificateSyncer{}).rewriteSpecBackwards(newSyncContext(t, test.pObjs...), pCertificate, vName, nil)
+					if err != nil {
+						t.Fatalf("rewrite spec backwards: %v", err)
+					}
+					if expected = test.expected; test.keep {
+						expected = test.issuerRef.Name
+					}
+					if vSpec.IssuerRef.Name != expected {
+						t.Errorf("expected issuer %s for a new certificate, got %s", expected, vSpec.IssuerRef.Name)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRewriteSpecBackwardsRoute(t *testing.T) {
+	for translatorName, translator := range translators {
+		t.Run(translatorName, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			registry := owners.NewRegistry()
+			registry.Update(routeIndex, newRoute("team-a", "web"))
+
+			// the secret of a route certificate is named after the route, not after the certificate
+			pRoute := translator.HostName(nil, "web", "team-a")
+			pCertificate := newRouteCertificate(pRoute, pRoute.Name+"-cert", pRoute.Name+"-tls")
+			pCertificate.Spec.IssuerRef = cmmeta.ObjectReference{Kind: "ClusterIssuer", Name: "letsencrypt"}
+
+			vSpec, err := (&certificateSyncer{owners: registry}).rewriteSpecBackwards(newSyncContext(t), pCertificate, nameByRoute(registry, pCertificate), nil)
+			if err != nil {
+				t.Fatalf("rewrite spec backwards: %v", err)
+			}
+			if vSpec.SecretName != "web-tls" {
+				t.Errorf("expected secret web-tls, got %s", vSpec.SecretName)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package csrs
+
+import (
+	"github.com/loft-sh/vcluster/pkg/mappings/generic"
+	"github.com/loft-sh/vcluster/pkg/patcher"
+	"github.com/loft-sh/vcluster/pkg/syncer"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/syncer/translator"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// New creates the syncer that forwards approved virtual CertificateSigningRequests for
+// cert-manager signers to the host, where cert-manager signs them
+func New(ctx *synccontext.RegisterContext, cfg config.CertificateSigningRequests) (syncertypes.Syncer, error) {
+	mapper, err := generic.NewMapper(ctx, &certificatesv1.CertificateSigningRequest{}, func(_ *synccontext.SyncContext, vName, _ string) types.NamespacedName {
+		// certificate signing requests are cluster scoped
+		return types.NamespacedName{Name: translate.Default.HostNameCluster(vName)}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &csrSyncer{
+		GenericTranslator: translator.NewGenericTranslator(ctx, "certificatesigningrequest", &certificatesv1.CertificateSigningRequest{}, mapper),
+
+		clusterIssuers: cfg.ClusterIssuers,
+		approve:        cfg.Approve,
+	}, nil
+}
+
+type csrSyncer struct {
+	syncertypes.GenericTranslator
+
+	// clusterIssuers are the ClusterIssuers requests may be forwarded for
+	clusterIssuers []string
+
+	// approve approves the host requests, otherwise a host approver has to
+	approve bool
+}
+
+var _ syncertypes.Syncer = &csrSyncer{}
+
+func (s *csrSyncer) Syncer() syncertypes.Sync[client.Object] {
+	return syncer.ToGenericSyncer[*certificatesv1.CertificateSigningRequest](s)
+}
+
+func (s *csrSyncer) SyncToHost(ctx *synccontext.SyncContext, evt *synccontext.SyncToHostEvent[*certificatesv1.CertificateSigningRequest]) (ctrl.Result, error) {
+	// only approved requests for cert-manager signers that weren't signed yet are forwarded
+	if !forwarded(evt.Virtual) || len(evt.Virtual.Status.Certificate) > 0 {
+		return ctrl.Result{}, nil
+	}
+
+	pCSR, err := s.translate(ctx, evt.Virtual)
+	if err != nil {
+		ctx.Log.Infof("don't forward certificate signing request %s: %v", evt.Virtual.Name, err)
+		s.EventRecorder().Eventf(evt.Virtual, "Warning", "SyncError", "Can't forward certificate signing request: %v", err)
+		return ctrl.Result{}, nil
+	}
+
+	return patcher.CreateHostObject(ctx, evt.Virtual, pCSR, s.EventRecorder(), false)
+}
+
+func (s *csrSyncer) Sync(ctx *synccontext.SyncContext, evt *synccontext.SyncEvent[*certificatesv1.CertificateSigningRequest]) (ctrl.Result, error) {
+	// copy the issued certificate and failures back
+	updated := s.translateStatus(evt.Host, evt.Virtual)
+	if updated != nil {
+		ctx.Log.Infof("update virtual certificate signing request %s, because status is out of sync", evt.Virtual.Name)
+		return ctrl.Result{}, ctx.VirtualClient.Status().Update(ctx.Context, updated)
+	}
+
+	// cert-manager only signs approved requests, so the approval in the vcluster is forwarded if
+	// the plugin may approve requests on the host
+	if s.approve && approved(evt.Virtual) && !approved(evt.Host) && !denied(evt.Host) {
+		pCSR := evt.Host.DeepCopy()
+		pCSR.Status.Conditions = append(pCSR.Status.Conditions, approvedCondition(evt.Virtual))
+		ctx.Log.Infof("approve host certificate signing request %s, because virtual certificate signing request %s is approved", pCSR.Name, evt.Virtual.Name)
+		return ctrl.Result{}, ctx.PhysicalClient.SubResource("approval").Update(ctx.Context, pCSR)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (s *csrSyncer) SyncToVirtual(ctx *synccontext.SyncContext, evt *synccontext.SyncToVirtualEvent[*certificatesv1.CertificateSigningRequest]) (ctrl.Result, error) {
+	return patcher.DeleteHostObject(ctx, evt.Host, evt.VirtualOld, "virtual object was deleted")
+}
@@ -0,0 +1,119 @@
+package csrs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// IssuerSignerPrefix and ClusterIssuerSignerPrefix are the prefixes of the signer names
+	// cert-manager signs requests for, followed by <namespace>.<name> of an Issuer or the name of
+	// a ClusterIssuer
+	IssuerSignerPrefix        = "issuers.cert-manager.io/"
+	ClusterIssuerSignerPrefix = "clusterissuers.cert-manager.io/"
+
+	// ReasonVClusterApproved is the reason of the approval of forwarded host requests
+	ReasonVClusterApproved = "VClusterApproved"
+)
+
+func (s *csrSyncer) translate(ctx *synccontext.SyncContext, vCSR *certificatesv1.CertificateSigningRequest) (*certificatesv1.CertificateSigningRequest, error) {
+	signerName, err := HostSignerName(ctx, vCSR.Spec.SignerName)
+	if err != nil {
+		return nil, err
+	} else if clusterIssuer, ok := strings.CutPrefix(signerName, ClusterIssuerSignerPrefix); ok && !slices.Contains(s.clusterIssuers, clusterIssuer) {
+		return nil, fmt.Errorf("cluster issuer %s isn't allowed, see certificateSigningRequests.clusterIssuers", clusterIssuer)
+	}
+
+	pCSR := translate.HostMetadata(vCSR, s.VirtualToHost(ctx, types.NamespacedName{Name: vCSR.Name}, vCSR))
+	pCSR.Spec.SignerName = signerName
+
+	// the requesting user is set by the host API server
+	pCSR.Spec.Username = ""
+	pCSR.Spec.UID = ""
+	pCSR.Spec.Groups = nil
+	pCSR.Spec.Extra = nil
+	pCSR.Status = certificatesv1.CertificateSigningRequestStatus{}
+	return pCSR, nil
+}
+
+// HostSignerName translates the signer name of a virtual Issuer to the signer name of its host
+// Issuer. The signer names of ClusterIssuers are kept, as ClusterIssuers aren't synced.
+func HostSignerName(ctx *synccontext.SyncContext, signerName string) (string, error) {
+	if strings.HasPrefix(signerName, ClusterIssuerSignerPrefix) {
+		return signerName, nil
+	}
+
+	// namespaces can't contain dots, so the name starts after the first one
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(signerName, IssuerSignerPrefix), ".")
+	if !strings.HasPrefix(signerName, IssuerSignerPrefix) || !ok || namespace == "" || name == "" {
+		return "", fmt.Errorf("signer name %s isn't of the form %s<namespace>.<name>", signerName, IssuerSignerPrefix)
+	}
+
+	pName := naming.HostName(ctx, naming.Issuer, name, namespace)
+	return IssuerSignerPrefix + pName.Namespace + "." + pName.Name, nil
+}
+
+// translateStatus returns the virtual request with the certificate and the failure of the host
+// request, or nil if it's up to date
+func (s *csrSyncer) translateStatus(pCSR, vCSR *certificatesv1.CertificateSigningRequest) *certificatesv1.CertificateSigningRequest {
+	updated := vCSR.DeepCopy()
+	changed := false
+	if len(pCSR.Status.Certificate) > 0 && string(pCSR.Status.Certificate) != string(vCSR.Status.Certificate) {
+		updated.Status.Certificate = pCSR.Status.Certificate
+		changed = true
+	}
+	if failed := condition(pCSR, certificatesv1.CertificateFailed); failed != nil && condition(vCSR, certificatesv1.CertificateFailed) == nil {
+		updated.Status.Conditions = append(updated.Status.Conditions, *failed)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return updated
+}
+
+// forwarded checks if the request is for a cert-manager signer and was approved
+func forwarded(csr *certificatesv1.CertificateSigningRequest) bool {
+	signer := strings.HasPrefix(csr.Spec.SignerName, IssuerSignerPrefix) || strings.HasPrefix(csr.Spec.SignerName, ClusterIssuerSignerPrefix)
+	return signer && approved(csr) && !denied(csr) && condition(csr, certificatesv1.CertificateFailed) == nil
+}
+
+func approved(csr *certificatesv1.CertificateSigningRequest) bool {
+	return condition(csr, certificatesv1.CertificateApproved) != nil
+}
+
+func denied(csr *certificatesv1.CertificateSigningRequest) bool {
+	return condition(csr, certificatesv1.CertificateDenied) != nil
+}
+
+// condition returns the true condition of the type
+func condition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) *certificatesv1.CertificateSigningRequestCondition {
+	for i := range csr.Status.Conditions {
+		if csr.Status.Conditions[i].Type == conditionType && csr.Status.Conditions[i].Status == corev1.ConditionTrue {
+			return &csr.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func approvedCondition(vCSR *certificatesv1.CertificateSigningRequest) certificatesv1.CertificateSigningRequestCondition {
+	return certificatesv1.CertificateSigningRequestCondition{
+		Type:               certificatesv1.CertificateApproved,
+		Status:             corev1.ConditionTrue,
+		Reason:             ReasonVClusterApproved,
+		Message:            fmt.Sprintf("Certificate signing request %s was approved in the vcluster", vCSR.Name),
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	}
+}
@@ -0,0 +1,158 @@
+package csrs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/syncer/translator"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestHostSignerName(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	pIssuer := naming.HostName(nil, naming.Issuer, "vault", "shop")
+	tests := []struct {
+		signerName  string
+		expected    string
+		expectError bool
+	}{
+		{signerName: "issuers.cert-manager.io/shop.vault", expected: "issuers.cert-manager.io/" + pIssuer.Namespace + "." + pIssuer.Name},
+		{signerName: "clusterissuers.cert-manager.io/letsencrypt", expected: "clusterissuers.cert-manager.io/letsencrypt"},
+		{signerName: "issuers.cert-manager.io/vault", expectError: true},
+		{signerName: "kubernetes.io/kube-apiserver-client", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.signerName, func(t *testing.T) {
+			signerName, err := HostSignerName(nil, test.signerName)
+			if test.expectError != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", test.expectError, err)
+			}
+			if signerName != test.expected {
+				t.Errorf("expected signer name %s, got %s", test.expected, signerName)
+			}
+		})
+	}
+}
+
+func newCSR(signerName string, conditions ...certificatesv1.RequestConditionType) *certificatesv1.CertificateSigningRequest {
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec:       certificatesv1.CertificateSigningRequestSpec{SignerName: signerName, Request: []byte("request")},
+	}
+	for _, conditionType := range conditions {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{Type: conditionType, Status: corev1.ConditionTrue})
+	}
+	return csr
+}
+
+func TestForwarded(t *testing.T) {
+	tests := []struct {
+		name     string
+		csr      *certificatesv1.CertificateSigningRequest
+		expected bool
+	}{
+		{name: "approved issuer request", csr: newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateApproved), expected: true},
+		{name: "approved cluster issuer request", csr: newCSR("clusterissuers.cert-manager.io/letsencrypt", certificatesv1.CertificateApproved), expected: true},
+		{name: "pending request", csr: newCSR("issuers.cert-manager.io/shop.vault")},
+		{name: "denied request", csr: newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateDenied)},
+		{name: "failed request", csr: newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateApproved, certificatesv1.CertificateFailed)},
+		{name: "other signer", csr: newCSR("kubernetes.io/kube-apiserver-client", certificatesv1.CertificateApproved)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := forwarded(test.csr); actual != test.expected {
+				t.Errorf("expected forwarded %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTranslateStatus(t *testing.T) {
+	syncer := &csrSyncer{}
+	vCSR := newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateApproved)
+	pCSR := newCSR("issuers.cert-manager.io/vault-x-shop-x-vcluster", certificatesv1.CertificateApproved)
+
+	if updated := syncer.translateStatus(pCSR, vCSR); updated != nil {
+		t.Errorf("expected no update while the host request isn't signed, got %v", updated.Status)
+	}
+
+	pCSR.Status.Certificate = []byte("certificate")
+	updated := syncer.translateStatus(pCSR, vCSR)
+	if updated == nil || string(updated.Status.Certificate) != "certificate" {
+		t.Fatalf("expected issued certificate to be copied, got %v", updated)
+	}
+	if len(vCSR.Status.Certificate) != 0 {
+		t.Errorf("virtual request must not be changed")
+	}
+	if syncer.translateStatus(pCSR, updated) != nil {
+		t.Errorf("expected no update once the certificate was copied")
+	}
+
+	pCSR.Status.Conditions = append(pCSR.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{Type: certificatesv1.CertificateFailed, Status: corev1.ConditionTrue, Message: "issuer not ready"})
+	updated = syncer.translateStatus(pCSR, updated)
+	if updated == nil || condition(updated, certificatesv1.CertificateFailed) == nil {
+		t.Errorf("expected failure to be copied, got %v", updated)
+	}
+}
+
+func TestTranslateClusterIssuers(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+	syncer := &csrSyncer{GenericTranslator: translator.NewGenericTranslator(fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme), testingutil.NewFakeClient(scheme.Scheme)), "certificatesigningrequest", &certificatesv1.CertificateSigningRequest{}, testingutil.NewFakeMapper(certificatesv1.SchemeGroupVersion.WithKind("CertificateSigningRequest"))), clusterIssuers: []string{"letsencrypt"}}
+	ctx := fixtures.NewSyncContext(nil, nil)
+
+	pCSR, err := syncer.translate(ctx, newCSR("clusterissuers.cert-manager.io/letsencrypt", certificatesv1.CertificateApproved))
+	if err != nil || pCSR.Spec.SignerName != "clusterissuers.cert-manager.io/letsencrypt" {
+		t.Errorf("expected the allowed cluster issuer to be kept, got %v (%v)", pCSR, err)
+	}
+
+	_, err = syncer.translate(ctx, newCSR("clusterissuers.cert-manager.io/internal-ca", certificatesv1.CertificateApproved))
+	if err == nil || !strings.Contains(err.Error(), "cluster issuer internal-ca isn't allowed") {
+		t.Errorf("expected other cluster issuers to be refused, got %v", err)
+	}
+
+	_, err = syncer.translate(ctx, newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateApproved))
+	if err != nil {
+		t.Errorf("expected issuers of the virtual cluster to be allowed, got %v", err)
+	}
+}
+
+func TestSyncApproval(t *testing.T) {
+	for _, approve := range []bool{false, true} {
+		t.Run(fmt.Sprintf("approve %v", approve), func(t *testing.T) {
+			vCSR := newCSR("issuers.cert-manager.io/shop.vault", certificatesv1.CertificateApproved)
+			pCSR := newCSR("issuers.cert-manager.io/vault-x-shop-x-vcluster")
+			pCSR.Name = "web-x-vcluster"
+			ctx := fixtures.NewSyncContext([]runtime.Object{vCSR}, []runtime.Object{pCSR})
+			syncer := &csrSyncer{approve: approve}
+
+			_, err := syncer.Sync(ctx, synccontext.NewSyncEvent(pCSR, vCSR))
+			if err != nil {
+				t.Fatalf("sync: %v", err)
+			}
+
+			updated := &certificatesv1.CertificateSigningRequest{}
+			err = ctx.PhysicalClient.Get(ctx, client.ObjectKeyFromObject(pCSR), updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if approvedCondition := condition(updated, certificatesv1.CertificateApproved); approve != (approvedCondition != nil) {
+				t.Errorf("expected the host request to be approved: %v, got %v", approve, updated.Status.Conditions)
+			} else if approve && approvedCondition.Reason != ReasonVClusterApproved {
+				t.Errorf("unexpected approval %v", approvedCondition)
+			}
+		})
+	}
+}
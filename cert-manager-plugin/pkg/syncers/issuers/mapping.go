@@ -0,0 +1,15 @@
+package issuers
+
+import (
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/mappings/generic"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+)
+
+// NewMapper creates the mapper that translates issuer names between the virtual and the host
+// cluster. The issuer syncer registers it with the mappings registry, so that host issuer
+// names referenced by other objects can be mapped back.
+func NewMapper(ctx *synccontext.RegisterContext) (synccontext.Mapper, error) {
+	return generic.NewMapperWithObject(ctx, &certmanagerv1.Issuer{}, naming.PhysicalNameFunc(naming.Issuer))
+}
@@ -2,34 +2,45 @@ package issuers
 
 import (
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
-	"github.com/loft-sh/vcluster/pkg/mappings/generic"
 	"github.com/loft-sh/vcluster/pkg/patcher"
 	"github.com/loft-sh/vcluster/pkg/syncer"
 	context "github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	"github.com/loft-sh/vcluster/pkg/syncer/translator"
 	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
 	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func New(ctx *context.RegisterContext) (syncertypes.Syncer, error) {
+func New(ctx *context.RegisterContext, resolver *conflicts.Resolver) (syncertypes.Syncer, error) {
 	_, _, err := translate.EnsureCRDFromPhysicalCluster(ctx.Context, ctx.PhysicalManager.GetConfig(), ctx.VirtualManager.GetConfig(), certmanagerv1.SchemeGroupVersion.WithKind("Issuer"))
 	if err != nil {
 		return nil, err
 	}
-	mapper, err := generic.NewMapper(ctx, &certmanagerv1.Issuer{}, translate.Default.HostName)
+	mapper, err := NewMapper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.Mappings.AddMapper(mapper)
 	if err != nil {
 		return nil, err
 	}
 	return &issuerSyncer{
 		GenericTranslator: translator.NewGenericTranslator(ctx, "issuer", &certmanagerv1.Issuer{}, mapper),
+
+		conflicts: resolver,
 	}, nil
 }
 
 type issuerSyncer struct {
 	syncertypes.GenericTranslator
+
+	conflicts *conflicts.Resolver
 }
 
 var _ syncertypes.Syncer = &issuerSyncer{}
@@ -39,7 +50,12 @@ func (s *issuerSyncer) Syncer() syncertypes.Sync[client.Object] {
 }
 
 func (s *issuerSyncer) SyncToHost(ctx *context.SyncContext, evt *context.SyncToHostEvent[*certmanagerv1.Issuer]) (ctrl.Result, error) {
-	return patcher.CreateHostObject(ctx, evt.Virtual, s.translate(evt.Virtual), s.EventRecorder(), false)
+	// don't create the issuer if another owner claims its account secret
+	if !s.allowed(ctx, evt.Virtual) {
+		return ctrl.Result{}, nil
+	}
+
+	return patcher.CreateHostObject(ctx, evt.Virtual, s.translate(ctx, evt.Virtual), s.EventRecorder(), false)
 }
 
 func (s *issuerSyncer) Sync(ctx *context.SyncContext, event *context.SyncEvent[*certmanagerv1.Issuer]) (ctrl.Result, error) {
@@ -59,7 +75,12 @@ func (s *issuerSyncer) Sync(ctx *context.SyncContext, event *context.SyncEvent[*
 		return ctrl.Result{}, nil
 	}
 
-	s.translateUpdate(pIssuer, vIssuer)
+	// don't update the issuer if another owner claims its account secret
+	if !s.allowed(ctx, vIssuer) {
+		return ctrl.Result{}, nil
+	}
+
+	s.translateUpdate(ctx, pIssuer, vIssuer)
 
 	return ctrl.Result{}, nil
 }
@@ -68,3 +89,32 @@ func (s *issuerSyncer) SyncToVirtual(ctx *context.SyncContext, event *context.Sy
 	// TODO: Do we need to ensure that there are no references to the issuer?
 	return patcher.DeleteHostObject(ctx, event.Host, event.VirtualOld, "virtual object was deleted")
 }
+
+// allowed checks if the issuer may write its ACME account secret. Issuers without an ACME
+// account secret are always allowed.
+func (s *issuerSyncer) allowed(ctx *context.SyncContext, vIssuer *certmanagerv1.Issuer) bool {
+	reference, ok := AccountSecretReference(ctx, vIssuer)
+	if !ok {
+		return true
+	}
+
+	return s.conflicts.Allowed(owners.KindIssuer, vIssuer, owners.KindSecret, reference)
+}
+
+// AccountSecretReference returns the host secret cert-manager stores the ACME account key of the
+// issuer in, or false if the issuer isn't an ACME issuer
+func AccountSecretReference(ctx *context.SyncContext, vIssuer *certmanagerv1.Issuer) (owners.Reference, bool) {
+	if vIssuer.Spec.ACME == nil {
+		return owners.Reference{}, false
+	}
+
+	name := vIssuer.Name
+	if vIssuer.Spec.ACME.PrivateKey.Name != "" {
+		name = vIssuer.Spec.ACME.PrivateKey.Name
+	}
+
+	return owners.Reference{
+		Host:   naming.HostName(ctx, naming.Secret, name, vIssuer.Namespace),
+		Target: types.NamespacedName{Namespace: vIssuer.Namespace, Name: name},
+	}, true
+}
@@ -1,105 +1,133 @@
 package issuers
 
 import (
+	"slices"
+
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (s *issuerSyncer) translate(vObj client.Object) *certmanagerv1.Issuer {
+func (s *issuerSyncer) translate(ctx *synccontext.SyncContext, vObj client.Object) *certmanagerv1.Issuer {
 	vIssuer := vObj.(*certmanagerv1.Issuer)
-	pObj := translate.HostMetadata(vIssuer, types.NamespacedName{Name: vObj.GetName(), Namespace: vObj.GetNamespace()})
-	pObj.Spec = *rewriteSpec(&vIssuer.Spec, vIssuer.Namespace)
+	pObj := translate.HostMetadata(vIssuer, s.VirtualToHost(ctx, types.NamespacedName{Name: vObj.GetName(), Namespace: vObj.GetNamespace()}, vObj))
+	pObj.Spec = *rewriteSpec(ctx, &vIssuer.Spec, vIssuer.Namespace)
 	return pObj
 }
 
-func (s *issuerSyncer) translateUpdate(pObj, vObj *certmanagerv1.Issuer) {
+func (s *issuerSyncer) translateUpdate(ctx *synccontext.SyncContext, pObj, vObj *certmanagerv1.Issuer) {
 	// check annotations & labels
 	pObj.Labels = translate.HostLabels(vObj, pObj)
 	pObj.Annotations = translate.HostAnnotations(vObj, pObj)
 
 	// update secret name if necessary
-	pObj.Spec = *rewriteSpec(&vObj.Spec, vObj.GetNamespace()).DeepCopy()
+	pObj.Spec = *rewriteSpec(ctx, &vObj.Spec, vObj.GetNamespace()).DeepCopy()
+}
+
+// HostSpec returns the spec of the host issuer for the spec of a virtual issuer
+func HostSpec(ctx *synccontext.SyncContext, vSpec *certmanagerv1.IssuerSpec, namespace string) *certmanagerv1.IssuerSpec {
+	return rewriteSpec(ctx, vSpec, namespace)
 }
 
-func rewriteSpec(vObjSpec *certmanagerv1.IssuerSpec, namespace string) *certmanagerv1.IssuerSpec {
+func rewriteSpec(ctx *synccontext.SyncContext, vObjSpec *certmanagerv1.IssuerSpec, namespace string) *certmanagerv1.IssuerSpec {
 	// translate secret names
+	return renameSecrets(vObjSpec, func(name string) string {
+		return naming.HostName(ctx, naming.Secret, name, namespace).Name
+	})
+}
+
+// SecretNames returns the names of all secrets the issuer spec references
+func SecretNames(spec *certmanagerv1.IssuerSpec) []string {
+	names := []string{}
+	renameSecrets(spec, func(name string) string {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		return name
+	})
+	return names
+}
+
+// renameSecrets returns a copy of the spec with all referenced secret names passed through rename
+func renameSecrets(vObjSpec *certmanagerv1.IssuerSpec, rename func(name string) string) *certmanagerv1.IssuerSpec {
 	vObjSpec = vObjSpec.DeepCopy()
 	if vObjSpec.ACME != nil {
-		vObjSpec.ACME.PrivateKey.Name = translate.Default.HostName(nil, vObjSpec.ACME.PrivateKey.Name, namespace).Name
+		vObjSpec.ACME.PrivateKey.Name = rename(vObjSpec.ACME.PrivateKey.Name)
 		if vObjSpec.ACME.ExternalAccountBinding != nil {
-			vObjSpec.ACME.ExternalAccountBinding.Key.Name = translate.Default.HostName(nil, vObjSpec.ACME.ExternalAccountBinding.Key.Name, namespace).Name
+			vObjSpec.ACME.ExternalAccountBinding.Key.Name = rename(vObjSpec.ACME.ExternalAccountBinding.Key.Name)
 		}
 		for i := range vObjSpec.ACME.Solvers {
 			if vObjSpec.ACME.Solvers[i].DNS01 != nil {
 				if vObjSpec.ACME.Solvers[i].DNS01.Akamai != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientToken.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientToken.Name, namespace).Name
-					vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientSecret.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientSecret.Name, namespace).Name
-					vObjSpec.ACME.Solvers[i].DNS01.Akamai.AccessToken.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Akamai.AccessToken.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientToken.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientToken.Name)
+					vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientSecret.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Akamai.ClientSecret.Name)
+					vObjSpec.ACME.Solvers[i].DNS01.Akamai.AccessToken.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Akamai.AccessToken.Name)
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.Cloudflare != nil {
 					if vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIKey != nil {
-						vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIKey.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIKey.Name, namespace).Name
+						vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIKey.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIKey.Name)
 					}
 					if vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIToken != nil {
-						vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIToken.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIToken.Name, namespace).Name
+						vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIToken.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Cloudflare.APIToken.Name)
 					}
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.DigitalOcean != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.DigitalOcean.Token.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.DigitalOcean.Token.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.DigitalOcean.Token.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.DigitalOcean.Token.Name)
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.Route53 != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKey.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKey.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKey.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKey.Name)
 					if vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKeyID != nil {
-						vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKeyID.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKeyID.Name, namespace).Name
+						vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKeyID.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.Route53.SecretAccessKeyID.Name)
 					}
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.AzureDNS != nil && vObjSpec.ACME.Solvers[i].DNS01.AzureDNS.ClientSecret != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.AzureDNS.ClientSecret.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.AzureDNS.ClientSecret.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.AzureDNS.ClientSecret.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.AzureDNS.ClientSecret.Name)
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.AcmeDNS != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.AcmeDNS.AccountSecret.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.AcmeDNS.AccountSecret.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.AcmeDNS.AccountSecret.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.AcmeDNS.AccountSecret.Name)
 				}
 				if vObjSpec.ACME.Solvers[i].DNS01.RFC2136 != nil {
-					vObjSpec.ACME.Solvers[i].DNS01.RFC2136.TSIGSecret.Name = translate.Default.HostName(nil, vObjSpec.ACME.Solvers[i].DNS01.RFC2136.TSIGSecret.Name, namespace).Name
+					vObjSpec.ACME.Solvers[i].DNS01.RFC2136.TSIGSecret.Name = rename(vObjSpec.ACME.Solvers[i].DNS01.RFC2136.TSIGSecret.Name)
 				}
 			}
 		}
 	}
 	if vObjSpec.CA != nil {
-		vObjSpec.CA.SecretName = translate.Default.HostName(nil, vObjSpec.CA.SecretName, namespace).Name
+		vObjSpec.CA.SecretName = rename(vObjSpec.CA.SecretName)
 	}
 	if vObjSpec.Vault != nil {
 		if vObjSpec.Vault.Auth.TokenSecretRef != nil {
-			vObjSpec.Vault.Auth.TokenSecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.Auth.TokenSecretRef.Name, namespace).Name
+			vObjSpec.Vault.Auth.TokenSecretRef.Name = rename(vObjSpec.Vault.Auth.TokenSecretRef.Name)
 		}
 		if vObjSpec.Vault.CABundleSecretRef != nil {
-			vObjSpec.Vault.CABundleSecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.CABundleSecretRef.Name, namespace).Name
+			vObjSpec.Vault.CABundleSecretRef.Name = rename(vObjSpec.Vault.CABundleSecretRef.Name)
 		}
 		if vObjSpec.Vault.ClientCertSecretRef != nil {
-			vObjSpec.Vault.ClientCertSecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.ClientCertSecretRef.Name, namespace).Name
+			vObjSpec.Vault.ClientCertSecretRef.Name = rename(vObjSpec.Vault.ClientCertSecretRef.Name)
 		}
 		if vObjSpec.Vault.ClientKeySecretRef != nil {
-			vObjSpec.Vault.ClientKeySecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.ClientKeySecretRef.Name, namespace).Name
+			vObjSpec.Vault.ClientKeySecretRef.Name = rename(vObjSpec.Vault.ClientKeySecretRef.Name)
 		}
 		if vObjSpec.Vault.Auth.AppRole != nil {
-			vObjSpec.Vault.Auth.AppRole.SecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.Auth.AppRole.SecretRef.Name, namespace).Name
+			vObjSpec.Vault.Auth.AppRole.SecretRef.Name = rename(vObjSpec.Vault.Auth.AppRole.SecretRef.Name)
 		}
 		if vObjSpec.Vault.Auth.Kubernetes != nil {
-			vObjSpec.Vault.Auth.Kubernetes.SecretRef.Name = translate.Default.HostName(nil, vObjSpec.Vault.Auth.Kubernetes.SecretRef.Name, namespace).Name
+			vObjSpec.Vault.Auth.Kubernetes.SecretRef.Name = rename(vObjSpec.Vault.Auth.Kubernetes.SecretRef.Name)
 		}
 
 	}
 	if vObjSpec.Venafi != nil {
 		if vObjSpec.Venafi.TPP != nil {
-			vObjSpec.Venafi.TPP.CredentialsRef.Name = translate.Default.HostName(nil, vObjSpec.Venafi.TPP.CredentialsRef.Name, namespace).Name
+			vObjSpec.Venafi.TPP.CredentialsRef.Name = rename(vObjSpec.Venafi.TPP.CredentialsRef.Name)
 			if vObjSpec.Venafi.TPP.CABundleSecretRef != nil {
-				vObjSpec.Venafi.TPP.CABundleSecretRef.Name = translate.Default.HostName(nil, vObjSpec.Venafi.TPP.CABundleSecretRef.Name, namespace).Name
+				vObjSpec.Venafi.TPP.CABundleSecretRef.Name = rename(vObjSpec.Venafi.TPP.CABundleSecretRef.Name)
 			}
 		}
 		if vObjSpec.Venafi.Cloud != nil {
-			vObjSpec.Venafi.Cloud.APITokenSecretRef.Name = translate.Default.HostName(nil, vObjSpec.Venafi.Cloud.APITokenSecretRef.Name, namespace).Name
+			vObjSpec.Venafi.Cloud.APITokenSecretRef.Name = rename(vObjSpec.Venafi.Cloud.APITokenSecretRef.Name)
 		}
 	}
 	return vObjSpec
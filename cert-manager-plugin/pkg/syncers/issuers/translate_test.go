@@ -0,0 +1,43 @@
+package issuers
+
+import (
+	"path/filepath"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/google/go-cmp/cmp"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/golden"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const rewriteSpecFixtures = "testdata/rewritespec"
+
+// TestRewriteSpec translates the virtual issuers of testdata/rewritespec/<case>.virtual.yaml
+// and compares them with the host issuers of <case>.host.yaml. Issuers are never synced
+// backwards, so there is no backward translation to check.
+func TestRewriteSpec(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	for _, name := range golden.Cases(t, rewriteSpecFixtures, ".virtual.yaml") {
+		t.Run(name, func(t *testing.T) {
+			vIssuer := &certmanagerv1.Issuer{}
+			golden.Load(t, filepath.Join(rewriteSpecFixtures, name+".virtual.yaml"), vIssuer)
+			original := vIssuer.DeepCopy()
+
+			pName := naming.HostName(nil, naming.Issuer, vIssuer.Name, vIssuer.Namespace)
+			pIssuer := &certmanagerv1.Issuer{
+				TypeMeta:   vIssuer.TypeMeta,
+				ObjectMeta: metav1.ObjectMeta{Name: pName.Name, Namespace: pName.Namespace},
+				Spec:       *rewriteSpec(nil, &vIssuer.Spec, vIssuer.Namespace),
+			}
+			golden.Assert(t, filepath.Join(rewriteSpecFixtures, name+".host.yaml"), pIssuer)
+
+			// the virtual spec must not be modified
+			if diff := cmp.Diff(original.Spec, vIssuer.Spec); diff != "" {
+				t.Errorf("rewriteSpec modified the virtual spec:\n%s", diff)
+			}
+		})
+	}
+}
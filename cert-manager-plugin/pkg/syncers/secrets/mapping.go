@@ -8,9 +8,10 @@ import (
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	context "github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
-	"github.com/loft-sh/vcluster/pkg/util/clienthelper"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -22,10 +23,30 @@ import (
 )
 
 var (
+	// IndexByCertificateSecret indexes certificates by the virtual names of the secrets they reference
 	IndexByCertificateSecret = "indexbycertificatesecret"
-	IndexByIssuerSecret      = "indexbyissuersecret"
+	// IndexByIssuerSecret indexes issuers by the virtual names of the secrets they reference
+	IndexByIssuerSecret = "indexbyissuersecret"
 )
 
+// certificateIndex maps the host secrets cert-manager creates for certificates to the virtual certificates
+var certificateIndex = owners.Index{
+	OwnerKind: owners.KindCertificate,
+	HostKind:  owners.KindSecret,
+	References: func(obj client.Object) []owners.Reference {
+		return secretReferencesFromCertificate(obj.(*certmanagerv1.Certificate))
+	},
+}
+
+// issuerIndex maps the host secrets cert-manager creates for issuers to the virtual issuers
+var issuerIndex = owners.Index{
+	OwnerKind: owners.KindIssuer,
+	HostKind:  owners.KindSecret,
+	References: func(obj client.Object) []owners.Reference {
+		return secretReferencesFromIssuer(obj.(*certmanagerv1.Issuer))
+	},
+}
+
 var _ syncertypes.IndicesRegisterer = &secretSyncer{}
 
 func (s *secretSyncer) RegisterIndices(ctx *context.RegisterContext) error {
@@ -35,9 +56,17 @@ func (s *secretSyncer) RegisterIndices(ctx *context.RegisterContext) error {
 	if err != nil {
 		return err
 	}
-	return ctx.VirtualManager.GetFieldIndexer().IndexField(ctx.Context, &certmanagerv1.Issuer{}, IndexByIssuerSecret, func(rawObj client.Object) []string {
+	err = ctx.VirtualManager.GetFieldIndexer().IndexField(ctx.Context, &certmanagerv1.Issuer{}, IndexByIssuerSecret, func(rawObj client.Object) []string {
 		return secretNamesFromIssuer(rawObj.(*certmanagerv1.Issuer))
 	})
+	if err != nil {
+		return err
+	}
+	err = s.owners.Watch(ctx, &certmanagerv1.Certificate{}, certificateIndex)
+	if err != nil {
+		return err
+	}
+	return s.owners.Watch(ctx, &certmanagerv1.Issuer{}, issuerIndex)
 }
 
 var _ syncertypes.ControllerModifier = &secretSyncer{}
@@ -59,14 +88,9 @@ func (s *secretSyncer) shouldSyncBackwards(pSecret, vSecret *corev1.Secret) (boo
 		return false, types.NamespacedName{}
 	}
 
-	name := s.nameByIssuer(pSecret)
-	if name.Name != "" {
-		return true, name
-	}
-
-	name = s.nameByCertificate(pSecret)
-	if name.Name != "" {
-		return true, name
+	owner, ok := s.conflicts.Owner(owners.KindSecret, types.NamespacedName{Namespace: pSecret.Namespace, Name: pSecret.Name})
+	if ok {
+		return true, owner.Target
 	}
 
 	return false, types.NamespacedName{}
@@ -97,40 +121,48 @@ func (s *secretSyncer) shouldSyncForward(ctx *context.SyncContext, vObj runtime.
 	return false, nil
 }
 
-func (s *secretSyncer) nameByCertificate(pObj client.Object) types.NamespacedName {
-	vCertificate := &certmanagerv1.Certificate{}
-	err := clienthelper.GetByIndex(context2.TODO(), s.virtualClient, vCertificate, IndexByCertificateSecret, pObj.GetName())
-	if err == nil && vCertificate.Name != "" {
-		name := vCertificate.Name
-		if vCertificate.Spec.SecretName != "" {
-			name = vCertificate.Spec.SecretName
-		}
+// nameByOwner returns the virtual name of a host secret that was created for a virtual certificate, issuer or route
+func (s *secretSyncer) nameByOwner(pObj client.Object) types.NamespacedName {
+	owner, ok := s.owners.Owner(owners.KindSecret, types.NamespacedName{Namespace: pObj.GetNamespace(), Name: pObj.GetName()})
+	if !ok {
+		return types.NamespacedName{}
+	}
 
-		return types.NamespacedName{
-			Name:      name,
-			Namespace: vCertificate.Namespace,
-		}
+	return owner.Target
+}
+
+// IsManaged also treats the host secrets cert-manager creates for virtual certificates and issuers
+// as managed, as cert-manager doesn't copy the vcluster markers onto them
+func (s *secretSyncer) IsManaged(ctx *context.SyncContext, pObj client.Object) (bool, error) {
+	if s.nameByOwner(pObj).Name != "" {
+		return true, nil
 	}
 
-	return types.NamespacedName{}
+	return s.GenericTranslator.IsManaged(ctx, pObj)
 }
 
-func (s *secretSyncer) nameByIssuer(pObj client.Object) types.NamespacedName {
-	vIssuer := &certmanagerv1.Issuer{}
-	err := clienthelper.GetByIndex(context2.TODO(), s.virtualClient, vIssuer, IndexByIssuerSecret, pObj.GetName())
-	if err == nil && vIssuer.Name != "" {
-		name := vIssuer.Name
-		if vIssuer.Spec.ACME != nil && vIssuer.Spec.ACME.PrivateKey.Name != "" {
-			name = vIssuer.Spec.ACME.PrivateKey.Name
-		}
+var _ syncertypes.ObjectExcluder = &secretSyncer{}
 
-		return types.NamespacedName{
-			Name:      name,
-			Namespace: vIssuer.Namespace,
-		}
+// ExcludeVirtual excludes the virtual secrets controlled by others. By default vcluster excludes
+// all secrets with a controller label, which includes the secrets the plugin controls itself.
+func (s *secretSyncer) ExcludeVirtual(vObj client.Object) bool {
+	return s.controlledByOthers(vObj)
+}
+
+// ExcludePhysical excludes the host secrets controlled by others
+func (s *secretSyncer) ExcludePhysical(pObj client.Object) bool {
+	return s.controlledByOthers(pObj)
+}
+
+// controlledByOthers checks the controller label and annotation of a secret. Host secrets written by
+// earlier versions carry the syncer name as controller annotation.
+func (s *secretSyncer) controlledByOthers(obj client.Object) bool {
+	controller := obj.GetLabels()[translate.ControllerLabel]
+	if controller == "" {
+		controller = obj.GetAnnotations()[translate.ControllerLabel]
 	}
 
-	return types.NamespacedName{}
+	return controller != "" && controller != constants.PluginName && controller != s.Name()
 }
 
 func (s *secretSyncer) HostToVirtual(ctx *context.SyncContext, req types.NamespacedName, pObj client.Object) types.NamespacedName {
@@ -139,22 +171,29 @@ func (s *secretSyncer) HostToVirtual(ctx *context.SyncContext, req types.Namespa
 		return namespacedName
 	}
 
-	namespacedName = s.nameByCertificate(pObj)
-	if namespacedName.Name != "" {
-		return namespacedName
+	return s.nameByOwner(pObj)
+}
+
+// secretReferencesFromCertificate returns the host secret the certificate produces
+func secretReferencesFromCertificate(certificate *certmanagerv1.Certificate) []owners.Reference {
+	name := certificate.Name
+	if certificate.Spec.SecretName != "" {
+		name = certificate.Spec.SecretName
 	}
 
-	return s.nameByIssuer(pObj)
+	return []owners.Reference{{
+		Host:   naming.HostName(nil, naming.Secret, name, certificate.Namespace),
+		Target: types.NamespacedName{Namespace: certificate.Namespace, Name: name},
+	}}
 }
 
+// secretNamesFromCertificate returns the virtual names of the secrets the certificate references
 func secretNamesFromCertificate(certificate *certmanagerv1.Certificate) []string {
 	secrets := []string{}
 	// Do not include certificate.Spec.SecretName here as this will be handled separately by a different controller
 	if certificate.Spec.SecretName != "" {
-		secrets = append(secrets, translate.Default.HostName(nil, certificate.Spec.SecretName, certificate.Namespace).Name)
 		secrets = append(secrets, certificate.Namespace+"/"+certificate.Spec.SecretName)
 	} else {
-		secrets = append(secrets, translate.Default.HostName(nil, certificate.Name, certificate.Namespace).Name)
 		secrets = append(secrets, certificate.Namespace+"/"+certificate.Name)
 	}
 	if certificate.Spec.Keystores != nil && certificate.Spec.Keystores.JKS != nil && certificate.Spec.Keystores.JKS.PasswordSecretRef.Name != "" {
@@ -189,13 +228,29 @@ func mapCertificates(ctx context2.Context, obj client.Object) []reconcile.Reques
 	return requests
 }
 
+// secretReferencesFromIssuer returns the host secret the issuer produces
+func secretReferencesFromIssuer(issuer *certmanagerv1.Issuer) []owners.Reference {
+	if issuer.Spec.ACME == nil {
+		return []owners.Reference{}
+	}
+
+	name := issuer.Name
+	if issuer.Spec.ACME.PrivateKey.Name != "" {
+		name = issuer.Spec.ACME.PrivateKey.Name
+	}
+
+	return []owners.Reference{{
+		Host:   naming.HostName(nil, naming.Secret, name, issuer.Namespace),
+		Target: types.NamespacedName{Namespace: issuer.Namespace, Name: name},
+	}}
+}
+
+// secretNamesFromIssuer returns the virtual names of the secrets the issuer references
 func secretNamesFromIssuer(issuer *certmanagerv1.Issuer) []string {
 	secrets := []string{}
 	if issuer.Spec.ACME != nil && issuer.Spec.ACME.PrivateKey.Name != "" {
-		secrets = append(secrets, translate.Default.HostName(nil, issuer.Spec.ACME.PrivateKey.Name, issuer.Namespace).Name)
 		secrets = append(secrets, issuer.Namespace+"/"+issuer.Spec.ACME.PrivateKey.Name)
 	} else if issuer.Spec.ACME != nil {
-		secrets = append(secrets, translate.Default.HostName(nil, issuer.Name, issuer.Namespace).Name)
 		secrets = append(secrets, issuer.Namespace+"/"+issuer.Name)
 	}
 	if issuer.Spec.CA != nil && issuer.Spec.CA.SecretName != "" {
@@ -0,0 +1,208 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/translator"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var translators = map[string]translate.Translator{
+	"single namespace": translate.NewSingleNamespaceTranslator("vcluster"),
+	"multi namespace":  translate.NewMultiNamespaceTranslator("vcluster"),
+}
+
+func newRegistry(objs ...client.Object) *owners.Registry {
+	registry := owners.NewRegistry()
+	for _, obj := range objs {
+		switch obj.(type) {
+		case *certmanagerv1.Certificate:
+			registry.Update(certificateIndex, obj)
+		case *certmanagerv1.Issuer:
+			registry.Update(issuerIndex, obj)
+		}
+	}
+
+	return registry
+}
+
+func hostSecret(vName, vNamespace string) *corev1.Secret {
+	pName := naming.HostName(nil, naming.Secret, vName, vNamespace)
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pName.Name,
+			Namespace: pName.Namespace,
+		},
+	}
+}
+
+func TestNameByOwnerCertificate(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			objs := []client.Object{}
+			for _, namespace := range []string{"team-a", "team-b"} {
+				objs = append(objs, &certmanagerv1.Certificate{
+					ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+					Spec:       certmanagerv1.CertificateSpec{SecretName: "web-tls"},
+				})
+			}
+			syncer := &secretSyncer{owners: newRegistry(objs...)}
+
+			for _, namespace := range []string{"team-a", "team-b"} {
+				expected := types.NamespacedName{Namespace: namespace, Name: "web-tls"}
+				if actual := syncer.nameByOwner(hostSecret("web-tls", namespace)); actual != expected {
+					t.Errorf("expected %s, got %s", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestNameByOwnerIssuer(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			objs := []client.Object{}
+			for _, namespace := range []string{"team-a", "team-b"} {
+				objs = append(objs, &certmanagerv1.Issuer{
+					ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt", Namespace: namespace},
+					Spec: certmanagerv1.IssuerSpec{
+						IssuerConfig: certmanagerv1.IssuerConfig{
+							ACME: &cmacme.ACMEIssuer{
+								PrivateKey: cmmeta.SecretKeySelector{
+									LocalObjectReference: cmmeta.LocalObjectReference{Name: "letsencrypt-account"},
+								},
+							},
+						},
+					},
+				})
+			}
+			syncer := &secretSyncer{owners: newRegistry(objs...)}
+
+			for _, namespace := range []string{"team-a", "team-b"} {
+				expected := types.NamespacedName{Namespace: namespace, Name: "letsencrypt-account"}
+				if actual := syncer.nameByOwner(hostSecret("letsencrypt-account", namespace)); actual != expected {
+					t.Errorf("expected %s, got %s", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestNameByOwnerOrder(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	// a certificate and an issuer that both claim the same secret, the older one wins
+	now := metav1.Now()
+	certificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: "shared"},
+	}
+	issuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "team-a", CreationTimestamp: now},
+		Spec: certmanagerv1.IssuerSpec{
+			IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{}},
+		},
+	}
+	registry := newRegistry(issuer, certificate)
+
+	pName := naming.HostName(nil, naming.Secret, "shared", "team-a")
+	secretOwners := registry.Owners(owners.KindSecret, pName)
+	if len(secretOwners) != 2 || secretOwners[0].Kind != owners.KindCertificate || secretOwners[1].Kind != owners.KindIssuer {
+		t.Fatalf("expected the certificate and then the issuer to own %s, got %v", pName, secretOwners)
+	}
+
+	registry.Delete(owners.KindCertificate, certificate)
+	if owner, ok := registry.Owner(owners.KindSecret, pName); !ok || owner.Kind != owners.KindIssuer {
+		t.Errorf("expected the issuer to own %s after the certificate was deleted, got %v", pName, owner)
+	}
+}
+
+func TestSecretNamesFromCertificate(t *testing.T) {
+	for name, translator := range translators {
+		t.Run(name, func(t *testing.T) {
+			fixtures.WithTranslator(t, translator)
+
+			certificate := &certmanagerv1.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"},
+				Spec:       certmanagerv1.CertificateSpec{SecretName: "web-tls"},
+			}
+
+			expected := "team-a/web-tls"
+			if actual := secretNamesFromCertificate(certificate); len(actual) != 1 || actual[0] != expected {
+				t.Errorf("expected virtual secret names [%s], got %v", expected, actual)
+			}
+
+			expectedReference := owners.Reference{
+				Host:   naming.HostName(nil, naming.Secret, "web-tls", "team-a"),
+				Target: types.NamespacedName{Namespace: "team-a", Name: "web-tls"},
+			}
+			if actual := secretReferencesFromCertificate(certificate); len(actual) != 1 || actual[0] != expectedReference {
+				t.Errorf("expected host secret references [%v], got %v", expectedReference, actual)
+			}
+		})
+	}
+}
+
+func TestControlledByOthers(t *testing.T) {
+	registerCtx := fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme), testingutil.NewFakeClient(scheme.Scheme))
+	syncer := &secretSyncer{GenericTranslator: translator.NewGenericTranslator(registerCtx, "secret", &corev1.Secret{}, nil)}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name: "no controller",
+		},
+		{
+			name:   "backward synced by the plugin",
+			labels: map[string]string{translate.ControllerLabel: constants.PluginName},
+		},
+		{
+			name:        "forwarded by earlier versions",
+			annotations: map[string]string{translate.ControllerLabel: "secret"},
+		},
+		{
+			name:     "labeled by another controller",
+			labels:   map[string]string{translate.ControllerLabel: "other"},
+			expected: true,
+		},
+		{
+			name:        "annotated by another controller",
+			annotations: map[string]string{translate.ControllerLabel: "other"},
+			expected:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web-tls", Namespace: "shop", Labels: test.labels, Annotations: test.annotations}}
+			if actual := syncer.ExcludeVirtual(secret); actual != test.expected {
+				t.Errorf("expected virtual exclusion %t, got %t", test.expected, actual)
+			}
+			if actual := syncer.ExcludePhysical(secret); actual != test.expected {
+				t.Errorf("expected host exclusion %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
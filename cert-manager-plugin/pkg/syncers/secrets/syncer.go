@@ -10,16 +10,20 @@ import (
 	"github.com/loft-sh/vcluster/pkg/syncer/translator"
 	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
 	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func New(ctx *context.RegisterContext) (syncertypes.Object, error) {
+func New(ctx *context.RegisterContext, cfg *config.Config, registry *owners.Registry, resolver *conflicts.Resolver) (syncertypes.Object, error) {
 	mapper, err := ctx.Mappings.ByGVK(mappings.Secrets())
 	if err != nil {
 		return nil, err
@@ -29,6 +33,10 @@ func New(ctx *context.RegisterContext) (syncertypes.Object, error) {
 
 		virtualClient:  ctx.VirtualManager.GetClient(),
 		physicalClient: ctx.PhysicalManager.GetClient(),
+		owners:         registry,
+		conflicts:      resolver,
+
+		keySealing: cfg.KeySealing,
 	}, nil
 }
 
@@ -37,6 +45,10 @@ type secretSyncer struct {
 
 	virtualClient  client.Client
 	physicalClient client.Client
+	owners         *owners.Registry
+	conflicts      *conflicts.Resolver
+
+	keySealing config.KeySealing
 }
 
 func (s *secretSyncer) Object() client.Object {
@@ -76,14 +88,24 @@ func (s *secretSyncer) Sync(ctx *context.SyncContext, evt *context.SyncEvent[*co
 	// was secret created by certificate or issuer?
 	shouldSyncBackwards, _ := s.shouldSyncBackwards(evt.Host, evt.Virtual)
 	if shouldSyncBackwards {
-		// delete here as secret is no longer needed
-		if equality.Semantic.DeepEqual(evt.Host.Data, evt.Virtual.Data) && evt.Virtual.Type == evt.Host.Type {
+		// don't update the secret while several owners conflict
+		if s.conflicts.Refused(owners.KindSecret, types.NamespacedName{Namespace: evt.Host.Namespace, Name: evt.Host.Name}) {
 			return ctrl.Result{}, nil
 		}
 
-		// update secret if necessary
-		evt.Virtual.Data = evt.Host.Data
-		evt.Virtual.Type = evt.Host.Type
+		// update the metadata in place, data changes recreate the secret below
+		if s.dataInSync(evt.Host, evt.Virtual) {
+			updated := evt.Virtual.DeepCopy()
+			s.translateBackwardsMetadata(ctx, evt.Host, updated)
+			if equality.Semantic.DeepEqual(updated.Annotations, evt.Virtual.Annotations) && equality.Semantic.DeepEqual(updated.Labels, evt.Virtual.Labels) {
+				return ctrl.Result{}, nil
+			}
+
+			ctx.Log.Infof("update virtual secret %s/%s because metadata of physical secret has changed", evt.Virtual.Namespace, evt.Virtual.Name)
+			return ctrl.Result{}, ctx.VirtualClient.Update(ctx.Context, updated)
+		}
+
+		// the type of secrets is immutable, so the secret is recreated with the new data
 		ctx.Log.Infof("update virtual secret %s/%s because physical secret has changed", evt.Virtual.Namespace, evt.Virtual.Name)
 		return ctrl.Result{}, ctx.VirtualClient.Delete(ctx.Context, evt.Virtual)
 	}
@@ -136,22 +158,15 @@ func (s *secretSyncer) SyncToVirtual(ctx *context.SyncContext, evt *context.Sync
 	if shouldSyncBackwards {
 		vSecret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:        vName.Name,
-				Namespace:   vName.Namespace,
-				Annotations: map[string]string{},
-				Labels:      map[string]string{},
+				Name:      vName.Name,
+				Namespace: vName.Namespace,
 			},
-			Data: evt.Host.Data,
-			Type: evt.Host.Type,
 		}
-		for k, v := range evt.Host.Annotations {
-			vSecret.Annotations[k] = v
+		s.translateBackwardsMetadata(ctx, evt.Host, vSecret)
+		err := s.translateBackwardsData(ctx, evt.Host, vSecret)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
-		for k, v := range evt.Host.Labels {
-			vSecret.Labels[k] = v
-		}
-		vSecret.Annotations[constants.BackwardSyncAnnotation] = "true"
-		vSecret.Labels[translate.ControllerLabel] = constants.PluginName
 		ctx.Log.Infof("create virtual secret %s/%s because physical secret exists", vSecret.Namespace, vSecret.Name)
 		return ctrl.Result{}, ctx.VirtualClient.Create(ctx.Context, vSecret)
 	}
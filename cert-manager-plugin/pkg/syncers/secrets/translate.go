@@ -1,15 +1,25 @@
 package secrets
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
 	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/sealing"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func (s *secretSyncer) translate(ctx *synccontext.SyncContext, vObj *corev1.Secret) *corev1.Secret {
-	newSecret := s.TranslateMetadata(ctx, vObj).(*corev1.Secret)
+	newSecret := translate.HostMetadata(vObj, s.VirtualToHost(ctx, types.NamespacedName{Name: vObj.GetName(), Namespace: vObj.GetNamespace()}, vObj))
 	if newSecret.Type == corev1.SecretTypeServiceAccountToken {
 		newSecret.Type = corev1.SecretTypeOpaque
 	}
@@ -17,36 +27,6 @@ func (s *secretSyncer) translate(ctx *synccontext.SyncContext, vObj *corev1.Secr
 	return newSecret
 }
 
-func (s *secretSyncer) TranslateMetadata(ctx *synccontext.SyncContext, pObj client.Object) client.Object {
-	vObj := pObj.DeepCopyObject().(client.Object)
-	vObj.SetResourceVersion("")
-	vObj.SetUID("")
-	vObj.SetManagedFields(nil)
-	vObj.SetOwnerReferences(nil)
-	vObj.SetFinalizers(nil)
-	vObj.SetAnnotations(s.updateVirtualAnnotations(vObj.GetAnnotations()))
-	nn := s.HostToVirtual(ctx, types.NamespacedName{Name: pObj.GetName(), Namespace: pObj.GetNamespace()}, pObj)
-	vObj.SetName(nn.Name)
-	vObj.SetNamespace(nn.Namespace)
-	return vObj
-}
-
-func (s *secretSyncer) updateVirtualAnnotations(a map[string]string) map[string]string {
-	if a == nil {
-		return map[string]string{translate.ControllerLabel: s.Name()}
-	}
-
-	a[translate.ControllerLabel] = s.Name()
-	delete(a, translate.NameAnnotation)
-	delete(a, translate.NamespaceAnnotation)
-	delete(a, translate.UIDAnnotation)
-	delete(a, translate.KindAnnotation)
-	delete(a, translate.HostNameAnnotation)
-	delete(a, translate.HostNamespaceAnnotation)
-	delete(a, corev1.LastAppliedConfigAnnotation)
-	return a
-}
-
 func (s *secretSyncer) translateUpdate(pObj, vObj *corev1.Secret) {
 	pObj.Data = vObj.Data
 	pObj.Type = vObj.Type
@@ -54,4 +34,145 @@ func (s *secretSyncer) translateUpdate(pObj, vObj *corev1.Secret) {
 	// check annotations
 	pObj.Labels = translate.HostLabels(vObj, pObj)
 	pObj.Annotations = translate.HostAnnotations(vObj, pObj)
+
+	// host secrets created by earlier versions carry the syncer name as controller annotation
+	if pObj.Annotations[translate.ControllerLabel] == s.Name() {
+		delete(pObj.Annotations, translate.ControllerLabel)
+	}
+}
+
+// translateBackwardsMetadata copies the labels and annotations of the host secret onto its
+// virtual copy. The bookkeeping annotations of cert-manager name the host Certificate and Issuer,
+// so they are translated back to the virtual objects for tools like cmctl that read them. The
+// controller.cert-manager.io/fao label is dropped, as the virtual copy isn't watched by the host
+// cert-manager.
+func (s *secretSyncer) translateBackwardsMetadata(ctx *synccontext.SyncContext, pObj, vObj *corev1.Secret) {
+	annotations := map[string]string{}
+	for k, v := range pObj.Annotations {
+		annotations[k] = v
+	}
+	for _, k := range []string{sealing.SealedAnnotation, constants.HostDataHashAnnotation} {
+		if v, ok := vObj.Annotations[k]; ok {
+			annotations[k] = v
+		}
+	}
+	annotations[constants.BackwardSyncAnnotation] = "true"
+	s.translateCertManagerAnnotations(ctx, pObj, annotations)
+
+	labels := map[string]string{}
+	for k, v := range pObj.Labels {
+		labels[k] = v
+	}
+	delete(labels, certmanagerv1.PartOfCertManagerControllerLabelKey)
+	labels[translate.ControllerLabel] = constants.PluginName
+
+	vObj.Annotations = annotations
+	vObj.Labels = labels
+}
+
+// translateCertManagerAnnotations rewrites the certificate and issuer names cert-manager
+// records on the host secret. Names without a virtual counterpart are left as they are, as are
+// ClusterIssuers and the alt names.
+func (s *secretSyncer) translateCertManagerAnnotations(ctx *synccontext.SyncContext, pObj *corev1.Secret, annotations map[string]string) {
+	if annotations[certmanagerv1.CertificateNameKey] == "" {
+		return
+	}
+
+	owner, ok := s.owners.Owner(owners.KindSecret, types.NamespacedName{Namespace: pObj.Namespace, Name: pObj.Name}, owners.KindCertificate)
+	if !ok {
+		return
+	}
+	annotations[certmanagerv1.CertificateNameKey] = owner.Object.Name
+
+	issuerKind, issuerGroup := annotations[certmanagerv1.IssuerKindAnnotationKey], annotations[certmanagerv1.IssuerGroupAnnotationKey]
+	if annotations[certmanagerv1.IssuerNameAnnotationKey] == "" || (issuerKind != "" && issuerKind != certmanagerv1.IssuerKind) || (issuerGroup != "" && issuerGroup != certmanagerv1.SchemeGroupVersion.Group) {
+		return
+	}
+
+	// the secret was issued by the issuer of the virtual certificate, unless that changed since
+	vCertificate := &certmanagerv1.Certificate{}
+	err := ctx.VirtualClient.Get(ctx.Context, owner.Object, vCertificate)
+	if err != nil {
+		return
+	}
+	issuerRef := vCertificate.Spec.IssuerRef
+	if (issuerRef.Kind == "" || issuerRef.Kind == certmanagerv1.IssuerKind) && annotations[certmanagerv1.IssuerNameAnnotationKey] == naming.HostName(ctx, naming.Issuer, issuerRef.Name, vCertificate.Namespace).Name {
+		annotations[certmanagerv1.IssuerNameAnnotationKey] = issuerRef.Name
+	}
+}
+
+func (s *secretSyncer) translateBackwardsData(ctx *synccontext.SyncContext, pObj, vObj *corev1.Secret) error {
+	if !s.keySealing.Enabled {
+		vObj.Data = pObj.Data
+		vObj.Type = pObj.Type
+		delete(vObj.Annotations, sealing.SealedAnnotation)
+		delete(vObj.Annotations, constants.HostDataHashAnnotation)
+		return nil
+	}
+
+	publicKey, err := s.sealingKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	vObj.Data, err = sealing.SealData(pObj.Data, publicKey)
+	if err != nil {
+		return err
+	}
+	vObj.Type = sealing.SealType(pObj.Type)
+
+	// sealing is not deterministic, so we remember the hash of the host data to detect changes
+	vObj.Annotations[sealing.SealedAnnotation] = sealing.Algorithm
+	vObj.Annotations[constants.HostDataHashAnnotation] = hashData(pObj.Data)
+	return nil
+}
+
+func (s *secretSyncer) sealingKey(ctx *synccontext.SyncContext) (*[sealing.KeySize]byte, error) {
+	keySecret := &corev1.Secret{}
+	err := ctx.CurrentNamespaceClient.Get(ctx.Context, types.NamespacedName{Namespace: ctx.CurrentNamespace, Name: s.keySealing.SecretName}, keySecret)
+	if err != nil {
+		return nil, fmt.Errorf("get key sealing secret %s/%s: %w", ctx.CurrentNamespace, s.keySealing.SecretName, err)
+	}
+
+	publicKey, err := sealing.ParseKey(keySecret.Data[s.keySealing.SecretKey])
+	if err != nil {
+		return nil, fmt.Errorf("parse key %s of key sealing secret %s/%s: %w", s.keySealing.SecretKey, ctx.CurrentNamespace, s.keySealing.SecretName, err)
+	}
+
+	return publicKey, nil
+}
+
+func (s *secretSyncer) dataInSync(pObj, vObj *corev1.Secret) bool {
+	return BackwardDataInSync(pObj, vObj, s.keySealing.Enabled)
+}
+
+// BackwardDataInSync checks if the virtual copy of a backward synced secret holds the data and
+// type of the host secret. Sealed data is compared by the hash of the host data it was sealed
+// from.
+func BackwardDataInSync(pObj, vObj *corev1.Secret, keySealing bool) bool {
+	sealed := vObj.Annotations != nil && vObj.Annotations[sealing.SealedAnnotation] != ""
+	if sealed != keySealing {
+		return false
+	} else if sealed {
+		return vObj.Type == sealing.SealType(pObj.Type) && vObj.Annotations[constants.HostDataHashAnnotation] == hashData(pObj.Data)
+	}
+
+	return vObj.Type == pObj.Type && equality.Semantic.DeepEqual(pObj.Data, vObj.Data)
+}
+
+func hashData(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		hash.Write([]byte(k))
+		hash.Write([]byte{0})
+		hash.Write(data[k])
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
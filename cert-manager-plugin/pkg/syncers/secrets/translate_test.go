@@ -0,0 +1,200 @@
+package secrets
+
+import (
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	"github.com/loft-sh/vcluster/pkg/syncer/translator"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/sealing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newSyncContext(vObjs ...runtime.Object) *synccontext.SyncContext {
+	registerCtx := fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme, vObjs...), testingutil.NewFakeClient(scheme.Scheme))
+	return registerCtx.ToSyncContext("secret")
+}
+
+func TestTranslateBackwardsMetadata(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	vCertificate := func(issuerRef cmmeta.ObjectReference) *certmanagerv1.Certificate {
+		return &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       certmanagerv1.CertificateSpec{SecretName: "web-tls", IssuerRef: issuerRef},
+		}
+	}
+	hostAnnotations := func(issuerName, issuerKind string) map[string]string {
+		return map[string]string{
+			certmanagerv1.CertificateNameKey:       naming.HostName(nil, naming.Certificate, "web", "shop").Name,
+			certmanagerv1.IssuerNameAnnotationKey:  issuerName,
+			certmanagerv1.IssuerKindAnnotationKey:  issuerKind,
+			certmanagerv1.IssuerGroupAnnotationKey: "cert-manager.io",
+			certmanagerv1.AltNamesAnnotationKey:    "web.example.com",
+		}
+	}
+
+	tests := []struct {
+		name         string
+		certificate  *certmanagerv1.Certificate
+		annotations  map[string]string
+		expectIssuer string
+	}{
+		{
+			name:         "issuer",
+			certificate:  vCertificate(cmmeta.ObjectReference{Name: "vault", Kind: "Issuer"}),
+			annotations:  hostAnnotations(naming.HostName(nil, naming.Issuer, "vault", "shop").Name, "Issuer"),
+			expectIssuer: "vault",
+		},
+		{
+			name:         "cluster issuer",
+			certificate:  vCertificate(cmmeta.ObjectReference{Name: "letsencrypt", Kind: "ClusterIssuer"}),
+			annotations:  hostAnnotations("letsencrypt", "ClusterIssuer"),
+			expectIssuer: "letsencrypt",
+		},
+		{
+			// the secret was issued before the virtual certificate switched issuers
+			name:         "previous issuer",
+			certificate:  vCertificate(cmmeta.ObjectReference{Name: "vault", Kind: "Issuer"}),
+			annotations:  hostAnnotations("other-issuer", "Issuer"),
+			expectIssuer: "other-issuer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			syncer := &secretSyncer{owners: newRegistry(test.certificate)}
+			pSecret := hostSecret("web-tls", "shop")
+			pSecret.Annotations = test.annotations
+			pSecret.Labels = map[string]string{certmanagerv1.PartOfCertManagerControllerLabelKey: "true"}
+
+			vSecret := &corev1.Secret{}
+			syncer.translateBackwardsMetadata(newSyncContext(test.certificate), pSecret, vSecret)
+
+			if name := vSecret.Annotations[certmanagerv1.CertificateNameKey]; name != "web" {
+				t.Errorf("expected certificate name web, got %s", name)
+			}
+			if name := vSecret.Annotations[certmanagerv1.IssuerNameAnnotationKey]; name != test.expectIssuer {
+				t.Errorf("expected issuer name %s, got %s", test.expectIssuer, name)
+			}
+			if altNames := vSecret.Annotations[certmanagerv1.AltNamesAnnotationKey]; altNames != "web.example.com" {
+				t.Errorf("expected alt names to be kept, got %s", altNames)
+			}
+			if vSecret.Annotations[constants.BackwardSyncAnnotation] != "true" {
+				t.Errorf("expected backward sync annotation, got %v", vSecret.Annotations)
+			}
+			if _, ok := vSecret.Labels[certmanagerv1.PartOfCertManagerControllerLabelKey]; ok || vSecret.Labels[translate.ControllerLabel] != constants.PluginName {
+				t.Errorf("unexpected labels %v", vSecret.Labels)
+			}
+			if pSecret.Annotations[certmanagerv1.CertificateNameKey] == "web" {
+				t.Errorf("host annotations must not be changed")
+			}
+		})
+	}
+}
+
+func TestTranslateBackwardsMetadataWithoutOwner(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	syncer := &secretSyncer{owners: newRegistry()}
+	pSecret := hostSecret("web-tls", "shop")
+	pSecret.Annotations = map[string]string{certmanagerv1.CertificateNameKey: "host-certificate"}
+
+	vSecret := &corev1.Secret{}
+	syncer.translateBackwardsMetadata(newSyncContext(), pSecret, vSecret)
+	if name := vSecret.Annotations[certmanagerv1.CertificateNameKey]; name != "host-certificate" {
+		t.Errorf("expected certificate name to be kept, got %s", name)
+	}
+}
+
+func TestTranslateUpdateFromEarlierVersion(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	registerCtx := fixtures.NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme), testingutil.NewFakeClient(scheme.Scheme))
+	syncer := &secretSyncer{GenericTranslator: translator.NewGenericTranslator(registerCtx, "secret", &corev1.Secret{}, nil)}
+
+	vSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "shop", UID: "1234"},
+		Data:       map[string][]byte{"tls.crt": []byte("certificate")},
+	}
+
+	// the host secret as written by earlier versions
+	pSecret := hostSecret("ca", "shop")
+	pSecret.Annotations = map[string]string{translate.ControllerLabel: "secret"}
+
+	syncer.translateUpdate(pSecret, vSecret)
+	if controller, ok := pSecret.Annotations[translate.ControllerLabel]; ok {
+		t.Errorf("expected controller annotation to be removed, got %s", controller)
+	}
+	if pSecret.Annotations[translate.NameAnnotation] != "ca" || pSecret.Annotations[translate.NamespaceAnnotation] != "shop" {
+		t.Errorf("expected virtual name annotations, got %v", pSecret.Annotations)
+	}
+	if pSecret.Labels[translate.NamespaceLabel] != "shop" {
+		t.Errorf("expected namespace label, got %v", pSecret.Labels)
+	}
+	if string(pSecret.Data["tls.crt"]) != "certificate" {
+		t.Errorf("expected data to be synced, got %v", pSecret.Data)
+	}
+}
+
+func TestTranslateBackwardsDataSealed(t *testing.T) {
+	fixtures.WithTranslator(t, translators["single namespace"])
+
+	publicKey, privateKey, err := sealing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sealing-key", Namespace: "vcluster"},
+		Data:       map[string][]byte{config.DefaultKeySealingSecretKey: []byte(sealing.EncodeKey(publicKey))},
+	}
+	ctx := newSyncContext()
+	ctx.CurrentNamespace = "vcluster"
+	ctx.CurrentNamespaceClient = testingutil.NewFakeClient(scheme.Scheme, keySecret)
+
+	syncer := &secretSyncer{keySealing: config.KeySealing{Enabled: true, SecretName: "sealing-key", SecretKey: config.DefaultKeySealingSecretKey}}
+	pSecret := hostSecret("web-tls", "shop")
+	pSecret.Type = corev1.SecretTypeTLS
+	pSecret.Data = map[string][]byte{corev1.TLSCertKey: []byte("certificate"), corev1.TLSPrivateKeyKey: []byte("key")}
+
+	vSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	err = syncer.translateBackwardsData(ctx, pSecret, vSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the api server rejects TLS secrets without tls.key
+	if vSecret.Type != sealing.SecretTypeSealedTLS {
+		t.Errorf("expected type %s, got %s", sealing.SecretTypeSealedTLS, vSecret.Type)
+	}
+	if _, ok := vSecret.Data[corev1.TLSPrivateKeyKey]; ok {
+		t.Errorf("expected the private key to be sealed, got %v", vSecret.Data)
+	}
+	if !syncer.dataInSync(pSecret, vSecret) {
+		t.Errorf("expected the sealed secret to be in sync")
+	}
+
+	opened, err := sealing.OpenData(vSecret.Data, publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened[corev1.TLSPrivateKeyKey]) != "key" || sealing.OpenType(vSecret.Type) != corev1.SecretTypeTLS {
+		t.Errorf("unexpected opened secret %v of type %s", opened, sealing.OpenType(vSecret.Type))
+	}
+
+	// the host secret changed its type
+	pSecret.Type = corev1.SecretTypeOpaque
+	if syncer.dataInSync(pSecret, vSecret) {
+		t.Errorf("expected the sealed secret to be out of sync after a type change")
+	}
+}
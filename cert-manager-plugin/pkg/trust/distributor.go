@@ -0,0 +1,361 @@
+// Package trust distributes the CA bundles of trust-manager into the virtual cluster.
+// trust-manager writes the target of a Bundle into the host namespaces its namespaceSelector
+// matches, which the workloads of a vcluster can't read. The plugin copies the target
+// trust-manager writes into the host namespace of the vcluster into the virtual namespaces
+// whose labels match the namespaceSelector.
+package trust
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// BundleGVK is the kind of the trust-manager Bundles. Bundles are handled as unstructured
+// objects, so the plugin doesn't depend on trust-manager.
+var BundleGVK = schema.GroupVersionKind{Group: "trust.cert-manager.io", Version: "v1alpha1", Kind: "Bundle"}
+
+// bundleTarget is the part of the Bundle spec the plugin reads
+type bundleTarget struct {
+	ConfigMap         *keySelector          `json:"configMap,omitempty"`
+	Secret            *keySelector          `json:"secret,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+type keySelector struct {
+	Key string `json:"key"`
+}
+
+// targetKind is a kind of object trust-manager writes the bundle into
+type targetKind struct {
+	name string
+	obj  func() client.Object
+	list func() client.ObjectList
+
+	// enabled returns whether the bundle writes a target of the kind
+	enabled func(target *bundleTarget) bool
+
+	// copyData copies the data of the host target and returns whether the copy changed
+	copyData func(from, to client.Object) bool
+}
+
+var (
+	configMaps = targetKind{
+		name:    "configmap",
+		obj:     func() client.Object { return &corev1.ConfigMap{} },
+		list:    func() client.ObjectList { return &corev1.ConfigMapList{} },
+		enabled: func(target *bundleTarget) bool { return target.ConfigMap != nil },
+		copyData: func(from, to client.Object) bool {
+			fromConfigMap, toConfigMap := from.(*corev1.ConfigMap), to.(*corev1.ConfigMap)
+			if equality.Semantic.DeepEqual(fromConfigMap.Data, toConfigMap.Data) && equality.Semantic.DeepEqual(fromConfigMap.BinaryData, toConfigMap.BinaryData) {
+				return false
+			}
+
+			toConfigMap.Data = fromConfigMap.Data
+			toConfigMap.BinaryData = fromConfigMap.BinaryData
+			return true
+		},
+	}
+
+	secrets = targetKind{
+		name:    "secret",
+		obj:     func() client.Object { return &corev1.Secret{} },
+		list:    func() client.ObjectList { return &corev1.SecretList{} },
+		enabled: func(target *bundleTarget) bool { return target.Secret != nil },
+		copyData: func(from, to client.Object) bool {
+			fromSecret, toSecret := from.(*corev1.Secret), to.(*corev1.Secret)
+			if equality.Semantic.DeepEqual(fromSecret.Data, toSecret.Data) {
+				return false
+			}
+
+			toSecret.Data = fromSecret.Data
+			return true
+		},
+	}
+
+	// targets are all kinds of objects bundles are written into
+	targets = []targetKind{configMaps, secrets}
+)
+
+// Distributor copies the targets of trust-manager Bundles into the virtual namespaces
+type Distributor struct {
+	registerCtx *synccontext.RegisterContext
+
+	// selector selects the Bundles that are distributed
+	selector labels.Selector
+}
+
+// New creates a new Bundle distributor
+func New(ctx *synccontext.RegisterContext, cfg config.TrustBundles) (*Distributor, error) {
+	selector := labels.Everything()
+	if cfg.Selector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(cfg.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("parse bundle selector: %w", err)
+		}
+	}
+
+	return &Distributor{
+		registerCtx: ctx,
+		selector:    selector,
+	}, nil
+}
+
+func (d *Distributor) Name() string {
+	return "trust-bundles"
+}
+
+var _ syncertypes.ControllerStarter = &Distributor{}
+
+// Register starts a controller on the host cluster that reconciles Bundles. Changes of the host
+// targets, the virtual namespaces and the virtual copies are mapped to their Bundles.
+func (d *Distributor) Register(ctx *synccontext.RegisterContext) error {
+	bld := ctrl.NewControllerManagedBy(ctx.PhysicalManager).
+		Named("trust-bundles").
+		For(newBundle(), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return d.selector.Matches(labels.Set(obj.GetLabels()))
+		}))).
+		WatchesRawSource(source.Kind(ctx.VirtualManager.GetCache(), &corev1.Namespace{}, handler.TypedEnqueueRequestsFromMapFunc(func(c context.Context, _ *corev1.Namespace) []reconcile.Request {
+			return d.mapNamespace(c)
+		})))
+	for _, target := range targets {
+		bld = bld.
+			Watches(target.obj(), handler.EnqueueRequestsFromMapFunc(d.mapHostTarget)).
+			WatchesRawSource(source.Kind(ctx.VirtualManager.GetCache(), target.obj(), handler.TypedEnqueueRequestsFromMapFunc(mapVirtualCopy)))
+	}
+
+	return bld.Complete(reconcile.Func(d.reconcile))
+}
+
+// mapNamespace maps a changed virtual namespace to all selected Bundles
+func (d *Distributor) mapNamespace(c context.Context) []reconcile.Request {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(BundleGVK.GroupVersion().WithKind(BundleGVK.Kind + "List"))
+	err := d.registerCtx.PhysicalManager.GetClient().List(c, list, client.MatchingLabelsSelector{Selector: d.selector})
+	if err != nil {
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, bundle := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: bundle.GetName()}})
+	}
+
+	return requests
+}
+
+// mapHostTarget maps a changed host target to its Bundle, which has the same name
+func (d *Distributor) mapHostTarget(_ context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != d.registerCtx.CurrentNamespace {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetName()}}}
+}
+
+// mapVirtualCopy maps a changed virtual copy to its Bundle
+func mapVirtualCopy(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[constants.BundleLabel]
+	if name == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name}}}
+}
+
+func (d *Distributor) reconcile(c context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx := d.registerCtx.ToSyncContext("trust-bundles")
+	ctx.Context = c
+
+	return reconcile.Result{}, d.Distribute(ctx, req.Name)
+}
+
+// Distribute copies the targets of the Bundle into the virtual namespaces its namespaceSelector
+// matches and removes the copies from all other namespaces. The copies of Bundles that are gone
+// or no longer selected are removed.
+func (d *Distributor) Distribute(ctx *synccontext.SyncContext, name string) error {
+	target, err := d.bundleTarget(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	namespaces := []string{}
+	if target != nil {
+		namespaces, err = d.namespaces(ctx, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, kind := range targets {
+		// a missing host target removes all copies
+		var source client.Object
+		if target != nil && kind.enabled(target) {
+			source = kind.obj()
+			err := ctx.CurrentNamespaceClient.Get(ctx, types.NamespacedName{Namespace: ctx.CurrentNamespace, Name: name}, source)
+			if kerrors.IsNotFound(err) {
+				source = nil
+			} else if err != nil {
+				return fmt.Errorf("get host %s %s/%s: %w", kind.name, ctx.CurrentNamespace, name, err)
+			}
+		}
+
+		err := d.distribute(ctx, kind, name, source, namespaces)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bundleTarget returns the target of the Bundle or nil if the Bundle is gone or not selected
+func (d *Distributor) bundleTarget(ctx *synccontext.SyncContext, name string) (*bundleTarget, error) {
+	bundle := newBundle()
+	err := ctx.PhysicalClient.Get(ctx, types.NamespacedName{Name: name}, bundle)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get bundle %s: %w", name, err)
+	} else if !d.selector.Matches(labels.Set(bundle.GetLabels())) {
+		return nil, nil
+	}
+
+	raw, _, err := unstructured.NestedMap(bundle.Object, "spec", "target")
+	if err != nil {
+		return nil, fmt.Errorf("read target of bundle %s: %w", name, err)
+	}
+	target := &bundleTarget{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, target)
+	if err != nil {
+		return nil, fmt.Errorf("read target of bundle %s: %w", name, err)
+	}
+
+	return target, nil
+}
+
+// namespaces returns the virtual namespaces the namespaceSelector of the target matches. Like
+// trust-manager, an empty selector matches all namespaces.
+func (d *Distributor) namespaces(ctx *synccontext.SyncContext, target *bundleTarget) ([]string, error) {
+	selector := labels.Everything()
+	if target.NamespaceSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(target.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("parse namespace selector: %w", err)
+		}
+	}
+
+	namespaceList := &corev1.NamespaceList{}
+	err := ctx.VirtualClient.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list virtual namespaces: %w", err)
+	}
+
+	namespaces := []string{}
+	for _, namespace := range namespaceList.Items {
+		if namespace.DeletionTimestamp == nil {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// distribute copies the host target into the namespaces and deletes all other copies. Existing
+// objects that aren't copies of the Bundle are left alone.
+func (d *Distributor) distribute(ctx *synccontext.SyncContext, kind targetKind, name string, source client.Object, namespaces []string) error {
+	list := kind.list()
+	err := ctx.VirtualClient.List(ctx, list, client.MatchingLabels{constants.BundleLabel: name})
+	if err != nil {
+		return fmt.Errorf("list virtual copies of bundle %s: %w", name, err)
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	if source != nil {
+		for _, namespace := range namespaces {
+			wanted[namespace] = true
+		}
+	}
+	for _, obj := range objs {
+		vObj := obj.(client.Object)
+		if wanted[vObj.GetNamespace()] {
+			continue
+		}
+
+		ctx.Log.Infof("delete virtual %s %s/%s, because bundle %s no longer targets its namespace", kind.name, vObj.GetNamespace(), vObj.GetName(), name)
+		err := ctx.VirtualClient.Delete(ctx, vObj)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+	if source == nil {
+		return nil
+	}
+
+	for _, namespace := range namespaces {
+		vObj := kind.obj()
+		err := ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, vObj)
+		if kerrors.IsNotFound(err) {
+			vObj = kind.obj()
+			vObj.SetNamespace(namespace)
+			vObj.SetName(name)
+			vObj.SetLabels(map[string]string{constants.BundleLabel: name})
+			kind.copyData(source, vObj)
+
+			ctx.Log.Infof("create virtual %s %s/%s of bundle %s", kind.name, namespace, name, name)
+			err = ctx.VirtualClient.Create(ctx, vObj)
+			if err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		} else if vObj.GetLabels()[constants.BundleLabel] != name {
+			ctx.Log.Infof("don't overwrite virtual %s %s/%s with bundle %s, because it wasn't created by the plugin", kind.name, namespace, name, name)
+			continue
+		}
+
+		if kind.copyData(source, vObj) {
+			ctx.Log.Infof("update virtual %s %s/%s, because bundle %s has changed", kind.name, namespace, name, name)
+			err = ctx.VirtualClient.Update(ctx, vObj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func newBundle() *unstructured.Unstructured {
+	bundle := &unstructured.Unstructured{}
+	bundle.SetGroupVersionKind(BundleGVK)
+	return bundle
+}
@@ -0,0 +1,137 @@
+package trust
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newBundleObject(name string, bundleLabels map[string]string, target map[string]interface{}) *unstructured.Unstructured {
+	bundle := newBundle()
+	bundle.SetName(name)
+	bundle.SetLabels(bundleLabels)
+	_ = unstructured.SetNestedMap(bundle.Object, target, "spec", "target")
+	return bundle
+}
+
+// newSyncContext returns a context with the virtual objects, the host Bundles and the host
+// objects in the vcluster namespace
+func newSyncContext(t *testing.T, vObjs []runtime.Object, bundles []client.Object, pObjs ...runtime.Object) *synccontext.SyncContext {
+	t.Helper()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(BundleGVK, meta.RESTScopeRoot)
+	pClient := testingutil.NewFakeClient(scheme.Scheme)
+	pClient.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(bundles...).Build()
+	registerCtx := &synccontext.RegisterContext{
+		Context:                context.Background(),
+		Config:                 testingutil.NewFakeConfig(),
+		VirtualManager:         testingutil.NewFakeManager(testingutil.NewFakeClient(scheme.Scheme, vObjs...)),
+		PhysicalManager:        testingutil.NewFakeManager(pClient),
+		CurrentNamespace:       "vcluster",
+		CurrentNamespaceClient: testingutil.NewFakeClient(scheme.Scheme, pObjs...),
+	}
+	return registerCtx.ToSyncContext("trust-bundles")
+}
+
+func TestDistribute(t *testing.T) {
+	bundle := newBundleObject("ca-bundle", map[string]string{"distribute": "true"}, map[string]interface{}{
+		"configMap":         map[string]interface{}{"key": "ca.crt"},
+		"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"trust": "enabled"}},
+	})
+	ctx := newSyncContext(t,
+		[]runtime.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"trust": "enabled"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "billing", Labels: map[string]string{"trust": "enabled"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			// outdated copy
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "billing", Labels: map[string]string{constants.BundleLabel: "ca-bundle"}},
+				Data:       map[string]string{"ca.crt": "old"},
+			},
+			// copy in a namespace that no longer matches
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "default", Labels: map[string]string{constants.BundleLabel: "ca-bundle"}},
+				Data:       map[string]string{"ca.crt": "old"},
+			},
+		},
+		[]client.Object{bundle},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "vcluster"},
+			Data:       map[string]string{"ca.crt": "bundle"},
+		},
+	)
+	distributor := &Distributor{selector: labels.SelectorFromSet(labels.Set{"distribute": "true"})}
+
+	err := distributor.Distribute(ctx, "ca-bundle")
+	if err != nil {
+		t.Fatalf("distribute: %v", err)
+	}
+
+	for _, namespace := range []string{"shop", "billing"} {
+		configMap := &corev1.ConfigMap{}
+		err := ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "ca-bundle"}, configMap)
+		if err != nil {
+			t.Fatalf("get copy in %s: %v", namespace, err)
+		}
+		if configMap.Data["ca.crt"] != "bundle" || configMap.Labels[constants.BundleLabel] != "ca-bundle" {
+			t.Errorf("unexpected copy in %s: %v %v", namespace, configMap.Labels, configMap.Data)
+		}
+	}
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "ca-bundle"}, &corev1.ConfigMap{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected copy in default to be deleted, got %v", err)
+	}
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: "shop", Name: "ca-bundle"}, &corev1.Secret{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected no secret copy, got %v", err)
+	}
+}
+
+func TestDistributeRemovesUnselectedBundles(t *testing.T) {
+	bundle := newBundleObject("ca-bundle", nil, map[string]interface{}{
+		"secret": map[string]interface{}{"key": "ca.crt"},
+	})
+	ctx := newSyncContext(t,
+		[]runtime.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "shop", Labels: map[string]string{constants.BundleLabel: "ca-bundle"}}},
+			// not created by the plugin
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "billing"}},
+		},
+		[]client.Object{bundle},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: "vcluster"},
+			Data:       map[string][]byte{"ca.crt": []byte("bundle")},
+		},
+	)
+	distributor := &Distributor{selector: labels.SelectorFromSet(labels.Set{"distribute": "true"})}
+
+	err := distributor.Distribute(ctx, "ca-bundle")
+	if err != nil {
+		t.Fatalf("distribute: %v", err)
+	}
+
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: "shop", Name: "ca-bundle"}, &corev1.Secret{})
+	if !kerrors.IsNotFound(err) {
+		t.Errorf("expected copy of unselected bundle to be deleted, got %v", err)
+	}
+	err = ctx.VirtualClient.Get(ctx, types.NamespacedName{Namespace: "billing", Name: "ca-bundle"}, &corev1.Secret{})
+	if err != nil {
+		t.Errorf("expected foreign secret to be kept, got %v", err)
+	}
+}
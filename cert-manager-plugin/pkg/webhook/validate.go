@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validator checks the objects with the same name translation and conflict policy the syncers
+// use. Objects the plugin creates itself, i.e. backward synced and imported objects, are allowed.
+type validator struct {
+	decoder       admission.Decoder
+	virtualClient client.Client
+	hostReader    client.Reader
+	resolver      *conflicts.Resolver
+}
+
+var _ admission.Handler = &validator{}
+
+func (v *validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var denied, warnings []string
+	var err error
+	switch req.Kind.Kind {
+	case "Certificate":
+		vCertificate, oldCertificate := &certmanagerv1.Certificate{}, &certmanagerv1.Certificate{}
+		if update, err := v.decode(req, vCertificate, oldCertificate); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		} else if update && equality.Semantic.DeepEqual(vCertificate.Spec, oldCertificate.Spec) {
+			return admission.Allowed("")
+		}
+		denied, err = v.validateCertificate(ctx, vCertificate)
+	case "Issuer":
+		vIssuer, oldIssuer := &certmanagerv1.Issuer{}, &certmanagerv1.Issuer{}
+		if update, err := v.decode(req, vIssuer, oldIssuer); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		} else if update && equality.Semantic.DeepEqual(vIssuer.Spec, oldIssuer.Spec) {
+			return admission.Allowed("")
+		}
+		denied, err = v.validateIssuer(ctx, vIssuer)
+	case "Ingress":
+		vIngress, oldIngress := &networkingv1.Ingress{}, &networkingv1.Ingress{}
+		if update, err := v.decode(req, vIngress, oldIngress); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		} else if update && equality.Semantic.DeepEqual(vIngress.Spec.TLS, oldIngress.Spec.TLS) && issuerAnnotationsEqual(vIngress, oldIngress) {
+			return admission.Allowed("")
+		}
+		denied, warnings, err = v.validateIngress(ctx, vIngress)
+	default:
+		return admission.Allowed("")
+	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	} else if len(denied) > 0 {
+		return admission.Denied(strings.Join(denied, "; ")).WithWarnings(warnings...)
+	}
+
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// decode decodes the object and, for updates, the old object. Returns whether the old object was
+// decoded, as updates that don't change the checked fields are allowed.
+func (v *validator) decode(req admission.Request, obj, oldObj client.Object) (bool, error) {
+	err := v.decoder.Decode(req, obj)
+	if err != nil || req.Operation != admissionv1.Update {
+		return false, err
+	}
+
+	return true, v.decoder.DecodeRaw(req.OldObject, oldObj)
+}
+
+// validateCertificate returns why the certificate is denied
+func (v *validator) validateCertificate(ctx context.Context, vCertificate *certmanagerv1.Certificate) ([]string, error) {
+	if syncedByPlugin(vCertificate) {
+		return nil, nil
+	}
+
+	denied := []string{}
+	reason, err := v.checkIssuer(ctx, vCertificate.Namespace, vCertificate.Spec.IssuerRef.Group, vCertificate.Spec.IssuerRef.Kind, vCertificate.Spec.IssuerRef.Name)
+	if err != nil {
+		return nil, err
+	} else if reason != "" {
+		denied = append(denied, reason)
+	}
+
+	// keystore passwords are synced to the host, so they must exist in the virtual cluster
+	if keystores := vCertificate.Spec.Keystores; keystores != nil {
+		passwordSecrets := []string{}
+		if keystores.JKS != nil {
+			passwordSecrets = append(passwordSecrets, keystores.JKS.PasswordSecretRef.Name)
+		}
+		if keystores.PKCS12 != nil {
+			passwordSecrets = append(passwordSecrets, keystores.PKCS12.PasswordSecretRef.Name)
+		}
+		for _, name := range passwordSecrets {
+			found, err := v.exists(ctx, types.NamespacedName{Namespace: vCertificate.Namespace, Name: name}, &corev1.Secret{})
+			if err != nil {
+				return nil, err
+			} else if !found {
+				denied = append(denied, fmt.Sprintf("keystore password secret %s/%s doesn't exist", vCertificate.Namespace, name))
+			}
+		}
+	}
+
+	if reason := v.resolver.Denied(owners.KindCertificate, vCertificate, owners.KindSecret, certificates.SecretReference(nil, vCertificate)); reason != "" {
+		denied = append(denied, reason)
+	}
+
+	return denied, nil
+}
+
+// validateIssuer returns why the issuer is denied
+func (v *validator) validateIssuer(ctx context.Context, vIssuer *certmanagerv1.Issuer) ([]string, error) {
+	if syncedByPlugin(vIssuer) {
+		return nil, nil
+	}
+
+	// the ACME account key is created by cert-manager, all other secrets are synced to the host
+	accountKey := ""
+	if vIssuer.Spec.ACME != nil {
+		accountKey = vIssuer.Spec.ACME.PrivateKey.Name
+	}
+	denied := []string{}
+	for _, name := range issuers.SecretNames(&vIssuer.Spec) {
+		if name == accountKey {
+			continue
+		}
+
+		found, err := v.secretExists(ctx, types.NamespacedName{Namespace: vIssuer.Namespace, Name: name})
+		if err != nil {
+			return nil, err
+		} else if !found {
+			denied = append(denied, fmt.Sprintf("secret %s/%s referenced by the issuer doesn't exist", vIssuer.Namespace, name))
+		}
+	}
+
+	if reference, ok := issuers.AccountSecretReference(nil, vIssuer); ok {
+		if reason := v.resolver.Denied(owners.KindIssuer, vIssuer, owners.KindSecret, reference); reason != "" {
+			denied = append(denied, reason)
+		}
+	}
+
+	return denied, nil
+}
+
+// validateIngress returns why the ingress is denied and the warnings for it. Only ingresses
+// annotated for the ingress shim are checked.
+func (v *validator) validateIngress(ctx context.Context, vIngress *networkingv1.Ingress) ([]string, []string, error) {
+	issuer, clusterIssuer := vIngress.Annotations[constants.IssuerAnnotation], vIngress.Annotations[constants.ClusterIssuerAnnotation]
+	if issuer == "" && clusterIssuer == "" {
+		return nil, nil, nil
+	}
+
+	denied := []string{}
+	if issuer != "" {
+		reason, err := v.checkIssuer(ctx, vIngress.Namespace, "", certmanagerv1.IssuerKind, issuer)
+		if err != nil {
+			return nil, nil, err
+		} else if reason != "" {
+			denied = append(denied, reason)
+		}
+	}
+	if clusterIssuer != "" {
+		reason, err := v.checkIssuer(ctx, vIngress.Namespace, "", certmanagerv1.ClusterIssuerKind, clusterIssuer)
+		if err != nil {
+			return nil, nil, err
+		} else if reason != "" {
+			denied = append(denied, reason)
+		}
+	}
+
+	// the ingress shim ignores tls entries without a secret, which is valid for ingresses that
+	// also serve hosts with the default certificate of the ingress controller
+	warnings := []string{}
+	for i, tls := range vIngress.Spec.TLS {
+		if tls.SecretName == "" {
+			warnings = append(warnings, fmt.Sprintf("tls entry %d has no secretName, so no certificate is requested for it", i))
+		}
+	}
+
+	return denied, warnings, nil
+}
+
+// checkIssuer returns why the issuer reference can't be resolved. Issuers are synced from the
+// virtual cluster, while ClusterIssuers are used from the host as they are. References to
+// external issuers aren't checked.
+func (v *validator) checkIssuer(ctx context.Context, namespace, group, kind, name string) (string, error) {
+	if group != "" && group != certmanagerv1.SchemeGroupVersion.Group {
+		return "", nil
+	}
+
+	switch kind {
+	case "", certmanagerv1.IssuerKind:
+		found, err := v.exists(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &certmanagerv1.Issuer{})
+		if err != nil || found {
+			return "", err
+		}
+		return fmt.Sprintf("issuer %s/%s doesn't exist", namespace, name), nil
+	case certmanagerv1.ClusterIssuerKind:
+		err := v.hostReader.Get(ctx, types.NamespacedName{Name: name}, &certmanagerv1.ClusterIssuer{})
+		if kerrors.IsNotFound(err) {
+			return fmt.Sprintf("cluster issuer %s doesn't exist on the host", name), nil
+		} else if err != nil {
+			return "", fmt.Errorf("get cluster issuer %s: %w", name, err)
+		}
+		return "", nil
+	}
+
+	return "", nil
+}
+
+// secretExists checks if the secret exists or is the secret of a certificate, e.g. the CA of a
+// CA issuer that is created together with the issuer
+func (v *validator) secretExists(ctx context.Context, name types.NamespacedName) (bool, error) {
+	found, err := v.exists(ctx, name, &corev1.Secret{})
+	if err != nil || found {
+		return found, err
+	}
+
+	certificateList := &certmanagerv1.CertificateList{}
+	err = v.virtualClient.List(ctx, certificateList, client.InNamespace(name.Namespace))
+	if err != nil {
+		return false, fmt.Errorf("list certificates: %w", err)
+	}
+	for _, certificate := range certificateList.Items {
+		if certificate.Spec.SecretName == name.Name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (v *validator) exists(ctx context.Context, name types.NamespacedName, obj client.Object) (bool, error) {
+	err := v.virtualClient.Get(ctx, name, obj)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// syncedByPlugin checks if the plugin created the object from a host object
+func syncedByPlugin(obj client.Object) bool {
+	annotations := obj.GetAnnotations()
+	return annotations[constants.BackwardSyncAnnotation] == "true" || annotations[constants.ImportedFromAnnotation] != ""
+}
+
+func issuerAnnotationsEqual(a, b *networkingv1.Ingress) bool {
+	return a.Annotations[constants.IssuerAnnotation] == b.Annotations[constants.IssuerAnnotation] &&
+		a.Annotations[constants.ClusterIssuerAnnotation] == b.Annotations[constants.ClusterIssuerAnnotation]
+}
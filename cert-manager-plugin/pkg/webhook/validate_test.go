@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fixtures"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const virtualNamespace = "shop"
+
+// newValidator returns a validator for the virtual and host objects. The virtual certificates are
+// registered as owners of their secrets like the secret syncer does.
+func newValidator(t *testing.T, policy string, vObjs, pObjs []runtime.Object) *validator {
+	virtualClient := testingutil.NewFakeClient(scheme.Scheme, vObjs...)
+	registerCtx := fixtures.NewRegisterContext(virtualClient, testingutil.NewFakeClient(scheme.Scheme, pObjs...))
+
+	registry := owners.NewRegistry()
+	index := owners.Index{
+		OwnerKind: owners.KindCertificate,
+		HostKind:  owners.KindSecret,
+		References: func(obj client.Object) []owners.Reference {
+			return []owners.Reference{certificates.SecretReference(nil, obj.(*certmanagerv1.Certificate))}
+		},
+	}
+	for _, obj := range vObjs {
+		if certificate, ok := obj.(*certmanagerv1.Certificate); ok {
+			registry.Update(index, certificate)
+		}
+	}
+	resolver, err := conflicts.NewResolver(registerCtx, policy, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &validator{
+		decoder:       admission.NewDecoder(scheme.Scheme),
+		virtualClient: virtualClient,
+		hostReader:    testingutil.NewFakeClient(scheme.Scheme, pObjs...),
+		resolver:      resolver,
+	}
+}
+
+func request(t *testing.T, kind string, obj, oldObj client.Object) admission.Request {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Kind: kind},
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+	if oldObj != nil {
+		oldRaw, err := json.Marshal(oldObj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Operation = admissionv1.Update
+		req.OldObject = runtime.RawExtension{Raw: oldRaw}
+	}
+	return req
+}
+
+func newCertificate(name, secretName string, issuerRef cmmeta.ObjectReference) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		TypeMeta:   metav1.TypeMeta{APIVersion: certmanagerv1.SchemeGroupVersion.String(), Kind: "Certificate"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: name, CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))},
+		Spec:       certmanagerv1.CertificateSpec{SecretName: secretName, IssuerRef: issuerRef},
+	}
+}
+
+func TestValidateCertificate(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	issuer := &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "letsencrypt"}}
+	clusterIssuer := &certmanagerv1.ClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "company-ca"}}
+	existing := newCertificate("shop", "shop-tls", cmmeta.ObjectReference{Name: "letsencrypt"})
+
+	tests := []struct {
+		name     string
+		obj      *certmanagerv1.Certificate
+		oldObj   *certmanagerv1.Certificate
+		policy   string
+		expected string
+	}{
+		{
+			name: "valid issuer",
+			obj:  newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "letsencrypt", Kind: "Issuer"}),
+		},
+		{
+			name: "valid cluster issuer",
+			obj:  newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "company-ca", Kind: "ClusterIssuer"}),
+		},
+		{
+			name:     "missing issuer",
+			obj:      newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "vault", Kind: "Issuer"}),
+			expected: "issuer shop/vault doesn't exist",
+		},
+		{
+			name:     "missing cluster issuer",
+			obj:      newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "vault", Kind: "ClusterIssuer"}),
+			expected: "cluster issuer vault doesn't exist on the host",
+		},
+		{
+			name: "external issuer",
+			obj:  newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "aws-pca", Kind: "AWSPCAIssuer", Group: "awspca.cert-manager.io"}),
+		},
+		{
+			name:     "secret of another certificate",
+			obj:      newCertificate("web", "shop-tls", cmmeta.ObjectReference{Name: "letsencrypt"}),
+			expected: "secret shop/shop-tls is referenced by Certificate shop/shop already (policy first-writer-wins)",
+		},
+		{
+			name:   "shared secret",
+			obj:    newCertificate("web", "shop-tls", cmmeta.ObjectReference{Name: "letsencrypt"}),
+			policy: conflicts.PolicyShared,
+		},
+		{
+			name:   "unchanged spec",
+			obj:    newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "vault"}),
+			oldObj: newCertificate("web", "web-tls", cmmeta.ObjectReference{Name: "vault"}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := test.policy
+			if policy == "" {
+				policy = conflicts.PolicyFirstWriterWins
+			}
+			validator := newValidator(t, policy, []runtime.Object{issuer, existing}, []runtime.Object{clusterIssuer})
+
+			var oldObj client.Object
+			if test.oldObj != nil {
+				oldObj = test.oldObj
+			}
+			response := validator.Handle(context.Background(), request(t, "Certificate", test.obj, oldObj))
+			if test.expected == "" {
+				if !response.Allowed {
+					t.Errorf("expected certificate to be allowed, got %v", response.Result)
+				}
+				return
+			}
+			if response.Allowed || !strings.Contains(response.Result.Message, test.expected) {
+				t.Errorf("expected certificate to be denied with %q, got %v", test.expected, response.Result)
+			}
+		})
+	}
+}
+
+func TestValidateIssuer(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	caCertificate := newCertificate("ca", "ca-key-pair", cmmeta.ObjectReference{Name: "selfsigned"})
+	token := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "cloudflare-token"}}
+	validator := newValidator(t, conflicts.PolicyFirstWriterWins, []runtime.Object{caCertificate, token}, nil)
+
+	newIssuer := func(spec certmanagerv1.IssuerSpec) *certmanagerv1.Issuer {
+		return &certmanagerv1.Issuer{
+			TypeMeta:   metav1.TypeMeta{APIVersion: certmanagerv1.SchemeGroupVersion.String(), Kind: "Issuer"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "issuer"},
+			Spec:       spec,
+		}
+	}
+	acme := func(tokenName string) certmanagerv1.IssuerSpec {
+		return certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+			PrivateKey: cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: "account-key"}},
+			Solvers: []cmacme.ACMEChallengeSolver{{DNS01: &cmacme.ACMEChallengeSolverDNS01{Cloudflare: &cmacme.ACMEIssuerDNS01ProviderCloudflare{
+				APIToken: &cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: tokenName}},
+			}}}},
+		}}}
+	}
+
+	tests := []struct {
+		name     string
+		issuer   *certmanagerv1.Issuer
+		expected string
+	}{
+		{name: "ca from certificate", issuer: newIssuer(certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{CA: &certmanagerv1.CAIssuer{SecretName: "ca-key-pair"}}})},
+		{name: "missing ca", issuer: newIssuer(certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{CA: &certmanagerv1.CAIssuer{SecretName: "other-ca"}}}), expected: "secret shop/other-ca referenced by the issuer doesn't exist"},
+		{name: "acme with solver secret", issuer: newIssuer(acme("cloudflare-token"))},
+		{name: "acme with missing solver secret", issuer: newIssuer(acme("route53")), expected: "secret shop/route53 referenced by the issuer doesn't exist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := validator.Handle(context.Background(), request(t, "Issuer", test.issuer, nil))
+			if test.expected == "" {
+				if !response.Allowed {
+					t.Errorf("expected issuer to be allowed, got %v", response.Result)
+				}
+				return
+			}
+			if response.Allowed || !strings.Contains(response.Result.Message, test.expected) {
+				t.Errorf("expected issuer to be denied with %q, got %v", test.expected, response.Result)
+			}
+		})
+	}
+}
+
+func TestValidateIngress(t *testing.T) {
+	fixtures.WithSingleNamespaceTranslator(t)
+
+	issuer := &certmanagerv1.Issuer{ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "letsencrypt"}}
+	validator := newValidator(t, conflicts.PolicyFirstWriterWins, []runtime.Object{issuer}, nil)
+
+	newIngress := func(annotations map[string]string, secretName string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			TypeMeta:   metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "Ingress"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: virtualNamespace, Name: "web", Annotations: annotations},
+			Spec:       networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{{Hosts: []string{"web.example.com"}, SecretName: secretName}}},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		ingress         *networkingv1.Ingress
+		expected        string
+		expectedWarning string
+	}{
+		{name: "not annotated", ingress: newIngress(nil, "")},
+		{name: "valid issuer", ingress: newIngress(map[string]string{constants.IssuerAnnotation: "letsencrypt"}, "web-tls")},
+		{name: "missing issuer", ingress: newIngress(map[string]string{constants.IssuerAnnotation: "vault"}, "web-tls"), expected: "issuer shop/vault doesn't exist"},
+		{name: "missing cluster issuer", ingress: newIngress(map[string]string{constants.ClusterIssuerAnnotation: "vault"}, "web-tls"), expected: "cluster issuer vault doesn't exist"},
+		{name: "missing secret name", ingress: newIngress(map[string]string{constants.IssuerAnnotation: "letsencrypt"}, ""), expectedWarning: "tls entry 0 has no secretName"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := validator.Handle(context.Background(), request(t, "Ingress", test.ingress, nil))
+			if warnings := strings.Join(response.Warnings, "; "); !strings.Contains(warnings, test.expectedWarning) || (test.expectedWarning == "" && warnings != "") {
+				t.Errorf("expected warning %q, got %q", test.expectedWarning, warnings)
+			}
+			if test.expected == "" {
+				if !response.Allowed {
+					t.Errorf("expected ingress to be allowed, got %v", response.Result)
+				}
+				return
+			}
+			if response.Allowed || !strings.Contains(response.Result.Message, test.expected) {
+				t.Errorf("expected ingress to be denied with %q, got %v", test.expected, response.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package webhook serves a validating admission webhook for the Certificates, Issuers and
+// annotated Ingresses of the virtual cluster. It rejects references the syncers can't resolve and
+// objects the conflict policy wouldn't sync, so mistakes are reported by kubectl apply instead of
+// as events after the sync. The virtual API server runs next to the plugin, so the webhook is
+// served with a self-signed certificate that is generated on every start.
+package webhook
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// ConfigurationName is the name of the ValidatingWebhookConfiguration in the virtual cluster
+	ConfigurationName = "cert-manager-plugin"
+
+	// Path is the path the webhook is served on
+	Path = "/validate"
+
+	webhookName = "validate.cert-manager.vcluster.loft.sh"
+)
+
+// Webhook serves the validating webhook and registers it in the virtual cluster
+type Webhook struct {
+	cfg       config.Webhook
+	validator *validator
+}
+
+// New creates the webhook. The conflicts are checked with the resolver of the syncers.
+func New(ctx *synccontext.RegisterContext, cfg config.Webhook, resolver *conflicts.Resolver) *Webhook {
+	return &Webhook{
+		cfg: cfg,
+		validator: &validator{
+			decoder:       admission.NewDecoder(scheme.Scheme),
+			virtualClient: ctx.VirtualManager.GetClient(),
+			hostReader:    ctx.PhysicalManager.GetAPIReader(),
+			resolver:      resolver,
+		},
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "validating-webhook"
+}
+
+var _ syncertypes.ControllerStarter = &Webhook{}
+
+// Register starts serving the webhook and creates or updates its configuration in the virtual
+// cluster with the CA bundle of the new certificate
+func (w *Webhook) Register(ctx *synccontext.RegisterContext) error {
+	certPEM, keyPEM, err := newServingCertificate(w.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("create webhook serving certificate: %w", err)
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("load webhook serving certificate: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, &admission.Webhook{Handler: w.validator})
+	server := &http.Server{
+		Addr:      ":" + strconv.Itoa(w.cfg.Port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12},
+	}
+
+	syncCtx := ctx.ToSyncContext("validating-webhook")
+	go func() {
+		syncCtx.Log.Infof("Serving validating webhook on %s", server.Addr)
+		err := server.ListenAndServeTLS("", "")
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			syncCtx.Log.Errorf("Error serving validating webhook: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Context.Done()
+		_ = server.Close()
+	}()
+
+	return w.ensureConfiguration(syncCtx, certPEM)
+}
+
+func (w *Webhook) ensureConfiguration(ctx *synccontext.SyncContext, caBundle []byte) error {
+	desired := configuration(w.cfg, caBundle)
+	existing := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	err := ctx.VirtualClient.Get(ctx, types.NamespacedName{Name: ConfigurationName}, existing)
+	if kerrors.IsNotFound(err) {
+		return ctx.VirtualClient.Create(ctx, desired)
+	} else if err != nil {
+		return fmt.Errorf("get validating webhook configuration %s: %w", ConfigurationName, err)
+	}
+
+	existing.Webhooks = desired.Webhooks
+	return ctx.VirtualClient.Update(ctx, existing)
+}
+
+// configuration returns the webhook configuration that sends the creates and updates of
+// Certificates, Issuers and Ingresses to the webhook
+func configuration(cfg config.Webhook, caBundle []byte) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	url := "https://" + net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)) + Path
+	operations := []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+	rule := func(group, version, resource string) admissionregistrationv1.RuleWithOperations {
+		return admissionregistrationv1.RuleWithOperations{
+			Operations: operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{group},
+				APIVersions: []string{version},
+				Resources:   []string{resource},
+				Scope:       ptr.To(admissionregistrationv1.NamespacedScope),
+			},
+		}
+	}
+	failurePolicy := admissionregistrationv1.FailurePolicyType(cfg.FailurePolicy)
+
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigurationName},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name: webhookName,
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				URL:      &url,
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{
+				rule(certmanagerv1.SchemeGroupVersion.Group, certmanagerv1.SchemeGroupVersion.Version, "certificates"),
+				rule(certmanagerv1.SchemeGroupVersion.Group, certmanagerv1.SchemeGroupVersion.Version, "issuers"),
+				rule(networkingv1.SchemeGroupVersion.Group, networkingv1.SchemeGroupVersion.Version, "ingresses"),
+			},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             ptr.To(admissionregistrationv1.SideEffectClassNone),
+			AdmissionReviewVersions: []string{"v1"},
+			TimeoutSeconds:          ptr.To(int32(5)),
+		}},
+	}
+}
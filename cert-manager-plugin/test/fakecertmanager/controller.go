@@ -0,0 +1,476 @@
+// Package fakecertmanager holds a fake cert-manager for the integration tests. It issues the
+// host Certificates the plugin created through CertificateRequests that are signed by a
+// local self-signed CA, writes the TLS secrets and Ready conditions like cert-manager does
+// and can inject issuance failures on demand.
+package fakecertmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultDuration is the validity of issued certificates if the certificate doesn't specify one
+const DefaultDuration = time.Hour
+
+// Controller acts like cert-manager within the host cluster
+type Controller struct {
+	client client.Client
+
+	// CA signs all certificate requests
+	CA *CA
+
+	m sync.Mutex
+
+	// failures holds the injected failure messages by host certificate name
+	failures map[types.NamespacedName]string
+
+	// renewals holds the host certificates that should be reissued
+	renewals map[types.NamespacedName]bool
+
+	// events triggers reconciles after failures were injected or renewals were requested
+	events chan event.GenericEvent
+}
+
+// New creates a new fake cert-manager that writes with the given host client
+func New(hostClient client.Client) (*Controller, error) {
+	ca, err := NewCA()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Controller{
+		client:   hostClient,
+		CA:       ca,
+		failures: map[types.NamespacedName]string{},
+		renewals: map[types.NamespacedName]bool{},
+		events:   make(chan event.GenericEvent, 100),
+	}, nil
+}
+
+// SetupWithManager registers the certificate and issuer controllers with the host manager
+func (c *Controller) SetupWithManager(mgr ctrl.Manager) error {
+	err := ctrl.NewControllerManagedBy(mgr).
+		Named("fake-cert-manager-certificates").
+		For(&certmanagerv1.Certificate{}, builder.WithPredicates(predicate.NewPredicateFuncs(createdByPlugin))).
+		WatchesRawSource(source.Channel(c.events, &handler.EnqueueRequestForObject{})).
+		Complete(reconcile.Func(c.reconcileCertificate))
+	if err != nil {
+		return fmt.Errorf("create certificate controller: %w", err)
+	}
+
+	err = ctrl.NewControllerManagedBy(mgr).
+		Named("fake-cert-manager-issuers").
+		For(&certmanagerv1.Issuer{}, builder.WithPredicates(predicate.NewPredicateFuncs(createdByPlugin))).
+		Complete(reconcile.Func(c.reconcileIssuer))
+	if err != nil {
+		return fmt.Errorf("create issuer controller: %w", err)
+	}
+
+	return nil
+}
+
+// Fail makes every issuance of the host certificate fail with the message until Recover is called
+func (c *Controller) Fail(name types.NamespacedName, message string) {
+	c.m.Lock()
+	c.failures[name] = message
+	c.m.Unlock()
+
+	c.trigger(name)
+}
+
+// Recover removes an injected failure of the host certificate
+func (c *Controller) Recover(name types.NamespacedName) {
+	c.m.Lock()
+	delete(c.failures, name)
+	c.m.Unlock()
+
+	c.trigger(name)
+}
+
+// Renew reissues the host certificate, regardless of whether it is still valid
+func (c *Controller) Renew(name types.NamespacedName) {
+	c.m.Lock()
+	c.renewals[name] = true
+	c.m.Unlock()
+
+	c.trigger(name)
+}
+
+func (c *Controller) trigger(name types.NamespacedName) {
+	c.events <- event.GenericEvent{Object: &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace}}}
+}
+
+func (c *Controller) failure(name types.NamespacedName) (string, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	message, ok := c.failures[name]
+	return message, ok
+}
+
+func (c *Controller) renewalRequested(name types.NamespacedName) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	requested := c.renewals[name]
+	delete(c.renewals, name)
+	return requested
+}
+
+func (c *Controller) reconcileCertificate(ctx context.Context, req reconcile.Request) (ctrl.Result, error) {
+	certificate := &certmanagerv1.Certificate{}
+	err := c.client.Get(ctx, req.NamespacedName, certificate)
+	if kerrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	} else if certificate.DeletionTimestamp != nil || !createdByPlugin(certificate) {
+		return ctrl.Result{}, nil
+	}
+
+	// cert-manager waits for the issuer
+	if certificate.Spec.IssuerRef.Kind == "" || certificate.Spec.IssuerRef.Kind == "Issuer" {
+		err = c.client.Get(ctx, types.NamespacedName{Namespace: certificate.Namespace, Name: certificate.Spec.IssuerRef.Name}, &certmanagerv1.Issuer{})
+		if kerrors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: time.Second}, nil
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if message, ok := c.failure(req.NamespacedName); ok {
+		return ctrl.Result{}, c.fail(ctx, certificate, message)
+	}
+
+	secret := &corev1.Secret{}
+	err = c.client.Get(ctx, types.NamespacedName{Namespace: certificate.Namespace, Name: certificate.Spec.SecretName}, secret)
+	if kerrors.IsNotFound(err) {
+		secret = nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !c.renewalRequested(req.NamespacedName) && !needsIssuance(certificate, secret) {
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, c.issue(ctx, certificate, secret)
+}
+
+// needsIssuance checks if the secret doesn't hold a certificate that matches the spec
+func needsIssuance(certificate *certmanagerv1.Certificate, secret *corev1.Secret) bool {
+	if secret == nil || len(secret.Data[corev1.TLSCertKey]) == 0 {
+		return true
+	} else if condition := findCondition(certificate.Status.Conditions, certmanagerv1.CertificateConditionIssuing); condition != nil && condition.Status == cmmeta.ConditionTrue {
+		return true
+	}
+
+	annotations := secret.Annotations
+	return annotations[certmanagerv1.CertificateNameKey] != certificate.Name ||
+		annotations[certmanagerv1.IssuerNameAnnotationKey] != certificate.Spec.IssuerRef.Name ||
+		annotations[certmanagerv1.AltNamesAnnotationKey] != strings.Join(certificate.Spec.DNSNames, ",") ||
+		annotations[certmanagerv1.CommonNameAnnotationKey] != certificate.Spec.CommonName
+}
+
+// issue creates a certificate request, signs it and writes the secret and the Ready condition
+func (c *Controller) issue(ctx context.Context, certificate *certmanagerv1.Certificate, secret *corev1.Secret) error {
+	revision := 1
+	if certificate.Status.Revision != nil {
+		revision = *certificate.Status.Revision + 1
+	}
+	duration := DefaultDuration
+	if certificate.Spec.Duration != nil {
+		duration = certificate.Spec.Duration.Duration
+	}
+
+	keyPEM, csrPEM, err := newCertificateRequest(certificate.Spec.CommonName, certificate.Spec.DNSNames)
+	if err != nil {
+		return err
+	}
+	request, err := c.createCertificateRequest(ctx, certificate, revision, csrPEM)
+	if err != nil {
+		return err
+	}
+
+	certificatePEM, err := c.CA.Sign(csrPEM, duration)
+	if err != nil {
+		return err
+	}
+	request.Status.Certificate = certificatePEM
+	request.Status.CA = c.CA.PEM
+	request.Status.Conditions = []certmanagerv1.CertificateRequestCondition{{
+		Type:               certmanagerv1.CertificateRequestConditionReady,
+		Status:             cmmeta.ConditionTrue,
+		Reason:             certmanagerv1.CertificateRequestReasonIssued,
+		Message:            "Certificate fetched from issuer successfully",
+		LastTransitionTime: ptr.To(metav1.Now()),
+	}}
+	err = c.client.Status().Update(ctx, request)
+	if err != nil {
+		return fmt.Errorf("update certificate request status: %w", err)
+	}
+
+	err = c.writeSecret(ctx, certificate, secret, certificatePEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(certificatePEM)
+	signed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse signed certificate: %w", err)
+	}
+
+	certificate.Status.Conditions = setCondition(certificate.Status.Conditions, certmanagerv1.CertificateCondition{
+		Type:    certmanagerv1.CertificateConditionReady,
+		Status:  cmmeta.ConditionTrue,
+		Reason:  "Ready",
+		Message: "Certificate is up to date and has not expired",
+	})
+	certificate.Status.Conditions = removeCondition(certificate.Status.Conditions, certmanagerv1.CertificateConditionIssuing)
+	certificate.Status.Revision = ptr.To(revision)
+	certificate.Status.NotBefore = ptr.To(metav1.NewTime(signed.NotBefore))
+	certificate.Status.NotAfter = ptr.To(metav1.NewTime(signed.NotAfter))
+	certificate.Status.RenewalTime = ptr.To(metav1.NewTime(signed.NotAfter.Add(-duration / 3)))
+	certificate.Status.LastFailureTime = nil
+	certificate.Status.FailedIssuanceAttempts = nil
+	err = c.client.Status().Update(ctx, certificate)
+	if err != nil {
+		return fmt.Errorf("update certificate status: %w", err)
+	}
+
+	return nil
+}
+
+// fail creates a failed certificate request and marks the certificate as failed
+func (c *Controller) fail(ctx context.Context, certificate *certmanagerv1.Certificate, message string) error {
+	issuing := findCondition(certificate.Status.Conditions, certmanagerv1.CertificateConditionIssuing)
+	if issuing != nil && issuing.Status == cmmeta.ConditionFalse && issuing.Message == message {
+		return nil
+	}
+
+	revision := 1
+	if certificate.Status.Revision != nil {
+		revision = *certificate.Status.Revision + 1
+	}
+	_, csrPEM, err := newCertificateRequest(certificate.Spec.CommonName, certificate.Spec.DNSNames)
+	if err != nil {
+		return err
+	}
+	request, err := c.createCertificateRequest(ctx, certificate, revision, csrPEM)
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	request.Status.FailureTime = &now
+	request.Status.Conditions = []certmanagerv1.CertificateRequestCondition{{
+		Type:               certmanagerv1.CertificateRequestConditionReady,
+		Status:             cmmeta.ConditionFalse,
+		Reason:             certmanagerv1.CertificateRequestReasonFailed,
+		Message:            message,
+		LastTransitionTime: &now,
+	}}
+	err = c.client.Status().Update(ctx, request)
+	if err != nil {
+		return fmt.Errorf("update certificate request status: %w", err)
+	}
+
+	certificate.Status.Conditions = setCondition(certificate.Status.Conditions, certmanagerv1.CertificateCondition{
+		Type:    certmanagerv1.CertificateConditionIssuing,
+		Status:  cmmeta.ConditionFalse,
+		Reason:  "Failed",
+		Message: message,
+	})
+	if findCondition(certificate.Status.Conditions, certmanagerv1.CertificateConditionReady) == nil {
+		certificate.Status.Conditions = setCondition(certificate.Status.Conditions, certmanagerv1.CertificateCondition{
+			Type:    certmanagerv1.CertificateConditionReady,
+			Status:  cmmeta.ConditionFalse,
+			Reason:  "DoesNotExist",
+			Message: "Issuing certificate as Secret does not exist",
+		})
+	}
+	certificate.Status.LastFailureTime = &now
+	certificate.Status.FailedIssuanceAttempts = ptr.To(ptr.Deref(certificate.Status.FailedIssuanceAttempts, 0) + 1)
+	err = c.client.Status().Update(ctx, certificate)
+	if err != nil {
+		return fmt.Errorf("update certificate status: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Controller) createCertificateRequest(ctx context.Context, certificate *certmanagerv1.Certificate, revision int, csrPEM []byte) (*certmanagerv1.CertificateRequest, error) {
+	request := &certmanagerv1.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      certificate.Name + "-" + strconv.Itoa(revision),
+			Namespace: certificate.Namespace,
+			Annotations: map[string]string{
+				certmanagerv1.CertificateNameKey:                      certificate.Name,
+				certmanagerv1.CertificateRequestRevisionAnnotationKey: strconv.Itoa(revision),
+			},
+		},
+		Spec: certmanagerv1.CertificateRequestSpec{
+			Duration:  certificate.Spec.Duration,
+			IssuerRef: certificate.Spec.IssuerRef,
+			Request:   csrPEM,
+			IsCA:      certificate.Spec.IsCA,
+			Usages:    certificate.Spec.Usages,
+		},
+	}
+	err := controllerutil.SetControllerReference(certificate, request, c.client.Scheme())
+	if err != nil {
+		return nil, fmt.Errorf("set owner of certificate request: %w", err)
+	}
+
+	// a failed request of the same revision is replaced
+	err = c.client.Delete(ctx, request)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("delete certificate request: %w", err)
+	}
+	err = c.client.Create(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate request: %w", err)
+	}
+
+	return request, nil
+}
+
+func (c *Controller) writeSecret(ctx context.Context, certificate *certmanagerv1.Certificate, secret *corev1.Secret, certificatePEM, keyPEM []byte) error {
+	create := secret == nil
+	if create {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      certificate.Spec.SecretName,
+				Namespace: certificate.Namespace,
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+
+	secret.Annotations[certmanagerv1.CertificateNameKey] = certificate.Name
+	secret.Annotations[certmanagerv1.IssuerNameAnnotationKey] = certificate.Spec.IssuerRef.Name
+	secret.Annotations[certmanagerv1.IssuerKindAnnotationKey] = certificate.Spec.IssuerRef.Kind
+	secret.Annotations[certmanagerv1.IssuerGroupAnnotationKey] = certificate.Spec.IssuerRef.Group
+	secret.Annotations[certmanagerv1.AltNamesAnnotationKey] = strings.Join(certificate.Spec.DNSNames, ",")
+	secret.Annotations[certmanagerv1.CommonNameAnnotationKey] = certificate.Spec.CommonName
+	secret.Labels[certmanagerv1.PartOfCertManagerControllerLabelKey] = "true"
+	secret.Data = map[string][]byte{
+		corev1.TLSCertKey:       certificatePEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		"ca.crt":                c.CA.PEM,
+	}
+
+	var err error
+	if create {
+		err = c.client.Create(ctx, secret)
+	} else {
+		err = c.client.Update(ctx, secret)
+	}
+	if err != nil {
+		return fmt.Errorf("write secret: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileIssuer marks the issuers the plugin created as ready
+func (c *Controller) reconcileIssuer(ctx context.Context, req reconcile.Request) (ctrl.Result, error) {
+	issuer := &certmanagerv1.Issuer{}
+	err := c.client.Get(ctx, req.NamespacedName, issuer)
+	if kerrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, condition := range issuer.Status.Conditions {
+		if condition.Type == certmanagerv1.IssuerConditionReady && condition.Status == cmmeta.ConditionTrue {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	issuer.Status.Conditions = []certmanagerv1.IssuerCondition{{
+		Type:               certmanagerv1.IssuerConditionReady,
+		Status:             cmmeta.ConditionTrue,
+		Reason:             "IsReady",
+		Message:            "Signing CA verified",
+		LastTransitionTime: ptr.To(metav1.Now()),
+	}}
+	return ctrl.Result{}, c.client.Status().Update(ctx, issuer)
+}
+
+// createdByPlugin checks if the host object was created by the plugin
+func createdByPlugin(obj client.Object) bool {
+	return obj.GetLabels()[translate.MarkerLabel] != ""
+}
+
+func findCondition(conditions []certmanagerv1.CertificateCondition, conditionType certmanagerv1.CertificateConditionType) *certmanagerv1.CertificateCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// setCondition replaces the condition of the same type and keeps the transition time if the
+// status didn't change
+func setCondition(conditions []certmanagerv1.CertificateCondition, condition certmanagerv1.CertificateCondition) []certmanagerv1.CertificateCondition {
+	condition.LastTransitionTime = ptr.To(metav1.Now())
+	for i := range conditions {
+		if conditions[i].Type != condition.Type {
+			continue
+		}
+
+		if conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+
+	return append(conditions, condition)
+}
+
+func removeCondition(conditions []certmanagerv1.CertificateCondition, conditionType certmanagerv1.CertificateConditionType) []certmanagerv1.CertificateCondition {
+	retConditions := []certmanagerv1.CertificateCondition{}
+	for _, condition := range conditions {
+		if condition.Type != conditionType {
+			retConditions = append(retConditions, condition)
+		}
+	}
+
+	return retConditions
+}
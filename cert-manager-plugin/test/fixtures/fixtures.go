@@ -0,0 +1,54 @@
+// Package fixtures holds the fake clients and contexts the unit tests of the plugin share.
+// Importing the package registers the cert-manager types in the vcluster scheme.
+package fixtures
+
+import (
+	"context"
+	"testing"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	_ = certmanagerv1.AddToScheme(scheme.Scheme)
+	_ = cmacme.AddToScheme(scheme.Scheme)
+}
+
+// WithTranslator replaces the vcluster name translator until the test finished
+func WithTranslator(t *testing.T, translator translate.Translator) {
+	oldTranslator := translate.Default
+	translate.Default = translator
+	t.Cleanup(func() {
+		translate.Default = oldTranslator
+	})
+}
+
+// WithSingleNamespaceTranslator translates names like a vcluster named vcluster that syncs
+// into a single host namespace until the test finished
+func WithSingleNamespaceTranslator(t *testing.T) {
+	WithTranslator(t, translate.NewSingleNamespaceTranslator("vcluster"))
+}
+
+// NewRegisterContext returns a register context with managers for the fake virtual and host
+// clients
+func NewRegisterContext(vClient, pClient *testingutil.FakeIndexClient) *synccontext.RegisterContext {
+	return &synccontext.RegisterContext{
+		Context:         context.Background(),
+		Config:          testingutil.NewFakeConfig(),
+		VirtualManager:  testingutil.NewFakeManager(vClient),
+		PhysicalManager: testingutil.NewFakeManager(pClient),
+	}
+}
+
+// NewSyncContext returns a sync context with fake virtual and host clients that hold the
+// given objects
+func NewSyncContext(vObjs, pObjs []runtime.Object) *synccontext.SyncContext {
+	registerCtx := NewRegisterContext(testingutil.NewFakeClient(scheme.Scheme, vObjs...), testingutil.NewFakeClient(scheme.Scheme, pObjs...))
+	return registerCtx.ToSyncContext("test")
+}
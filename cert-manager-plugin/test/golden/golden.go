@@ -0,0 +1,86 @@
+// Package golden compares the results of tests with golden YAML files. Fixtures and golden
+// files live in the testdata directory of the tested package. Running the tests with
+//
+//	go test ./... -update
+//
+// rewrites the golden files with the current results instead of comparing them.
+package golden
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update the golden files instead of comparing against them")
+
+// Cases returns the names of all fixtures within dir that end with suffix, without the suffix
+func Cases(t *testing.T, dir, suffix string) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		t.Fatalf("list fixtures: %v", err)
+	} else if len(paths) == 0 {
+		t.Fatalf("no fixtures matching %s found in %s", suffix, dir)
+	}
+
+	cases := []string{}
+	for _, path := range paths {
+		cases = append(cases, strings.TrimSuffix(filepath.Base(path), suffix))
+	}
+	sort.Strings(cases)
+	return cases
+}
+
+// Load reads the YAML file into obj
+func Load(t *testing.T, path string, obj interface{}) {
+	t.Helper()
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	err = yaml.UnmarshalStrict(out, obj)
+	if err != nil {
+		t.Fatalf("unmarshal fixture %s: %v", path, err)
+	}
+}
+
+// Assert compares obj with the golden YAML file. If the tests run with -update, the golden
+// file is written instead.
+func Assert(t *testing.T, path string, obj interface{}) {
+	t.Helper()
+
+	actual, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatalf("marshal result: %v", err)
+	}
+
+	if *update {
+		err = os.WriteFile(path, actual, 0o644)
+		if err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden file %s doesn't exist, run the tests with -update to create it", path)
+	} else if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+
+	if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+		t.Errorf("result differs from golden file %s (-expected +actual):\n%s", path, diff)
+	}
+}
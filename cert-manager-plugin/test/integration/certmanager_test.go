@@ -0,0 +1,155 @@
+package integration
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// waitForIssuedSecret waits until the virtual secret holds a certificate signed by the fake
+// cert-manager that differs from the previous one and returns it
+func (h *harness) waitForIssuedSecret(t *testing.T, name types.NamespacedName, previous *x509.Certificate) *x509.Certificate {
+	t.Helper()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(h.certManager.CA.PEM)
+
+	var issued *x509.Certificate
+	eventually(t, func() error {
+		vSecret := &corev1.Secret{}
+		err := h.virtualClient.Get(h.ctx, name, vSecret)
+		if err != nil {
+			return err
+		} else if vSecret.Annotations[constants.BackwardSyncAnnotation] != "true" {
+			return fmt.Errorf("virtual secret %s is not synced backwards", name)
+		}
+
+		block, _ := pem.Decode(vSecret.Data[corev1.TLSCertKey])
+		if block == nil {
+			return fmt.Errorf("virtual secret %s holds no certificate", name)
+		}
+		issued, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		} else if previous != nil && issued.SerialNumber.Cmp(previous.SerialNumber) == 0 {
+			return fmt.Errorf("virtual secret %s still holds the previous certificate", name)
+		} else if len(vSecret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+			return fmt.Errorf("virtual secret %s holds no private key", name)
+		}
+
+		_, err = issued.Verify(x509.VerifyOptions{Roots: roots})
+		return err
+	})
+
+	return issued
+}
+
+// waitForVirtualCertificate waits until the virtual certificate matches the condition
+func (h *harness) waitForVirtualCertificate(t *testing.T, vCertificate *certmanagerv1.Certificate, condition func(vCertificate *certmanagerv1.Certificate) error) {
+	t.Helper()
+
+	eventually(t, func() error {
+		current := &certmanagerv1.Certificate{}
+		err := h.virtualClient.Get(h.ctx, client.ObjectKeyFromObject(vCertificate), current)
+		if err != nil {
+			return err
+		}
+
+		return condition(current)
+	})
+}
+
+func TestIssuance(t *testing.T) {
+	h := newHarness(t, withCertManager())
+	issuer, certificate := h.createCertificate(t, "issuance")
+
+	issued := h.waitForIssuedSecret(t, types.NamespacedName{Namespace: "issuance", Name: "web-tls"}, nil)
+	if len(issued.DNSNames) != 1 || issued.DNSNames[0] != "web.example.com" {
+		t.Errorf("expected issued dns names [web.example.com], got %v", issued.DNSNames)
+	}
+
+	h.waitForVirtualCertificate(t, certificate, func(vCertificate *certmanagerv1.Certificate) error {
+		if !isReady(vCertificate.Status.Conditions) {
+			return fmt.Errorf("virtual certificate is not ready: %v", vCertificate.Status.Conditions)
+		} else if vCertificate.Status.NotAfter == nil || !vCertificate.Status.NotAfter.Time.Equal(issued.NotAfter) {
+			return fmt.Errorf("expected virtual certificate to expire at %s, got %v", issued.NotAfter, vCertificate.Status.NotAfter)
+		}
+
+		return nil
+	})
+
+	eventually(t, func() error {
+		vIssuer := &certmanagerv1.Issuer{}
+		err := h.virtualClient.Get(h.ctx, client.ObjectKeyFromObject(issuer), vIssuer)
+		if err != nil {
+			return err
+		}
+
+		for _, condition := range vIssuer.Status.Conditions {
+			if condition.Type == certmanagerv1.IssuerConditionReady && condition.Status == cmmeta.ConditionTrue {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("virtual issuer is not ready: %v", vIssuer.Status.Conditions)
+	})
+}
+
+func TestReissuance(t *testing.T) {
+	h := newHarness(t, withCertManager())
+	_, certificate := h.createCertificate(t, "reissuance")
+	secretName := types.NamespacedName{Namespace: "reissuance", Name: "web-tls"}
+
+	first := h.waitForIssuedSecret(t, secretName, nil)
+
+	h.certManager.Renew(h.hostName(naming.Certificate, certificate.Name, certificate.Namespace))
+	h.waitForIssuedSecret(t, secretName, first)
+	h.waitForVirtualCertificate(t, certificate, func(vCertificate *certmanagerv1.Certificate) error {
+		if vCertificate.Status.Revision == nil || *vCertificate.Status.Revision != 2 {
+			return fmt.Errorf("expected virtual certificate revision 2, got %v", vCertificate.Status.Revision)
+		}
+
+		return nil
+	})
+}
+
+func TestIssuanceFailure(t *testing.T) {
+	h := newHarness(t, withCertManager())
+	pCertificateName := h.hostName(naming.Certificate, "web", "failure")
+	h.certManager.Fail(pCertificateName, "issuer is unavailable")
+	_, certificate := h.createCertificate(t, "failure")
+
+	h.waitForVirtualCertificate(t, certificate, func(vCertificate *certmanagerv1.Certificate) error {
+		if isReady(vCertificate.Status.Conditions) {
+			return fmt.Errorf("virtual certificate is ready although issuance fails")
+		}
+
+		for _, condition := range vCertificate.Status.Conditions {
+			if condition.Type == certmanagerv1.CertificateConditionIssuing && condition.Status == cmmeta.ConditionFalse && condition.Message == "issuer is unavailable" {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("virtual certificate did not fail: %v", vCertificate.Status.Conditions)
+	})
+
+	// the certificate is issued once the issuer recovers
+	h.certManager.Recover(pCertificateName)
+	h.waitForIssuedSecret(t, types.NamespacedName{Namespace: "failure", Name: "web-tls"}, nil)
+	h.waitForVirtualCertificate(t, certificate, func(vCertificate *certmanagerv1.Certificate) error {
+		if !isReady(vCertificate.Status.Conditions) {
+			return fmt.Errorf("virtual certificate is not ready: %v", vCertificate.Status.Conditions)
+		}
+
+		return nil
+	})
+}
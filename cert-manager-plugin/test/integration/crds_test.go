@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// certManagerCRDs returns minimal cert-manager CRDs. The schemas preserve unknown fields, so
+// the API servers accept every spec the syncers write without the full cert-manager schemas.
+func certManagerCRDs() []*apiextensionsv1.CustomResourceDefinition {
+	return []*apiextensionsv1.CustomResourceDefinition{
+		crd("Certificate", "certificates", apiextensionsv1.NamespaceScoped),
+		crd("CertificateRequest", "certificaterequests", apiextensionsv1.NamespaceScoped),
+		crd("Issuer", "issuers", apiextensionsv1.NamespaceScoped),
+		crd("ClusterIssuer", "clusterissuers", apiextensionsv1.ClusterScoped),
+	}
+}
+
+func crd(kind, plural string, scope apiextensionsv1.ResourceScope) *apiextensionsv1.CustomResourceDefinition {
+	preserveUnknownFields := apiextensionsv1.JSONSchemaProps{
+		Type:                   "object",
+		XPreserveUnknownFields: ptr.To(true),
+	}
+
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: plural + "." + certmanagerv1.SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: certmanagerv1.SchemeGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     kind,
+				ListKind: kind + "List",
+				Plural:   plural,
+				Singular: strings.ToLower(kind),
+			},
+			Scope: scope,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    certmanagerv1.SchemeGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec":   preserveUnknownFields,
+							"status": preserveUnknownFields,
+						},
+					},
+				},
+				Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+				},
+			}},
+		},
+	}
+}
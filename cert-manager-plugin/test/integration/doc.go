@@ -0,0 +1,9 @@
+// Package integration holds the integration tests of the plugin. The tests run the
+// certificates, issuers and secrets syncers together with the ingress hook against two
+// envtest API servers, one acting as host cluster and one as virtual cluster, with the
+// cert-manager CRDs installed in both.
+//
+// The tests need the envtest binaries and are skipped if KUBEBUILDER_ASSETS is not set:
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path 1.31.x) go test ./test/integration/...
+package integration
@@ -0,0 +1,335 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/loft-sh/vcluster/pkg/mappings"
+	"github.com/loft-sh/vcluster/pkg/mappings/resources"
+	"github.com/loft-sh/vcluster/pkg/mappings/store"
+	"github.com/loft-sh/vcluster/pkg/scheme"
+	"github.com/loft-sh/vcluster/pkg/syncer"
+	"github.com/loft-sh/vcluster/pkg/syncer/synccontext"
+	syncertypes "github.com/loft-sh/vcluster/pkg/syncer/types"
+	testingutil "github.com/loft-sh/vcluster/pkg/util/testing"
+	"github.com/loft-sh/vcluster/pkg/util/translate"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/config"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/conflicts"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/hooks/ingresses"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/owners"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/certificates"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/issuers"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/syncers/secrets"
+	"github.com/nirvati/vcluster-cert-manager-plugin/test/fakecertmanager"
+	"github.com/nirvati/vcluster-sdk/plugin"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const (
+	// timeout is the time a condition has to become true within
+	timeout = 30 * time.Second
+
+	// interval is the interval conditions are checked in
+	interval = 250 * time.Millisecond
+)
+
+var (
+	hostConfig    *rest.Config
+	virtualConfig *rest.Config
+
+	// harnesses counts the started harnesses, every harness uses its own host namespace
+	harnesses int
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		fmt.Println("Skipping integration tests, KUBEBUILDER_ASSETS is not set")
+		os.Exit(0)
+	}
+
+	_ = certmanagerv1.AddToScheme(scheme.Scheme)
+
+	hostEnv := &envtest.Environment{CRDs: certManagerCRDs()}
+	virtualEnv := &envtest.Environment{CRDs: certManagerCRDs()}
+
+	var err error
+	hostConfig, err = hostEnv.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting host api server: %v\n", err)
+		os.Exit(1)
+	}
+	virtualConfig, err = virtualEnv.Start()
+	if err != nil {
+		_ = hostEnv.Stop()
+		fmt.Fprintf(os.Stderr, "Error starting virtual api server: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = virtualEnv.Stop()
+	_ = hostEnv.Stop()
+	os.Exit(code)
+}
+
+// harness runs the syncers and the ingress hook of the plugin against the host and the
+// virtual api server, the way vcluster runs them within the plugin
+type harness struct {
+	ctx context.Context
+
+	registerCtx *synccontext.RegisterContext
+	hook        plugin.ClientHook
+
+	// hostClient and virtualClient are uncached clients for the host and virtual api server
+	hostClient    client.Client
+	virtualClient client.Client
+
+	// hostNamespace is the namespace all virtual objects are synced to
+	hostNamespace string
+
+	// certManager issues the host certificates if the harness was started withCertManager
+	certManager *fakecertmanager.Controller
+}
+
+// harnessOption configures the harness before it is started
+type harnessOption func(h *harness, hostManager ctrl.Manager) error
+
+// withCertManager runs the fake cert-manager within the host cluster
+func withCertManager() harnessOption {
+	return func(h *harness, hostManager ctrl.Manager) error {
+		var err error
+		h.certManager, err = fakecertmanager.New(hostManager.GetClient())
+		if err != nil {
+			return err
+		}
+
+		return h.certManager.SetupWithManager(hostManager)
+	}
+}
+
+// newHarness starts the syncers in a new host namespace. The syncers are stopped when the
+// test finishes.
+func newHarness(t *testing.T, options ...harnessOption) *harness {
+	t.Helper()
+
+	harnesses++
+	hostNamespace := fmt.Sprintf("vcluster-%d", harnesses)
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &harness{
+		ctx:           ctx,
+		hook:          ingresses.NewIngressHook(nil),
+		hostNamespace: hostNamespace,
+	}
+
+	var err error
+	h.hostClient, err = client.New(hostConfig, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		t.Fatalf("create host client: %v", err)
+	}
+	h.virtualClient, err = client.New(virtualConfig, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		t.Fatalf("create virtual client: %v", err)
+	}
+	err = h.hostClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: hostNamespace}})
+	if err != nil {
+		t.Fatalf("create host namespace: %v", err)
+	}
+
+	// vcluster sets the translator before the plugin starts
+	oldTranslator, oldVClusterName := translate.Default, translate.VClusterName
+	translate.Default = translate.NewSingleNamespaceTranslator(hostNamespace)
+	translate.VClusterName = "vcluster"
+
+	hostManager, err := ctrl.NewManager(hostConfig, ctrl.Options{
+		Scheme:     scheme.Scheme,
+		Metrics:    metricsserver.Options{BindAddress: "0"},
+		Cache:      cache.Options{DefaultNamespaces: map[string]cache.Config{hostNamespace: {}}},
+		Controller: ctrlconfig.Controller{SkipNameValidation: ptr.To(true)},
+	})
+	if err != nil {
+		t.Fatalf("create host manager: %v", err)
+	}
+	virtualManager, err := ctrl.NewManager(virtualConfig, ctrl.Options{
+		Scheme:     scheme.Scheme,
+		Metrics:    metricsserver.Options{BindAddress: "0"},
+		Controller: ctrlconfig.Controller{SkipNameValidation: ptr.To(true)},
+	})
+	if err != nil {
+		t.Fatalf("create virtual manager: %v", err)
+	}
+
+	vConfig := testingutil.NewFakeConfig()
+	vConfig.WorkloadNamespace = hostNamespace
+	vConfig.WorkloadTargetNamespace = hostNamespace
+	h.registerCtx = &synccontext.RegisterContext{
+		Context:                ctx,
+		Config:                 vConfig,
+		CurrentNamespace:       hostNamespace,
+		CurrentNamespaceClient: hostManager.GetClient(),
+		VirtualManager:         virtualManager,
+		PhysicalManager:        hostManager,
+	}
+
+	mappingsStore, err := store.NewStore(ctx, virtualManager.GetClient(), hostManager.GetClient(), store.NewMemoryBackend())
+	if err != nil {
+		t.Fatalf("create mappings store: %v", err)
+	}
+	h.registerCtx.Mappings = mappings.NewMappingsRegistry(mappingsStore)
+	secretsMapper, err := resources.CreateSecretsMapper(h.registerCtx)
+	if err != nil {
+		t.Fatalf("create secrets mapper: %v", err)
+	}
+	err = h.registerCtx.Mappings.AddMapper(secretsMapper)
+	if err != nil {
+		t.Fatalf("add secrets mapper: %v", err)
+	}
+
+	// create the syncers like main does
+	cfg := &config.Config{}
+	cfg.Default()
+	err = naming.Init(h.registerCtx, cfg.Naming.Strategy)
+	if err != nil {
+		t.Fatalf("init naming strategy: %v", err)
+	}
+	registry := owners.NewRegistry()
+	resolver, err := conflicts.NewResolver(h.registerCtx, cfg.ConflictPolicy, registry)
+	if err != nil {
+		t.Fatalf("create conflict resolver: %v", err)
+	}
+	certificateSyncer, err := certificates.New(h.registerCtx, cfg, registry, resolver)
+	if err != nil {
+		t.Fatalf("create certificate syncer: %v", err)
+	}
+	issuerSyncer, err := issuers.New(h.registerCtx, resolver)
+	if err != nil {
+		t.Fatalf("create issuer syncer: %v", err)
+	}
+	secretSyncer, err := secrets.New(h.registerCtx, cfg, registry, resolver)
+	if err != nil {
+		t.Fatalf("create secret syncer: %v", err)
+	}
+
+	for _, obj := range []syncertypes.Object{certificateSyncer, issuerSyncer, secretSyncer} {
+		if registerer, ok := obj.(syncertypes.IndicesRegisterer); ok {
+			err = registerer.RegisterIndices(h.registerCtx)
+			if err != nil {
+				t.Fatalf("register indices of %s: %v", obj.Name(), err)
+			}
+		}
+
+		err = syncer.RegisterSyncer(h.registerCtx, obj.(syncertypes.Syncer))
+		if err != nil {
+			t.Fatalf("register syncer %s: %v", obj.Name(), err)
+		}
+	}
+
+	for _, option := range options {
+		err = option(h, hostManager)
+		if err != nil {
+			t.Fatalf("configure harness: %v", err)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, manager := range []ctrl.Manager{hostManager, virtualManager} {
+		wg.Add(1)
+		go func(manager ctrl.Manager) {
+			defer wg.Done()
+			if err := manager.Start(ctx); err != nil {
+				t.Errorf("start manager: %v", err)
+			}
+		}(manager)
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+
+		translate.Default = oldTranslator
+		translate.VClusterName = oldVClusterName
+	})
+
+	if !hostManager.GetCache().WaitForCacheSync(ctx) || !virtualManager.GetCache().WaitForCacheSync(ctx) {
+		t.Fatal("caches did not sync")
+	}
+
+	return h
+}
+
+// createNamespace creates a namespace within the virtual cluster
+func (h *harness) createNamespace(t *testing.T, name string) {
+	t.Helper()
+
+	err := h.virtualClient.Create(h.ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		t.Fatalf("create virtual namespace %s: %v", name, err)
+	}
+}
+
+// syncIngress syncs the virtual ingress to the host the way vcluster does, including the
+// ingress hook of the plugin, and returns the host ingress
+func (h *harness) syncIngress(t *testing.T, vIngress *networkingv1.Ingress) *networkingv1.Ingress {
+	t.Helper()
+
+	// wait until the plugin observed the ingress
+	eventually(t, func() error {
+		return h.registerCtx.VirtualManager.GetClient().Get(h.ctx, client.ObjectKeyFromObject(vIngress), &networkingv1.Ingress{})
+	})
+
+	pIngress := translate.HostMetadata(vIngress, translate.Default.HostName(nil, vIngress.Name, vIngress.Namespace))
+	for i := range pIngress.Spec.TLS {
+		pIngress.Spec.TLS[i].SecretName = naming.HostName(nil, naming.Secret, pIngress.Spec.TLS[i].SecretName, vIngress.Namespace).Name
+	}
+
+	mutated, err := h.hook.(plugin.MutateCreatePhysical).MutateCreatePhysical(h.ctx, pIngress)
+	if err != nil {
+		t.Fatalf("mutate host ingress: %v", err)
+	}
+	pIngress = mutated.(*networkingv1.Ingress)
+
+	err = h.hostClient.Create(h.ctx, pIngress)
+	if err != nil {
+		t.Fatalf("create host ingress: %v", err)
+	}
+
+	return pIngress
+}
+
+// hostName returns the host name of a virtual object
+func (h *harness) hostName(kind naming.Kind, vName, vNamespace string) types.NamespacedName {
+	return naming.HostName(nil, kind, vName, vNamespace)
+}
+
+// eventually fails the test if the condition doesn't succeed within the timeout
+func eventually(t *testing.T, condition func() error) {
+	t.Helper()
+
+	var err error
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		err = condition()
+		if err == nil {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+
+	t.Fatalf("condition not met within %s: %v", timeout, err)
+}
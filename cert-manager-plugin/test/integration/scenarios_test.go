@@ -0,0 +1,429 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/constants"
+	"github.com/nirvati/vcluster-cert-manager-plugin/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// createCertificate creates a self signed issuer and a certificate within the virtual namespace
+func (h *harness) createCertificate(t *testing.T, namespace string) (*certmanagerv1.Issuer, *certmanagerv1.Certificate) {
+	t.Helper()
+
+	h.createNamespace(t, namespace)
+	issuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "selfsigned", Namespace: namespace},
+		Spec: certmanagerv1.IssuerSpec{
+			IssuerConfig: certmanagerv1.IssuerConfig{SelfSigned: &certmanagerv1.SelfSignedIssuer{}},
+		},
+	}
+	err := h.virtualClient.Create(h.ctx, issuer)
+	if err != nil {
+		t.Fatalf("create virtual issuer: %v", err)
+	}
+
+	certificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: "web-tls",
+			DNSNames:   []string{"web.example.com"},
+			IssuerRef:  cmmeta.ObjectReference{Name: "selfsigned", Kind: "Issuer", Group: "cert-manager.io"},
+		},
+	}
+	err = h.virtualClient.Create(h.ctx, certificate)
+	if err != nil {
+		t.Fatalf("create virtual certificate: %v", err)
+	}
+
+	return issuer, certificate
+}
+
+// waitForHostCertificate waits until the virtual certificate is synced to the host
+func (h *harness) waitForHostCertificate(t *testing.T, vCertificate *certmanagerv1.Certificate) *certmanagerv1.Certificate {
+	t.Helper()
+
+	pCertificate := &certmanagerv1.Certificate{}
+	eventually(t, func() error {
+		return h.hostClient.Get(h.ctx, h.hostName(naming.Certificate, vCertificate.Name, vCertificate.Namespace), pCertificate)
+	})
+
+	return pCertificate
+}
+
+// issue acts like cert-manager issuing the host certificate: it writes the certificate data
+// into the host secret and marks the certificate as ready with the given revision
+func (h *harness) issue(t *testing.T, pCertificate *certmanagerv1.Certificate, certificateData string, revision int) {
+	t.Helper()
+
+	pSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pCertificate.Spec.SecretName,
+			Namespace: pCertificate.Namespace,
+			Annotations: map[string]string{
+				certmanagerv1.CertificateNameKey: pCertificate.Name,
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(certificateData),
+			corev1.TLSPrivateKeyKey: []byte("key-" + certificateData),
+		},
+	}
+	err := h.hostClient.Get(h.ctx, client.ObjectKeyFromObject(pSecret), &corev1.Secret{})
+	if kerrors.IsNotFound(err) {
+		err = h.hostClient.Create(h.ctx, pSecret)
+	} else if err == nil {
+		err = h.hostClient.Update(h.ctx, pSecret)
+	}
+	if err != nil {
+		t.Fatalf("write host secret: %v", err)
+	}
+
+	err = h.hostClient.Get(h.ctx, client.ObjectKeyFromObject(pCertificate), pCertificate)
+	if err != nil {
+		t.Fatalf("get host certificate: %v", err)
+	}
+	pCertificate.Status = certmanagerv1.CertificateStatus{
+		Conditions: []certmanagerv1.CertificateCondition{{
+			Type:               certmanagerv1.CertificateConditionReady,
+			Status:             cmmeta.ConditionTrue,
+			Reason:             "Ready",
+			Message:            "Certificate is up to date and has not expired",
+			LastTransitionTime: ptr.To(metav1.NewTime(time.Now().Truncate(time.Second))),
+		}},
+		Revision: ptr.To(revision),
+	}
+	err = h.hostClient.Status().Update(h.ctx, pCertificate)
+	if err != nil {
+		t.Fatalf("update host certificate status: %v", err)
+	}
+}
+
+// waitForVirtualSecret waits until the virtual secret holds the certificate data
+func (h *harness) waitForVirtualSecret(t *testing.T, name types.NamespacedName, certificateData string) {
+	t.Helper()
+
+	eventually(t, func() error {
+		vSecret := &corev1.Secret{}
+		err := h.virtualClient.Get(h.ctx, name, vSecret)
+		if err != nil {
+			return err
+		} else if vSecret.Annotations[constants.BackwardSyncAnnotation] != "true" {
+			return fmt.Errorf("virtual secret %s is not synced backwards", name)
+		} else if string(vSecret.Data[corev1.TLSCertKey]) != certificateData {
+			return fmt.Errorf("virtual secret %s has certificate %q, expected %q", name, vSecret.Data[corev1.TLSCertKey], certificateData)
+		}
+
+		return nil
+	})
+}
+
+func isReady(conditions []certmanagerv1.CertificateCondition) bool {
+	for _, condition := range conditions {
+		if condition.Type == certmanagerv1.CertificateConditionReady && condition.Status == cmmeta.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestForwardCreation(t *testing.T) {
+	h := newHarness(t)
+	issuer, certificate := h.createCertificate(t, "forward")
+
+	eventually(t, func() error {
+		return h.hostClient.Get(h.ctx, h.hostName(naming.Issuer, issuer.Name, issuer.Namespace), &certmanagerv1.Issuer{})
+	})
+
+	pCertificate := h.waitForHostCertificate(t, certificate)
+	if expected := h.hostName(naming.Secret, "web-tls", "forward").Name; pCertificate.Spec.SecretName != expected {
+		t.Errorf("expected host certificate secret name %s, got %s", expected, pCertificate.Spec.SecretName)
+	}
+	if expected := h.hostName(naming.Issuer, "selfsigned", "forward").Name; pCertificate.Spec.IssuerRef.Name != expected {
+		t.Errorf("expected host certificate issuer %s, got %s", expected, pCertificate.Spec.IssuerRef.Name)
+	}
+	if len(pCertificate.Spec.DNSNames) != 1 || pCertificate.Spec.DNSNames[0] != "web.example.com" {
+		t.Errorf("expected host certificate dns names [web.example.com], got %v", pCertificate.Spec.DNSNames)
+	}
+}
+
+func TestBackwardSyncFromIngress(t *testing.T) {
+	h := newHarness(t)
+	h.createNamespace(t, "ingress")
+
+	newIngress := func(name string, annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ingress", Annotations: annotations},
+			Spec: networkingv1.IngressSpec{
+				DefaultBackend: &networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{Name: name, Port: networkingv1.ServiceBackendPort{Number: 80}},
+				},
+				TLS: []networkingv1.IngressTLS{{Hosts: []string{name + ".example.com"}, SecretName: name + "-tls"}},
+			},
+		}
+	}
+
+	// the ingress hook rewrites the issuer annotation to the host issuer
+	vIngress := newIngress("api", map[string]string{constants.IssuerAnnotation: "letsencrypt"})
+	err := h.virtualClient.Create(h.ctx, vIngress)
+	if err != nil {
+		t.Fatalf("create virtual ingress: %v", err)
+	}
+	pIngress := h.syncIngress(t, vIngress)
+	if expected := h.hostName(naming.Issuer, "letsencrypt", "ingress").Name; pIngress.Annotations[constants.IssuerAnnotation] != expected {
+		t.Errorf("expected host ingress issuer %s, got %s", expected, pIngress.Annotations[constants.IssuerAnnotation])
+	}
+
+	// the ingress shim copies the tenant labels of the ingress onto its certificate
+	if pIngress.Labels[constants.VirtualNamespaceLabel] != "ingress" || pIngress.Labels[constants.VClusterLabel] == "" {
+		t.Errorf("expected the host ingress to carry the tenant labels, got %v", pIngress.Labels)
+	}
+
+	// the certificate the ingress shim creates for an ingress is synced into the virtual cluster
+	vIngress = newIngress("web", map[string]string{constants.ClusterIssuerAnnotation: "letsencrypt"})
+	err = h.virtualClient.Create(h.ctx, vIngress)
+	if err != nil {
+		t.Fatalf("create virtual ingress: %v", err)
+	}
+	pIngress = h.syncIngress(t, vIngress)
+
+	pCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: pIngress.Spec.TLS[0].SecretName, Namespace: h.hostNamespace},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: pIngress.Spec.TLS[0].SecretName,
+			DNSNames:   pIngress.Spec.TLS[0].Hosts,
+			IssuerRef:  cmmeta.ObjectReference{Name: "letsencrypt", Kind: "ClusterIssuer", Group: "cert-manager.io"},
+		},
+	}
+	err = h.hostClient.Create(h.ctx, pCertificate)
+	if err != nil {
+		t.Fatalf("create host certificate: %v", err)
+	}
+
+	eventually(t, func() error {
+		vCertificate := &certmanagerv1.Certificate{}
+		err := h.virtualClient.Get(h.ctx, types.NamespacedName{Namespace: "ingress", Name: "web-tls"}, vCertificate)
+		if err != nil {
+			return err
+		} else if vCertificate.Annotations[constants.BackwardSyncAnnotation] != "true" {
+			return fmt.Errorf("virtual certificate is not synced backwards")
+		} else if vCertificate.Spec.SecretName != "web-tls" {
+			return fmt.Errorf("expected virtual certificate secret name web-tls, got %s", vCertificate.Spec.SecretName)
+		} else if vCertificate.Spec.IssuerRef.Name != "letsencrypt" || vCertificate.Spec.IssuerRef.Kind != "ClusterIssuer" {
+			return fmt.Errorf("expected virtual certificate issuer ClusterIssuer letsencrypt, got %s %s", vCertificate.Spec.IssuerRef.Kind, vCertificate.Spec.IssuerRef.Name)
+		}
+
+		return nil
+	})
+
+	// host certificates without the tenant labels get them, so approver policies can match them
+	eventually(t, func() error {
+		err := h.hostClient.Get(h.ctx, client.ObjectKeyFromObject(pCertificate), pCertificate)
+		if err != nil {
+			return err
+		} else if pCertificate.Labels[constants.VirtualNamespaceLabel] != "ingress" {
+			return fmt.Errorf("expected the host certificate to carry the tenant labels, got %v", pCertificate.Labels)
+		}
+
+		return nil
+	})
+
+	// the secret cert-manager issues for the certificate is synced into the virtual cluster as well
+	h.issue(t, pCertificate, "ingress", 1)
+	h.waitForVirtualSecret(t, types.NamespacedName{Namespace: "ingress", Name: "web-tls"}, "ingress")
+}
+
+func TestBackwardSyncFromIngressWithIssuer(t *testing.T) {
+	h := newHarness(t)
+	h.createNamespace(t, "ingress-issuer")
+
+	issuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt", Namespace: "ingress-issuer"},
+		Spec: certmanagerv1.IssuerSpec{
+			IssuerConfig: certmanagerv1.IssuerConfig{SelfSigned: &certmanagerv1.SelfSignedIssuer{}},
+		},
+	}
+	err := h.virtualClient.Create(h.ctx, issuer)
+	if err != nil {
+		t.Fatalf("create virtual issuer: %v", err)
+	}
+	eventually(t, func() error {
+		return h.hostClient.Get(h.ctx, h.hostName(naming.Issuer, issuer.Name, issuer.Namespace), &certmanagerv1.Issuer{})
+	})
+
+	vIngress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "shop",
+			Namespace:   "ingress-issuer",
+			Annotations: map[string]string{constants.IssuerAnnotation: "letsencrypt"},
+		},
+		Spec: networkingv1.IngressSpec{
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{Name: "shop", Port: networkingv1.ServiceBackendPort{Number: 80}},
+			},
+			TLS: []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "shop-tls"}},
+		},
+	}
+	err = h.virtualClient.Create(h.ctx, vIngress)
+	if err != nil {
+		t.Fatalf("create virtual ingress: %v", err)
+	}
+	pIngress := h.syncIngress(t, vIngress)
+
+	// the ingress shim references the host issuer, which maps back to the virtual issuer
+	pCertificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: pIngress.Spec.TLS[0].SecretName, Namespace: h.hostNamespace},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: pIngress.Spec.TLS[0].SecretName,
+			DNSNames:   pIngress.Spec.TLS[0].Hosts,
+			IssuerRef:  cmmeta.ObjectReference{Name: pIngress.Annotations[constants.IssuerAnnotation], Kind: "Issuer", Group: "cert-manager.io"},
+		},
+	}
+	err = h.hostClient.Create(h.ctx, pCertificate)
+	if err != nil {
+		t.Fatalf("create host certificate: %v", err)
+	}
+
+	eventually(t, func() error {
+		vCertificate := &certmanagerv1.Certificate{}
+		err := h.virtualClient.Get(h.ctx, types.NamespacedName{Namespace: "ingress-issuer", Name: "shop-tls"}, vCertificate)
+		if err != nil {
+			return err
+		} else if vCertificate.Spec.IssuerRef.Name != "letsencrypt" || vCertificate.Spec.IssuerRef.Kind != "Issuer" {
+			return fmt.Errorf("expected virtual certificate issuer Issuer letsencrypt, got %s %s", vCertificate.Spec.IssuerRef.Kind, vCertificate.Spec.IssuerRef.Name)
+		}
+
+		return nil
+	})
+}
+
+func TestStatusPropagation(t *testing.T) {
+	h := newHarness(t)
+	issuer, certificate := h.createCertificate(t, "status")
+
+	// issuer status
+	pIssuer := &certmanagerv1.Issuer{}
+	eventually(t, func() error {
+		return h.hostClient.Get(h.ctx, h.hostName(naming.Issuer, issuer.Name, issuer.Namespace), pIssuer)
+	})
+	pIssuer.Status.Conditions = []certmanagerv1.IssuerCondition{{
+		Type:               certmanagerv1.IssuerConditionReady,
+		Status:             cmmeta.ConditionTrue,
+		Reason:             "IsReady",
+		LastTransitionTime: ptr.To(metav1.NewTime(time.Now().Truncate(time.Second))),
+	}}
+	err := h.hostClient.Status().Update(h.ctx, pIssuer)
+	if err != nil {
+		t.Fatalf("update host issuer status: %v", err)
+	}
+	eventually(t, func() error {
+		vIssuer := &certmanagerv1.Issuer{}
+		err := h.virtualClient.Get(h.ctx, client.ObjectKeyFromObject(issuer), vIssuer)
+		if err != nil {
+			return err
+		} else if len(vIssuer.Status.Conditions) != 1 || vIssuer.Status.Conditions[0].Status != cmmeta.ConditionTrue {
+			return fmt.Errorf("virtual issuer is not ready: %v", vIssuer.Status.Conditions)
+		}
+
+		return nil
+	})
+
+	// certificate status
+	pCertificate := h.waitForHostCertificate(t, certificate)
+	h.issue(t, pCertificate, "status", 1)
+	eventually(t, func() error {
+		vCertificate := &certmanagerv1.Certificate{}
+		err := h.virtualClient.Get(h.ctx, client.ObjectKeyFromObject(certificate), vCertificate)
+		if err != nil {
+			return err
+		} else if !isReady(vCertificate.Status.Conditions) {
+			return fmt.Errorf("virtual certificate is not ready: %v", vCertificate.Status.Conditions)
+		}
+
+		return nil
+	})
+}
+
+func TestRenewal(t *testing.T) {
+	h := newHarness(t)
+	_, certificate := h.createCertificate(t, "renewal")
+	secretName := types.NamespacedName{Namespace: "renewal", Name: "web-tls"}
+
+	pCertificate := h.waitForHostCertificate(t, certificate)
+	h.issue(t, pCertificate, "first", 1)
+	h.waitForVirtualSecret(t, secretName, "first")
+
+	// cert-manager renews the certificate and replaces the secret data
+	h.issue(t, pCertificate, "second", 2)
+	h.waitForVirtualSecret(t, secretName, "second")
+	eventually(t, func() error {
+		vCertificate := &certmanagerv1.Certificate{}
+		err := h.virtualClient.Get(h.ctx, client.ObjectKeyFromObject(certificate), vCertificate)
+		if err != nil {
+			return err
+		} else if vCertificate.Status.Revision == nil || *vCertificate.Status.Revision != 2 {
+			return fmt.Errorf("expected virtual certificate revision 2, got %v", vCertificate.Status.Revision)
+		}
+
+		return nil
+	})
+}
+
+func TestDeletion(t *testing.T) {
+	h := newHarness(t)
+	issuer, certificate := h.createCertificate(t, "deletion")
+	secretName := types.NamespacedName{Namespace: "deletion", Name: "web-tls"}
+
+	pCertificate := h.waitForHostCertificate(t, certificate)
+	h.issue(t, pCertificate, "deletion", 1)
+	h.waitForVirtualSecret(t, secretName, "deletion")
+
+	// deleting the host secret deletes the virtual secret
+	pSecretName := h.hostName(naming.Secret, secretName.Name, secretName.Namespace)
+	err := h.hostClient.Delete(h.ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: pSecretName.Name, Namespace: pSecretName.Namespace}})
+	if err != nil {
+		t.Fatalf("delete host secret: %v", err)
+	}
+	eventually(t, func() error {
+		return expectNotFound(h.virtualClient.Get(h.ctx, secretName, &corev1.Secret{}))
+	})
+
+	// deleting the virtual certificate and issuer deletes the host certificate and issuer
+	err = h.virtualClient.Delete(h.ctx, certificate)
+	if err != nil {
+		t.Fatalf("delete virtual certificate: %v", err)
+	}
+	err = h.virtualClient.Delete(h.ctx, issuer)
+	if err != nil {
+		t.Fatalf("delete virtual issuer: %v", err)
+	}
+	eventually(t, func() error {
+		return expectNotFound(h.hostClient.Get(h.ctx, client.ObjectKeyFromObject(pCertificate), &certmanagerv1.Certificate{}))
+	})
+	eventually(t, func() error {
+		return expectNotFound(h.hostClient.Get(h.ctx, h.hostName(naming.Issuer, issuer.Name, issuer.Namespace), &certmanagerv1.Issuer{}))
+	})
+}
+
+func expectNotFound(err error) error {
+	if err == nil {
+		return fmt.Errorf("object still exists")
+	} else if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}